@@ -1,11 +1,17 @@
 package api
 
 import (
-	"fmt"
+	"context"
+	"github.com/davidramiro/frigabun/internal/auth"
+	"github.com/davidramiro/frigabun/internal/detect"
+	"github.com/davidramiro/frigabun/internal/history"
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
 	"github.com/davidramiro/frigabun/services"
 	"github.com/davidramiro/frigabun/services/factory"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 	"net/http"
+	"net/netip"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -14,22 +20,75 @@ import (
 
 type UpdateApi struct {
 	dnsServiceFactory factory.ServiceFactory
+	updater           *updater.Updater
+	history           *history.Store
+	ipv6Hosts         map[string]netip.Addr
+	detector          AddressDetector
 }
 
+// AddressDetector reports the public addresses frigabun detected itself.
+type AddressDetector interface {
+	Addresses() []detect.Address
+}
+
+type Option func(*UpdateApi)
+
 type StatusResponse struct {
-	ApiStatus      bool                 `json:"api_status"`
-	ActiveServices []services.Registrar `json:"active_services"`
+	ApiStatus      bool                                   `json:"api_status"`
+	ActiveServices []services.Registrar                   `json:"active_services"`
+	Registrars     map[services.Registrar]RegistrarStatus `json:"registrars,omitempty"`
+	// Detected lists the public addresses detected by frigabun and the detectors reporting them.
+	Detected []detect.Address `json:"detected,omitempty"`
 }
 
+// RegistrarStatus reports the runtime state of a registrar's service.
+type RegistrarStatus struct {
+	RateLimit      *services.RateLimitStatus `json:"rate_limit,omitempty"`
+	CircuitBreaker *services.BreakerStatus   `json:"circuit_breaker,omitempty"`
+}
+
+// apex is the subdomain clients may send instead of an empty one to update the record of the domain itself.
+const apex = "@"
+
 type UpdateRequest struct {
 	Domain     string `query:"domain"`
 	Subdomains string `query:"subdomain"`
 	IP         string `query:"ip"`
+	IP6        string `query:"ip6"`
+	IP6Prefix  string `query:"ip6lanprefix"`
 	Registrar  string `query:"registrar"`
+	Format     string `query:"format"`
+}
+
+func NewUpdateApi(dnsServiceFactory factory.ServiceFactory, opts ...Option) *UpdateApi {
+	u := &UpdateApi{dnsServiceFactory: dnsServiceFactory, updater: updater.New()}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
+}
+
+// WithUpdater sets the updater publishing the records, shared with other sources of updates.
+func WithUpdater(updater *updater.Updater) Option {
+	return func(u *UpdateApi) {
+		u.updater = updater
+	}
+}
+
+// WithAddressDetector reports the addresses detected by detector in the status response.
+func WithAddressDetector(detector AddressDetector) Option {
+	return func(u *UpdateApi) {
+		u.detector = detector
+	}
 }
 
-func NewUpdateApi(dnsServiceFactory factory.ServiceFactory) *UpdateApi {
-	return &UpdateApi{dnsServiceFactory: dnsServiceFactory}
+// WithIPv6Hosts sets the interface identifiers by subdomain that get combined with a delegated IPv6 prefix.
+func WithIPv6Hosts(hosts map[string]netip.Addr) Option {
+	return func(u *UpdateApi) {
+		u.ipv6Hosts = hosts
+	}
 }
 
 func (u *UpdateApi) HandleUpdateRequest(c echo.Context) error {
@@ -37,69 +96,242 @@ func (u *UpdateApi) HandleUpdateRequest(c echo.Context) error {
 
 	err := c.Bind(&request)
 	if err != nil {
-		log.Error().Err(err).Msg(ErrCannotParseRequest.Error())
+		zerolog.Ctx(c.Request().Context()).Error().Ctx(c.Request().Context()).Err(err).Msg(ErrCannotParseRequest.Error())
 		return c.String(http.StatusBadRequest, ErrCannotParseRequest.Error())
 	}
 
-	logger := log.With().Str("subdomains", request.Subdomains).Str("domain", request.Domain).Str("IP", request.IP).Logger()
+	// clients behind NAT may leave the address to us, the record type follows the family of the connection
+	auto := request.IP == autoIP || (len(request.IP) == 0 && len(request.IP6) == 0 && len(request.IP6Prefix) == 0)
+	if auto {
+		addr, err := clientAddress(c)
+		if err != nil {
+			zerolog.Ctx(c.Request().Context()).Error().Ctx(c.Request().Context()).Err(err).Msg(err.Error())
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		request.IP = addr.String()
+	}
+
+	logger := zerolog.Ctx(c.Request().Context()).With().Ctx(c.Request().Context()).Str("subdomains", request.Subdomains).Str("domain", request.Domain).Str("IP", request.IP).Str("IP6", request.IP6).Str("IP6Prefix", request.IP6Prefix).Bool("autoIP", auto).Logger()
 	logger.Info().Msg("dns update request received")
 
-	err = validateRequest(request.Domain, request.IP)
+	subdomains := strings.Split(request.Subdomains, ",")
+
+	err = validateRequest(request.Domain, subdomains, request.IP, request.IP6, request.IP6Prefix)
 	if err != nil {
 		logger.Error().Err(err).Msg(err.Error())
 		return c.String(400, err.Error())
 	}
 
-	subdomains := strings.Split(request.Subdomains, ",")
-
-	for i := range subdomains {
-		logger.Debug().Msgf("handling request %d of %d", i+1, len(subdomains))
+	addresses := parseAddresses(request.IP, request.IP6)
+	prefix, _ := netip.ParsePrefix(request.IP6Prefix)
 
-		service, err := u.dnsServiceFactory.Find(services.Registrar(request.Registrar))
-		if err != nil {
-			logger.Err(err).Msg("getting registrar from factory failed")
-			return c.String(400, err.Error())
+	for i, subdomain := range subdomains {
+		if subdomain == apex {
+			subdomains[i] = ""
 		}
+	}
 
-		request := &services.DynDnsRequest{
-			IP:        request.IP,
-			Domain:    request.Domain,
-			Subdomain: subdomains[i],
+	for _, subdomain := range subdomains {
+		if !authorized(c, request.Registrar, request.Domain, subdomain) {
+			return c.String(http.StatusForbidden, ErrForbidden.Error())
 		}
+	}
 
-		err = service.UpdateRecord(request)
-		if err != nil {
-			logger.Err(err).Msg("updating record failed")
-			return c.String(http.StatusInternalServerError, err.Error())
+	service, err := u.dnsServiceFactory.Find(services.Registrar(request.Registrar))
+	if err != nil {
+		logger.Err(err).Msg("getting registrar from factory failed")
+		return c.String(400, err.Error())
+	}
+
+	var jobs []updater.Job
+
+	for _, subdomain := range subdomains {
+		hostAddresses := records.AddressesFor(c.Request().Context(), u.ipv6Hosts, subdomain, addresses, prefix)
+		if len(hostAddresses) == 0 {
+			logger.Warn().Str("subdomain", subdomain).Msg("no address to publish for subdomain, skipping")
+			continue
 		}
 
+		jobs = append(jobs, newJobs(services.Registrar(request.Registrar), service, request.Domain, subdomain, hostAddresses)...)
+	}
+
+	if len(jobs) == 0 {
+		logger.Error().Err(ErrNoRecordsToUpdate).Msg(ErrNoRecordsToUpdate.Error())
+		return c.String(http.StatusBadRequest, ErrNoRecordsToUpdate.Error())
+	}
+
+	results := u.updater.Update(updateContext(c), jobs)
+	response := newUpdateResponse(request.Domain, results)
+
+	logger.Info().Int("succeeded", response.Succeeded).Int("failed", response.Failed).Msg("dns update request handled")
+
+	if request.Format == "json" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.JSON(response.StatusCode(), response)
+	}
+
+	return c.String(response.StatusCode(), response.String())
+}
+
+// updateContext returns the context of the request, carrying the client and credential the update originates from.
+func updateContext(c echo.Context) context.Context {
+	origin := updater.Origin{Client: c.RealIP(), RequestID: c.Response().Header().Get(echo.HeaderXRequestID)}
+	if credential := auth.FromContext(c); credential != nil {
+		origin.Credential = credential.Name
+	}
+
+	return updater.WithOrigin(c.Request().Context(), origin)
+}
+
+// authorized checks the policies of the credential a request was authenticated with and writes an audit log line
+// for denied updates. Requests are authorized if authentication is disabled.
+func authorized(c echo.Context, registrar string, domain string, subdomain string) bool {
+	credential := auth.FromContext(c)
+	if credential == nil || credential.Allows(registrar, domain, subdomain) {
+		return true
+	}
+
+	zerolog.Ctx(c.Request().Context()).Warn().Ctx(c.Request().Context()).
+		Str("audit", "update_denied").
+		Str("credential", credential.Name).
+		Str("client", c.RealIP()).
+		Str("registrar", registrar).
+		Str("domain", domain).
+		Str("subdomain", subdomain).
+		Msg("credential not authorized to update record")
+
+	return false
+}
+
+// newJobs returns a job per address for a subdomain, choosing the record type by address family.
+func newJobs(registrar services.Registrar, service services.DnsUpdateService, domain string, subdomain string, addresses []netip.Addr) []updater.Job {
+	jobs := make([]updater.Job, len(addresses))
+
+	for i, addr := range addresses {
+		jobs[i] = updater.Job{
+			Registrar: registrar,
+			Service:   service,
+			Request: &services.DynDnsRequest{
+				IP:        addr.String(),
+				Type:      services.RecordTypeFor(addr),
+				Domain:    domain,
+				Subdomain: subdomain,
+			},
+		}
 	}
 
-	logger.Info().Int("updates", len(subdomains)).Msg("successfully created")
+	return jobs
+}
 
-	return c.String(http.StatusOK,
-		fmt.Sprintf("created %d entries on %s: %s",
-			len(subdomains),
-			request.Domain,
-			request.IP),
-	)
+// HandleUnauthorized answers update requests with missing or invalid credentials.
+func HandleUnauthorized(c echo.Context) error {
+	return c.String(http.StatusUnauthorized, ErrUnauthorized.Error())
 }
 
 func (u *UpdateApi) HandleStatusCheck(c echo.Context) error {
 	listServices := u.dnsServiceFactory.ListServices()
-	statusResponse := &StatusResponse{ApiStatus: true, ActiveServices: listServices}
+	statusResponse := &StatusResponse{
+		ApiStatus:      true,
+		ActiveServices: listServices,
+		Registrars:     make(map[services.Registrar]RegistrarStatus),
+	}
+
+	for _, registrar := range listServices {
+		service, err := u.dnsServiceFactory.Find(registrar)
+		if err != nil {
+			continue
+		}
+
+		var status RegistrarStatus
+		if limited, ok := service.(services.RateLimited); ok {
+			status.RateLimit = limited.RateLimit()
+		}
+
+		if breaker, ok := service.(services.Breaker); ok {
+			breakerStatus := breaker.Breaker()
+			status.CircuitBreaker = &breakerStatus
+		}
+
+		statusResponse.Registrars[registrar] = status
+	}
+
+	if u.detector != nil {
+		statusResponse.Detected = u.detector.Addresses()
+	}
 
 	return c.JSON(200, statusResponse)
 }
 
-func validateRequest(domain string, ip string) error {
-	if !govalidator.IsIPv4(ip) {
+func validateRequest(domain string, subdomains []string, ip string, ip6 string, ip6Prefix string) error {
+	if len(ip) == 0 && len(ip6) == 0 && len(ip6Prefix) == 0 {
 		return ErrInvalidIP
 	}
 
+	if len(ip) > 0 {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !publishable(addr) {
+			return ErrInvalidIP
+		}
+	}
+
+	if len(ip6) > 0 {
+		addr, err := netip.ParseAddr(ip6)
+		if err != nil || !addr.Is6() || addr.Is4In6() || !publishable(addr) {
+			return ErrInvalidIPv6
+		}
+	}
+
+	if len(ip6Prefix) > 0 {
+		prefix, err := netip.ParsePrefix(ip6Prefix)
+		if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() > 64 {
+			return ErrInvalidIPv6Prefix
+		}
+	}
+
 	if !govalidator.IsDNSName(domain) {
 		return ErrInvalidDomain
 	}
 
+	for _, subdomain := range subdomains {
+		if !validSubdomain(subdomain) {
+			return ErrInvalidSubdomain
+		}
+	}
+
 	return nil
 }
+
+// validSubdomain reports whether subdomain consists of DNS labels, or is empty or "@" for the apex. Registrars put
+// subdomains into URL paths, where anything else could address records outside the domain.
+func validSubdomain(subdomain string) bool {
+	if len(subdomain) == 0 || subdomain == apex {
+		return true
+	}
+
+	return govalidator.IsDNSName(subdomain) && !strings.HasSuffix(subdomain, ".")
+}
+
+// publishable reports whether addr can be the value of a record. Zones and link-local addresses only have a meaning
+// on the host sending them, the unspecified address none at all.
+func publishable(addr netip.Addr) bool {
+	return addr.Zone() == "" && !addr.IsUnspecified() && !addr.IsLinkLocalUnicast()
+}
+
+// parseAddresses returns the validated addresses of a request, at most one per address family.
+// An IPv6 address passed via ip6 takes precedence over an IPv6 literal in ip.
+func parseAddresses(ip string, ip6 string) []netip.Addr {
+	var addresses []netip.Addr
+
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		addresses = append(addresses, addr.Unmap())
+	}
+
+	if addr, err := netip.ParseAddr(ip6); err == nil {
+		if len(addresses) > 0 && addresses[0].Is6() {
+			addresses = addresses[:0]
+		}
+		addresses = append(addresses, addr)
+	}
+
+	return addresses
+}
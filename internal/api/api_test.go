@@ -1,17 +1,24 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/davidramiro/frigabun/internal/auth"
+	"github.com/davidramiro/frigabun/internal/detect"
+	"github.com/davidramiro/frigabun/internal/updater"
 	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
 	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
 	"github.com/davidramiro/frigabun/services"
 	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
 	"testing"
 )
@@ -30,6 +37,7 @@ func TestStatusEndpointOk(t *testing.T) {
 
 	sf := mockfactory.NewMockServiceFactory(t)
 	sf.On("ListServices").Return([]services.Registrar{"cloudflare", "gandi"}).Once()
+	sf.On("Find", mock.Anything).Return(mockservices.NewMockDnsUpdateService(t), nil).Twice()
 
 	updateApi = NewUpdateApi(sf)
 
@@ -42,6 +50,79 @@ func TestStatusEndpointOk(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, true, status.ApiStatus)
 		assert.Equal(t, 2, len(status.ActiveServices))
+		assert.Nil(t, status.Registrars["cloudflare"].RateLimit)
+	}
+}
+
+func TestStatusEndpointRegistrarStatus(t *testing.T) {
+	viper.Set("cloudflare.baseUrl", "https://api.foo.com/client/v4")
+	viper.Set("cloudflare.apiKey", "foo")
+	viper.Set("cloudflare.zoneId", "bar")
+	viper.Set("cloudflare.ttl", 1800)
+	viper.Set("cloudflare.rateLimit.requestsPerSecond", 2)
+	viper.Set("cloudflare.rateLimit.burst", 5)
+	defer viper.Set("cloudflare.rateLimit", nil)
+
+	cloudflare, err := services.NewCloudflareDnsUpdateService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ListServices").Return([]services.Registrar{"cloudflare"}).Once()
+	sf.On("Find", services.Registrar("cloudflare")).Return(services.NewCircuitBreaker(cloudflare), nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleStatusCheck(c)) {
+		var status StatusResponse
+		err := json.Unmarshal(rec.Body.Bytes(), &status)
+
+		assert.Nil(t, err)
+		if assert.NotNil(t, status.Registrars["cloudflare"].RateLimit) {
+			assert.Equal(t, 2.0, status.Registrars["cloudflare"].RateLimit.RequestsPerSecond)
+			assert.Equal(t, 5, status.Registrars["cloudflare"].RateLimit.Burst)
+			assert.Equal(t, 5.0, status.Registrars["cloudflare"].RateLimit.Tokens)
+		}
+		if assert.NotNil(t, status.Registrars["cloudflare"].CircuitBreaker) {
+			assert.Equal(t, services.BreakerClosed, status.Registrars["cloudflare"].CircuitBreaker.State)
+		}
+	}
+}
+
+type fakeDetector []detect.Address
+
+func (f fakeDetector) Addresses() []detect.Address {
+	return f
+}
+
+func TestStatusEndpointDetectedAddresses(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ListServices").Return([]services.Registrar{}).Once()
+
+	updateApi = NewUpdateApi(sf, WithAddressDetector(fakeDetector{
+		{Family: detect.IPv4, IP: netip.MustParseAddr("203.0.113.7"), Sources: []string{"upnp", "stun"}},
+	}))
+
+	if assert.NoError(t, updateApi.HandleStatusCheck(c)) {
+		var status StatusResponse
+		err := json.Unmarshal(rec.Body.Bytes(), &status)
+
+		assert.Nil(t, err)
+		if assert.Len(t, status.Detected, 1) {
+			assert.Equal(t, "203.0.113.7", status.Detected[0].IP.String())
+			assert.Equal(t, []string{"upnp", "stun"}, status.Detected[0].Sources)
+		}
 	}
 }
 
@@ -105,7 +186,7 @@ func TestUpdateEndpointFailureInService(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	cs := mockservices.NewMockDnsUpdateService(t)
-	cs.On("UpdateRecord", mock.Anything).Return(errors.New("failed to update")).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errors.New("failed to update")).Once()
 
 	sf := mockfactory.NewMockServiceFactory(t)
 	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
@@ -114,7 +195,84 @@ func TestUpdateEndpointFailureInService(t *testing.T) {
 
 	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
-		assert.Equal(t, "failed to update", rec.Body.String())
+		assert.Equal(t, "published 0 of 1 records on foo.com\nbar.foo.com A 10.0.0.1 failed: failed to update", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointPartialFailure(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "foo,bar,baz")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar"
+	})).Return(nil, errors.New("failed to update")).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Twice()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		assert.Equal(t, "published 2 of 3 records on foo.com: 10.0.0.1\n"+
+			"foo.foo.com A 10.0.0.1 updated\n"+
+			"bar.foo.com A 10.0.0.1 failed: failed to update\n"+
+			"baz.foo.com A 10.0.0.1 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointPartialFailureJson(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "foo,bar")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+	q.Set("format", "json")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar"
+	})).Return(nil, errors.New("failed to update")).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+
+		var response UpdateResponse
+		err := json.Unmarshal(rec.Body.Bytes(), &response)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, response.Succeeded)
+		assert.Equal(t, 1, response.Failed)
+		if assert.Len(t, response.Results, 2) {
+			assert.Equal(t, "foo", response.Results[0].Subdomain)
+			assert.Equal(t, updater.StatusUpdated, response.Results[0].Status)
+			assert.Equal(t, "bar", response.Results[1].Subdomain)
+			assert.Equal(t, updater.StatusFailed, response.Results[1].Status)
+			assert.Equal(t, "failed to update", response.Results[1].Error)
+		}
 	}
 }
 
@@ -132,7 +290,7 @@ func TestUpdateEndpointSuccessSingleSubdomain(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	cs := mockservices.NewMockDnsUpdateService(t)
-	cs.On("UpdateRecord", mock.Anything).Return(nil).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
 
 	sf := mockfactory.NewMockServiceFactory(t)
 	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
@@ -141,7 +299,7 @@ func TestUpdateEndpointSuccessSingleSubdomain(t *testing.T) {
 
 	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "created 1 entries on foo.com: 10.0.0.1", rec.Body.String())
+		assert.Equal(t, "published 1 of 1 records on foo.com: 10.0.0.1\nbar.foo.com A 10.0.0.1 updated", rec.Body.String())
 	}
 }
 
@@ -158,7 +316,7 @@ func TestUpdateEndpointSuccessNoSubdomain(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	cs := mockservices.NewMockDnsUpdateService(t)
-	cs.On("UpdateRecord", mock.Anything).Return(nil).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
 
 	sf := mockfactory.NewMockServiceFactory(t)
 	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
@@ -167,7 +325,7 @@ func TestUpdateEndpointSuccessNoSubdomain(t *testing.T) {
 
 	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "created 1 entries on foo.com: 10.0.0.1", rec.Body.String())
+		assert.Equal(t, "published 1 of 1 records on foo.com: 10.0.0.1\nfoo.com A 10.0.0.1 updated", rec.Body.String())
 	}
 }
 
@@ -185,30 +343,378 @@ func TestUpdateEndpointSuccessThreeSubdomains(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	cs := mockservices.NewMockDnsUpdateService(t)
-	cs.On("UpdateRecord", mock.Anything).Return(nil).Times(3)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Times(3)
 
 	sf := mockfactory.NewMockServiceFactory(t)
-	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once().Times(3)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
 
 	updateApi = NewUpdateApi(sf)
 
 	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "created 3 entries on foo.com: 10.0.0.1", rec.Body.String())
+		assert.Equal(t, "published 3 of 3 records on foo.com: 10.0.0.1\n"+
+			"foo.foo.com A 10.0.0.1 updated\n"+
+			"bar.foo.com A 10.0.0.1 updated\n"+
+			"baz.foo.com A 10.0.0.1 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointSuccessDualStack(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "bar")
+	q.Set("ip", "10.0.0.1")
+	q.Set("ip6", "2001:db8::1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == services.RecordTypeA && r.IP == "10.0.0.1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == services.RecordTypeAAAA && r.IP == "2001:db8::1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "published 2 of 2 records on foo.com: 10.0.0.1, 2001:db8::1\n"+
+			"bar.foo.com A 10.0.0.1 updated\n"+
+			"bar.foo.com AAAA 2001:db8::1 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointSuccessIPv6Literal(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "bar")
+	q.Set("ip", "2001:db8::1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == services.RecordTypeAAAA && r.IP == "2001:db8::1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "published 1 of 1 records on foo.com: 2001:db8::1\nbar.foo.com AAAA 2001:db8::1 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointSuccessIPv6Prefix(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "nas,router")
+	q.Set("ip", "10.0.0.1")
+	q.Set("ip6", "2001:db8:0:1::1")
+	q.Set("ip6lanprefix", "2001:db8:aa00:1::/64")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == services.RecordTypeA && r.IP == "10.0.0.1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Twice()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "nas" && r.Type == services.RecordTypeAAAA && r.IP == "2001:db8:aa00:1::10"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "router" && r.Type == services.RecordTypeAAAA && r.IP == "2001:db8:0:1::1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf, WithIPv6Hosts(map[string]netip.Addr{"nas": netip.MustParseAddr("::10")}))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "published 4 of 4 records on foo.com: 10.0.0.1, 2001:db8:aa00:1::10, 2001:db8:0:1::1\n"+
+			"nas.foo.com A 10.0.0.1 updated\n"+
+			"nas.foo.com AAAA 2001:db8:aa00:1::10 updated\n"+
+			"router.foo.com A 10.0.0.1 updated\n"+
+			"router.foo.com AAAA 2001:db8:0:1::1 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointIPv6PrefixWithoutHosts(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "router")
+	q.Set("ip6lanprefix", "2001:db8:aa00:1::/64")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf, WithIPv6Hosts(map[string]netip.Addr{"nas": netip.MustParseAddr("::10")}))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, ErrNoRecordsToUpdate.Error(), rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointIPv6HostWithoutPrefix(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "nas,router")
+	q.Set("ip", "10.0.0.1")
+	q.Set("ip6", "2001:db8:0:1::1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == services.RecordTypeA && r.IP == "10.0.0.1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Twice()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "router" && r.Type == services.RecordTypeAAAA && r.IP == "2001:db8:0:1::1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf, WithIPv6Hosts(map[string]netip.Addr{"nas": netip.MustParseAddr("::10")}))
+
+	// the address of the router must not end up in the AAAA record of the nas
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "published 3 of 3 records on foo.com: 10.0.0.1, 2001:db8:0:1::1\n"+
+			"nas.foo.com A 10.0.0.1 updated\n"+
+			"router.foo.com A 10.0.0.1 updated\n"+
+			"router.foo.com AAAA 2001:db8:0:1::1 updated", rec.Body.String())
+	}
+}
+
+func TestInvalidIPv6Prefix(t *testing.T) {
+	err := validateRequest("domain.com", nil, "", "", "2001:db8::/80")
+	assert.Equal(t, ErrInvalidIPv6Prefix, err, "prefix longer than /64 should return error")
+
+	err = validateRequest("domain.com", nil, "", "", "2001:db8::/56")
+	assert.Nil(t, err, "valid prefix should not return error")
+}
+
+func newPolicyAuthenticator(t *testing.T) *auth.Authenticator {
+	sum := sha256.Sum256([]byte("office"))
+
+	a, err := auth.NewAuthenticator(
+		[]auth.Credential{{Name: "office", TokenHash: hex.EncodeToString(sum[:])}},
+		auth.Policy{Credential: "office", Domains: []string{"foo.com"}, Subdomains: []string{"office"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func TestUpdateEndpointForbiddenSubdomain(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "office,mail")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	req.Header.Set("Authorization", "Bearer office")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	updateApi = NewUpdateApi(sf)
+
+	handler := newPolicyAuthenticator(t).Middleware(HandleUnauthorized)(updateApi.HandleUpdateRequest)
+
+	if assert.NoError(t, handler(c)) {
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, ErrForbidden.Error(), rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointAllowedSubdomain(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "office")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	req.Header.Set("Authorization", "Bearer office")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	handler := newPolicyAuthenticator(t).Middleware(HandleUnauthorized)(updateApi.HandleUpdateRequest)
+
+	if assert.NoError(t, handler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
 	}
 }
 
 func TestValidDomainAndIp(t *testing.T) {
-	err := validateRequest("domain.com", "1.1.1.1")
+	err := validateRequest("domain.com", nil, "1.1.1.1", "", "")
 	assert.Nil(t, err, "valid domain and ip should not return error")
 }
 
-func TestInvalidIPv4(t *testing.T) {
-	err := validateRequest("domain.com", "::1")
-	assert.Equal(t, ErrInvalidIP, err, "invalid IPv4 should return error")
+func TestValidIPv6(t *testing.T) {
+	err := validateRequest("domain.com", nil, "::1", "", "")
+	assert.Nil(t, err, "IPv6 literal in ip should not return error")
+
+	err = validateRequest("domain.com", nil, "", "2001:db8::1", "")
+	assert.Nil(t, err, "IPv6 address in ip6 should not return error")
+}
+
+func TestInvalidIP(t *testing.T) {
+	err := validateRequest("domain.com", nil, "", "", "")
+	assert.Equal(t, ErrInvalidIP, err, "missing ip should return error")
+
+	err = validateRequest("domain.com", nil, "1.1.1", "", "")
+	assert.Equal(t, ErrInvalidIP, err, "invalid ip should return error")
+
+	err = validateRequest("domain.com", nil, "0.0.0.0", "", "")
+	assert.Equal(t, ErrInvalidIP, err, "unspecified ip should return error")
+
+	err = validateRequest("domain.com", nil, "169.254.1.1", "", "")
+	assert.Equal(t, ErrInvalidIP, err, "link-local ip should return error")
+}
+
+func TestInvalidIPv6(t *testing.T) {
+	err := validateRequest("domain.com", nil, "1.1.1.1", "1.1.1.1", "")
+	assert.Equal(t, ErrInvalidIPv6, err, "IPv4 in ip6 should return error")
+
+	err = validateRequest("domain.com", nil, "", "fe80::1%eth0", "")
+	assert.Equal(t, ErrInvalidIPv6, err, "zoned ip6 should return error")
+
+	err = validateRequest("domain.com", nil, "", "fe80::1", "")
+	assert.Equal(t, ErrInvalidIPv6, err, "link-local ip6 should return error")
+
+	err = validateRequest("domain.com", nil, "2001:db8::1%eth0", "", "")
+	assert.Equal(t, ErrInvalidIP, err, "zoned ip should return error")
+
+	err = validateRequest("domain.com", nil, "", "::", "")
+	assert.Equal(t, ErrInvalidIPv6, err, "unspecified ip6 should return error")
 }
 
 func TestInvalidDomain(t *testing.T) {
-	err := validateRequest("domain .com", "1.1.1.1")
+	err := validateRequest("domain .com", nil, "1.1.1.1", "", "")
 	assert.Equal(t, ErrInvalidDomain, err, "invalid domain should return error")
 }
+
+func TestParseAddressesPrefersIP6(t *testing.T) {
+	addresses := parseAddresses("2001:db8::1", "2001:db8::2")
+	if assert.Len(t, addresses, 1) {
+		assert.Equal(t, "2001:db8::2", addresses[0].String())
+	}
+}
+
+func TestInvalidSubdomain(t *testing.T) {
+	for _, subdomain := range []string{"x/../../../other.tld/records/www", "a/b", "a..b", "..", "a.", "foo bar", "%2e%2e"} {
+		err := validateRequest("domain.com", []string{"www", subdomain}, "1.1.1.1", "", "")
+		assert.ErrorIs(t, err, ErrInvalidSubdomain, subdomain)
+	}
+
+	err := validateRequest("domain.com", []string{"", "@", "www", "a.b", "_acme-challenge"}, "1.1.1.1", "", "")
+	assert.NoError(t, err)
+}
+
+func TestUpdateEndpointInvalidSubdomain(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "office,x/../../../bar.com/records/www")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "gandi")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, ErrInvalidSubdomain.Error(), rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointApex(t *testing.T) {
+	e := echo.New()
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "@")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, &services.DynDnsRequest{
+		IP: "10.0.0.1", Type: services.RecordTypeA, Domain: "foo.com", Subdomain: "",
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
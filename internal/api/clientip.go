@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"net"
+	"net/netip"
+)
+
+const autoIP = "auto"
+
+// LoadIPExtractor returns how the address of the client is determined, configured by api.clientIpHeader:
+//   - xff (default): the last address in X-Forwarded-For not belonging to a trusted proxy
+//   - realip: X-Real-IP if set by a trusted proxy
+//   - none: the address of the connection, for deployments without reverse proxy
+//
+// Proxies on loopback, link-local and private addresses are trusted unless api.trustPrivateProxies is false,
+// additional proxies are listed as CIDR ranges in api.trustedProxies.
+func LoadIPExtractor() (echo.IPExtractor, error) {
+	header := viper.GetString("api.clientIpHeader")
+	if header == "none" {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	trustPrivate := !viper.IsSet("api.trustPrivateProxies") || viper.GetBool("api.trustPrivateProxies")
+	opts := []echo.TrustOption{
+		echo.TrustLoopback(trustPrivate),
+		echo.TrustLinkLocal(trustPrivate),
+		echo.TrustPrivateNet(trustPrivate),
+	}
+
+	for _, proxy := range viper.GetStringSlice("api.trustedProxies") {
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTrustedProxy, proxy)
+		}
+
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+
+	switch header {
+	case "xff", "":
+		return echo.ExtractIPFromXFFHeader(opts...), nil
+	case "realip":
+		return echo.ExtractIPFromRealIPHeader(opts...), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClientIPHeader, header)
+	}
+}
+
+// clientAddress returns the address of the client as determined by the IP extractor of echo.
+func clientAddress(c echo.Context) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(c.RealIP())
+	if err != nil {
+		return netip.Addr{}, ErrUnknownClientIP
+	}
+
+	return addr.WithZone("").Unmap(), nil
+}
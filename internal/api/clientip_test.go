@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func autoUpdateRequest(e *echo.Echo, ip string, remoteAddr string, headers map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "bar")
+	q.Set("registrar", "cloudflare")
+	if len(ip) > 0 {
+		q.Set("ip", ip)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func expectUpdate(t *testing.T, recordType services.RecordType, ip string) *mockfactory.MockServiceFactory {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Type == recordType && r.IP == ip
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	return sf
+}
+
+func TestUpdateEndpointAutoIP(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	c, rec := autoUpdateRequest(e, "auto", "203.0.113.7:4711", nil)
+
+	updateApi = NewUpdateApi(expectUpdate(t, services.RecordTypeA, "203.0.113.7"))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "published 1 of 1 records on foo.com: 203.0.113.7\nbar.foo.com A 203.0.113.7 updated", rec.Body.String())
+	}
+}
+
+func TestUpdateEndpointOmittedIPv6Client(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	c, rec := autoUpdateRequest(e, "", "[2001:db8::7]:4711", nil)
+
+	updateApi = NewUpdateApi(expectUpdate(t, services.RecordTypeAAAA, "2001:db8::7"))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestUpdateEndpointAutoIPTrustedProxy(t *testing.T) {
+	defer viper.Reset()
+
+	extractor, err := LoadIPExtractor()
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.IPExtractor = extractor
+
+	// the reverse proxy on the local network passes the client on
+	c, rec := autoUpdateRequest(e, "auto", "10.0.0.2:4711", map[string]string{
+		echo.HeaderXForwardedFor: "198.51.100.9",
+	})
+
+	updateApi = NewUpdateApi(expectUpdate(t, services.RecordTypeA, "198.51.100.9"))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestUpdateEndpointAutoIPUntrustedProxy(t *testing.T) {
+	defer viper.Reset()
+
+	extractor, err := LoadIPExtractor()
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.IPExtractor = extractor
+
+	// clients on the internet can't choose the address by sending the header themselves
+	c, rec := autoUpdateRequest(e, "auto", "203.0.113.7:4711", map[string]string{
+		echo.HeaderXForwardedFor: "198.51.100.9",
+	})
+
+	updateApi = NewUpdateApi(expectUpdate(t, services.RecordTypeA, "203.0.113.7"))
+
+	if assert.NoError(t, updateApi.HandleUpdateRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestLoadIPExtractor(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("api.clientIpHeader", "realip")
+	viper.Set("api.trustedProxies", []string{"203.0.113.0/24"})
+	viper.Set("api.trustPrivateProxies", false)
+
+	extractor, err := LoadIPExtractor()
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRealIP, "2001:db8::7")
+
+	req.RemoteAddr = "203.0.113.1:4711"
+	assert.Equal(t, "2001:db8::7", extractor(req))
+
+	req.RemoteAddr = "10.0.0.2:4711"
+	assert.Equal(t, "10.0.0.2", extractor(req))
+}
+
+func TestLoadIPExtractorInvalid(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("api.trustedProxies", []string{"10.0.0.1"})
+	_, err := LoadIPExtractor()
+	assert.ErrorIs(t, err, ErrInvalidTrustedProxy)
+
+	viper.Set("api.trustedProxies", nil)
+	viper.Set("api.clientIpHeader", "forwarded")
+	_, err = LoadIPExtractor()
+	assert.ErrorIs(t, err, ErrInvalidClientIPHeader)
+}
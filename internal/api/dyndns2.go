@@ -0,0 +1,186 @@
+package api
+
+import (
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// return codes of the dyndns2 protocol, see https://help.dyn.com/remote-access-api/return-codes/
+const (
+	dynDns2Good    = "good"
+	dynDns2NoChg   = "nochg"
+	dynDns2BadAuth = "badauth"
+	dynDns2NotFqdn = "notfqdn"
+	dynDns2NoHost  = "nohost"
+	dynDns2NumHost = "numhost"
+	dynDns2Error   = "911"
+)
+
+// maxDynDns2Hostnames is the number of hostnames accepted in a single request by the dyndns2 protocol.
+const maxDynDns2Hostnames = 20
+
+type DynDns2Request struct {
+	Hostnames string `query:"hostname"`
+	MyIP      string `query:"myip"`
+	MyIPv6    string `query:"myipv6"`
+}
+
+// HandleDynDns2Request handles update requests of clients speaking the dyndns2 protocol. Hostnames are mapped to
+// registrars by the domains configured for each registrar. Credentials are checked by the auth middleware. Replies are plain text, one line per hostname.
+func (u *UpdateApi) HandleDynDns2Request(c echo.Context) error {
+	var request DynDns2Request
+
+	err := c.Bind(&request)
+	if err != nil {
+		zerolog.Ctx(c.Request().Context()).Error().Ctx(c.Request().Context()).Err(err).Msg(ErrCannotParseRequest.Error())
+		return c.String(http.StatusBadRequest, dynDns2Error)
+	}
+
+	logger := zerolog.Ctx(c.Request().Context()).With().Ctx(c.Request().Context()).Str("hostnames", request.Hostnames).Str("myip", request.MyIP).Str("myipv6", request.MyIPv6).Logger()
+	logger.Info().Msg("dyndns2 update request received")
+
+	hostnames := strings.Split(request.Hostnames, ",")
+	if len(hostnames) > maxDynDns2Hostnames {
+		logger.Error().Int("hostnames", len(hostnames)).Msg("too many hostnames")
+		return c.String(http.StatusOK, dynDns2NumHost)
+	}
+
+	addresses, err := parseDynDns2Addresses(request.MyIP, request.MyIPv6)
+	if err != nil {
+		logger.Error().Err(err).Msg(err.Error())
+		return c.String(http.StatusOK, dynDns2Error)
+	}
+
+	if len(addresses) == 0 {
+		addr, err := clientAddress(c)
+		if err != nil {
+			logger.Error().Err(err).Msg(err.Error())
+			return c.String(http.StatusOK, dynDns2Error)
+		}
+
+		logger.Debug().Str("ip", addr.String()).Msg("no ip given, using address of client")
+		addresses = append(addresses, addr)
+	}
+
+	ips := make([]string, len(addresses))
+	for i, addr := range addresses {
+		ips[i] = addr.String()
+	}
+
+	replies := make([]string, len(hostnames))
+
+	var jobs []updater.Job
+	var owners []int
+
+	for i, hostname := range hostnames {
+		hostJobs, reply := u.dynDns2Jobs(c, hostname, addresses)
+		replies[i] = reply
+
+		jobs = append(jobs, hostJobs...)
+		for range hostJobs {
+			owners = append(owners, i)
+		}
+	}
+
+	changed := make([]bool, len(hostnames))
+
+	for i, result := range u.updater.Update(updateContext(c), jobs) {
+		if result.Failed() {
+			replies[owners[i]] = dynDns2Error
+		}
+
+		if result.Changed() {
+			changed[owners[i]] = true
+		}
+	}
+
+	for i := range replies {
+		if replies[i] == dynDns2Good && !changed[i] {
+			replies[i] = dynDns2NoChg
+		}
+
+		if replies[i] == dynDns2Good || replies[i] == dynDns2NoChg {
+			replies[i] += " " + strings.Join(ips, ",")
+		}
+	}
+
+	return c.String(http.StatusOK, strings.Join(replies, "\n"))
+}
+
+// HandleDynDns2Unauthorized answers dyndns2 requests with missing or invalid credentials.
+func HandleDynDns2Unauthorized(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="frigabun"`)
+	return c.String(http.StatusUnauthorized, dynDns2BadAuth)
+}
+
+// dynDns2Jobs returns the jobs to publish the addresses for a single hostname. If the hostname can't be updated,
+// no jobs are returned and the reply holds the matching dyndns2 return code.
+func (u *UpdateApi) dynDns2Jobs(c echo.Context, hostname string, addresses []netip.Addr) ([]updater.Job, string) {
+	// some clients separate the hostnames by comma and space
+	hostname = strings.TrimSpace(hostname)
+
+	logger := zerolog.Ctx(c.Request().Context()).With().Ctx(c.Request().Context()).Str("hostname", hostname).Logger()
+
+	if !govalidator.IsDNSName(hostname) || !strings.Contains(hostname, ".") {
+		logger.Error().Msg(ErrInvalidDomain.Error())
+		return nil, dynDns2NotFqdn
+	}
+
+	registrar, domain, err := u.dnsServiceFactory.ResolveDomain(hostname)
+	if err != nil {
+		logger.Err(err).Msg("resolving domain failed")
+		return nil, dynDns2NoHost
+	}
+
+	subdomain := records.Subdomain(hostname, domain)
+	if !validSubdomain(subdomain) {
+		logger.Error().Msg(ErrInvalidSubdomain.Error())
+		return nil, dynDns2NotFqdn
+	}
+
+	if !authorized(c, string(registrar), domain, subdomain) {
+		return nil, dynDns2NoHost
+	}
+
+	service, err := u.dnsServiceFactory.Find(registrar)
+	if err != nil {
+		logger.Err(err).Msg("getting registrar from factory failed")
+		return nil, dynDns2NoHost
+	}
+
+	return newJobs(registrar, service, domain, subdomain, addresses), dynDns2Good
+}
+
+// parseDynDns2Addresses parses the addresses of a dyndns2 request. Clients send either a single address or a comma
+// separated IPv4 and IPv6 address in myip, some send the IPv6 address in myipv6 instead.
+func parseDynDns2Addresses(myIP string, myIPv6 string) ([]netip.Addr, error) {
+	var ip, ip6 string
+
+	for _, value := range strings.Split(myIP+","+myIPv6, ",") {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil || !publishable(addr) {
+			return nil, ErrInvalidIP
+		}
+
+		if services.RecordTypeFor(addr) == services.RecordTypeA {
+			ip = value
+		} else {
+			ip6 = value
+		}
+	}
+
+	return parseAddresses(ip, ip6), nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newDynDns2Context(q url.Values, auth bool) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/nic/update?%s", q.Encode()), nil)
+	if auth {
+		req.SetBasicAuth("user", "pass")
+	}
+	rec := httptest.NewRecorder()
+
+	return e.NewContext(req, rec), rec
+}
+
+func TestDynDns2Unauthorized(t *testing.T) {
+	c, rec := newDynDns2Context(make(url.Values), false)
+
+	if assert.NoError(t, HandleDynDns2Unauthorized(c)) {
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "badauth", rec.Body.String())
+		assert.Equal(t, `Basic realm="frigabun"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	}
+}
+
+func TestDynDns2Success(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "bar.foo.com,foo.com")
+	q.Set("myip", "10.0.0.1,2001:db8::1")
+
+	c, rec := newDynDns2Context(q, true)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar" && r.Domain == "foo.com"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Twice()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "" && r.Domain == "foo.com"
+	})).Return(&services.UpdateResult{Action: services.ActionUnchanged}, nil).Twice()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ResolveDomain", "bar.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("ResolveDomain", "foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Twice()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "good 10.0.0.1,2001:db8::1\nnochg 10.0.0.1,2001:db8::1", rec.Body.String())
+	}
+}
+
+func TestDynDns2HostnamesWithSpaces(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "bar.foo.com, baz.foo.com")
+	q.Set("myip", "10.0.0.1")
+
+	c, rec := newDynDns2Context(q, true)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).
+		Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Twice()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ResolveDomain", "bar.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("ResolveDomain", "baz.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Twice()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "good 10.0.0.1\ngood 10.0.0.1", rec.Body.String())
+	}
+}
+
+func TestDynDns2ClientAddress(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "bar.foo.com")
+
+	c, rec := newDynDns2Context(q, true)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.IP == "192.0.2.1"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ResolveDomain", "bar.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "good 192.0.2.1", rec.Body.String())
+	}
+}
+
+func TestDynDns2Errors(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "bar.foo.com,bar.foo.org,foo,baz.foo.com")
+	q.Set("myip", "10.0.0.1")
+
+	c, rec := newDynDns2Context(q, true)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar"
+	})).Return(nil, errors.New("failed to update")).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "baz"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ResolveDomain", "bar.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("ResolveDomain", "baz.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+	sf.On("ResolveDomain", "bar.foo.org").Return(services.Registrar(""), "", services.ErrDomainNotFound).Once()
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Twice()
+
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "911\nnohost\nnotfqdn\ngood 10.0.0.1", rec.Body.String())
+	}
+}
+
+func TestDynDns2ForbiddenHostname(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "mail.foo.com")
+	q.Set("myip", "10.0.0.1")
+
+	c, rec := newDynDns2Context(q, false)
+	c.Request().Header.Set("Authorization", "Bearer office")
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ResolveDomain", "mail.foo.com").Return(services.Registrar("cloudflare"), "foo.com", nil).Once()
+
+	updateApi = NewUpdateApi(sf)
+
+	handler := newPolicyAuthenticator(t).Middleware(HandleDynDns2Unauthorized)(updateApi.HandleDynDns2Request)
+
+	if assert.NoError(t, handler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "nohost", rec.Body.String())
+	}
+}
+
+func TestDynDns2TooManyHostnames(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "a.foo.com,b.foo.com,c.foo.com,d.foo.com,e.foo.com,f.foo.com,g.foo.com,h.foo.com,i.foo.com,"+
+		"j.foo.com,k.foo.com,l.foo.com,m.foo.com,n.foo.com,o.foo.com,p.foo.com,q.foo.com,r.foo.com,s.foo.com,"+
+		"t.foo.com,u.foo.com")
+	q.Set("myip", "10.0.0.1")
+
+	c, rec := newDynDns2Context(q, true)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, "numhost", rec.Body.String())
+	}
+}
+
+func TestDynDns2InvalidIP(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "bar.foo.com")
+	q.Set("myip", "10.0.0")
+
+	c, rec := newDynDns2Context(q, true)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	updateApi = NewUpdateApi(sf)
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, "911", rec.Body.String())
+	}
+}
+
+func TestParseDynDns2Addresses(t *testing.T) {
+	addresses, err := parseDynDns2Addresses("10.0.0.1", "2001:db8::1")
+	assert.Nil(t, err)
+	assert.Len(t, addresses, 2)
+
+	addresses, err = parseDynDns2Addresses("2001:db8::1", "")
+	assert.Nil(t, err)
+	if assert.Len(t, addresses, 1) {
+		assert.Equal(t, "2001:db8::1", addresses[0].String())
+	}
+
+	addresses, err = parseDynDns2Addresses("", "")
+	assert.Nil(t, err)
+	assert.Len(t, addresses, 0)
+}
+
+func TestDynDns2InvalidHostname(t *testing.T) {
+	q := make(url.Values)
+	q.Set("hostname", "x/../../../bar.com/records/www.foo.com,a..foo.com")
+	q.Set("myip", "10.0.0.1")
+
+	c, rec := newDynDns2Context(q, true)
+
+	updateApi = NewUpdateApi(mockfactory.NewMockServiceFactory(t))
+
+	if assert.NoError(t, updateApi.HandleDynDns2Request(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "notfqdn\nnotfqdn", rec.Body.String())
+	}
+}
@@ -4,7 +4,20 @@ import "errors"
 
 var (
 	ErrCannotParseRequest = errors.New("cannot parse request")
+	ErrUnauthorized       = errors.New("missing or invalid credentials")
+	ErrForbidden          = errors.New("credential not authorized to update record")
 	ErrMissingParameter   = errors.New("missing parameter")
-	ErrInvalidIP          = errors.New("missing or invalid IP address, only IPv4 allowed")
+	ErrInvalidIP          = errors.New("missing or invalid IP address")
+	ErrInvalidIPv6        = errors.New("invalid IPv6 address")
+	ErrInvalidIPv6Prefix  = errors.New("invalid IPv6 prefix")
+	ErrNoRecordsToUpdate  = errors.New("no records to update for the given subdomains")
 	ErrInvalidDomain      = errors.New("missing or invalid domain name")
+	ErrInvalidSubdomain   = errors.New("invalid subdomain")
+	ErrInvalidTimeRange   = errors.New("invalid time range, use RFC 3339 timestamps")
+	ErrInvalidPagination  = errors.New("invalid offset or limit")
+	ErrHistoryDisabled    = errors.New("history not available")
+	ErrUnknownClientIP    = errors.New("cannot determine IP address of client")
+
+	ErrInvalidTrustedProxy   = errors.New("invalid trusted proxy, must be a CIDR range")
+	ErrInvalidClientIPHeader = errors.New("invalid client IP header, must be xff, realip or none")
 )
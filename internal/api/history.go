@@ -0,0 +1,112 @@
+package api
+
+import (
+	"github.com/davidramiro/frigabun/internal/auth"
+	"github.com/davidramiro/frigabun/internal/history"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type HistoryRequest struct {
+	Domain    string `query:"domain"`
+	Registrar string `query:"registrar"`
+	From      string `query:"from"`
+	To        string `query:"to"`
+	Offset    int    `query:"offset"`
+	Limit     int    `query:"limit"`
+}
+
+type HistoryResponse struct {
+	Total   int             `json:"total"`
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+	Entries []history.Entry `json:"entries"`
+}
+
+// WithHistory sets the history served by HandleHistoryRequest.
+func WithHistory(store *history.Store) Option {
+	return func(u *UpdateApi) {
+		u.history = store
+	}
+}
+
+// HandleHistoryRequest returns the update history, newest first, filtered by domain, registrar and time range.
+func (u *UpdateApi) HandleHistoryRequest(c echo.Context) error {
+	if u.history == nil {
+		return c.String(http.StatusNotFound, ErrHistoryDisabled.Error())
+	}
+
+	var request HistoryRequest
+
+	err := c.Bind(&request)
+	if err != nil {
+		zerolog.Ctx(c.Request().Context()).Error().Ctx(c.Request().Context()).Err(err).Msg(ErrCannotParseRequest.Error())
+		return c.String(http.StatusBadRequest, ErrCannotParseRequest.Error())
+	}
+
+	query, err := request.query()
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	// entries of records the credential may not update are hidden, before counting them
+	if credential := auth.FromContext(c); credential != nil {
+		query.Allow = func(e history.Entry) bool {
+			return credential.Allows(string(e.Registrar), e.Domain, e.Subdomain())
+		}
+	}
+
+	entries, total := u.history.Query(query)
+
+	return c.JSON(http.StatusOK, &HistoryResponse{
+		Total:   total,
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+		Entries: entries,
+	})
+}
+
+func (r HistoryRequest) query() (history.Query, error) {
+	query := history.Query{
+		Domain:    r.Domain,
+		Registrar: services.Registrar(r.Registrar),
+		Offset:    r.Offset,
+		Limit:     r.Limit,
+	}
+
+	if query.Offset < 0 || query.Limit < 0 || query.Limit > maxHistoryLimit {
+		return query, ErrInvalidPagination
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultHistoryLimit
+	}
+
+	var err error
+
+	if len(r.From) > 0 {
+		if query.From, err = time.Parse(time.RFC3339, r.From); err != nil {
+			return query, ErrInvalidTimeRange
+		}
+	}
+
+	if len(r.To) > 0 {
+		if query.To, err = time.Parse(time.RFC3339, r.To); err != nil {
+			return query, ErrInvalidTimeRange
+		}
+	}
+
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, ErrInvalidTimeRange
+	}
+
+	return query, nil
+}
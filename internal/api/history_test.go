@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/history"
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newHistoryContext(q url.Values) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/history?%s", q.Encode()), nil)
+	rec := httptest.NewRecorder()
+
+	return e.NewContext(req, rec), rec
+}
+
+func TestHistoryEndpointRecordsUpdates(t *testing.T) {
+	store, _ := history.NewStore("", 0, 0)
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).
+		Return(&services.UpdateResult{Action: services.ActionUpdated, PreviousValue: "10.0.0.2"}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("Find", services.Registrar("cloudflare")).Return(cs, nil).Once()
+
+	updateApi = NewUpdateApi(sf,
+		WithUpdater(updater.New(updater.WithListener(store))),
+		WithHistory(store))
+
+	q := make(url.Values)
+	q.Set("domain", "foo.com")
+	q.Set("subdomain", "bar")
+	q.Set("ip", "10.0.0.1")
+	q.Set("registrar", "cloudflare")
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?%s", q.Encode()), nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if !assert.NoError(t, updateApi.HandleUpdateRequest(e.NewContext(req, httptest.NewRecorder()))) {
+		return
+	}
+
+	q = make(url.Values)
+	q.Set("domain", "foo.com")
+	c, rec := newHistoryContext(q)
+
+	if assert.NoError(t, updateApi.HandleHistoryRequest(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response HistoryResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Total)
+		assert.Equal(t, defaultHistoryLimit, response.Limit)
+		if assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "bar.foo.com", response.Entries[0].FQDN)
+			assert.Equal(t, "192.0.2.1", response.Entries[0].Client)
+			assert.Equal(t, "10.0.0.2", response.Entries[0].PreviousValue)
+			assert.Equal(t, "10.0.0.1", response.Entries[0].Value)
+			assert.Equal(t, updater.StatusUpdated, response.Entries[0].Status)
+		}
+	}
+}
+
+func TestHistoryEndpointFilters(t *testing.T) {
+	store, _ := history.NewStore("", 0, 0)
+	now := time.Now().UTC()
+	_ = store.Add(
+		history.Entry{Time: now.Add(-2 * time.Hour), Registrar: "cloudflare", Domain: "foo.com", FQDN: "foo.com"},
+		history.Entry{Time: now.Add(-time.Hour), Registrar: "gandi", Domain: "foo.org", FQDN: "foo.org"},
+		history.Entry{Time: now, Registrar: "gandi", Domain: "foo.org", FQDN: "bar.foo.org"},
+	)
+
+	updateApi = NewUpdateApi(mockfactory.NewMockServiceFactory(t), WithHistory(store))
+
+	q := make(url.Values)
+	q.Set("registrar", "gandi")
+	q.Set("from", now.Add(-90*time.Minute).Format(time.RFC3339))
+	q.Set("limit", "1")
+	c, rec := newHistoryContext(q)
+
+	if assert.NoError(t, updateApi.HandleHistoryRequest(c)) {
+		var response HistoryResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 2, response.Total)
+		if assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "bar.foo.org", response.Entries[0].FQDN)
+		}
+	}
+}
+
+func TestHistoryEndpointScopedCredential(t *testing.T) {
+	store, _ := history.NewStore("", 0, 0)
+	now := time.Now().UTC()
+	_ = store.Add(
+		history.Entry{Time: now.Add(-3 * time.Hour), Registrar: "cloudflare", Domain: "foo.com", FQDN: "office.foo.com"},
+		history.Entry{Time: now.Add(-2 * time.Hour), Registrar: "cloudflare", Domain: "foo.com", FQDN: "mail.foo.com"},
+		history.Entry{Time: now.Add(-time.Hour), Registrar: "cloudflare", Domain: "foo.com", FQDN: "office.foo.com"},
+		history.Entry{Time: now, Registrar: "gandi", Domain: "foo.org", FQDN: "office.foo.org"},
+	)
+
+	updateApi = NewUpdateApi(mockfactory.NewMockServiceFactory(t), WithHistory(store))
+
+	q := make(url.Values)
+	q.Set("limit", "1")
+	c, rec := newHistoryContext(q)
+	c.Request().Header.Set("Authorization", "Bearer office")
+
+	handler := newPolicyAuthenticator(t).Middleware(HandleUnauthorized)(updateApi.HandleHistoryRequest)
+
+	if assert.NoError(t, handler(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response HistoryResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 2, response.Total)
+		if assert.Len(t, response.Entries, 1) {
+			assert.Equal(t, "office.foo.com", response.Entries[0].FQDN)
+			assert.Equal(t, now.Add(-time.Hour), response.Entries[0].Time)
+		}
+	}
+}
+
+func TestHistoryEndpointInvalidParameters(t *testing.T) {
+	store, _ := history.NewStore("", 0, 0)
+	updateApi = NewUpdateApi(mockfactory.NewMockServiceFactory(t), WithHistory(store))
+
+	for params, expected := range map[string]error{
+		"from=yesterday": ErrInvalidTimeRange,
+		"from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z": ErrInvalidTimeRange,
+		"limit=1000": ErrInvalidPagination,
+		"offset=-1":  ErrInvalidPagination,
+	} {
+		q, _ := url.ParseQuery(params)
+		c, rec := newHistoryContext(q)
+
+		if assert.NoError(t, updateApi.HandleHistoryRequest(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code, params)
+			assert.Equal(t, expected.Error(), rec.Body.String(), params)
+		}
+	}
+}
+
+func TestHistoryEndpointDisabled(t *testing.T) {
+	updateApi = NewUpdateApi(mockfactory.NewMockServiceFactory(t))
+
+	c, rec := newHistoryContext(make(url.Values))
+
+	if assert.NoError(t, updateApi.HandleHistoryRequest(c)) {
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UpdateResponse summarizes the results of an update request.
+type UpdateResponse struct {
+	Domain    string           `json:"domain"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []updater.Result `json:"results"`
+}
+
+func newUpdateResponse(domain string, results []updater.Result) *UpdateResponse {
+	response := &UpdateResponse{Domain: domain, Results: results}
+
+	for _, result := range results {
+		if result.Failed() {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+
+	return response
+}
+
+// StatusCode returns 200 if all records were published, 207 on partial failure and 500 if all records failed.
+func (r *UpdateResponse) StatusCode() int {
+	switch {
+	case r.Failed == 0:
+		return http.StatusOK
+	case r.Succeeded == 0:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
+// String returns a plain text summary, followed by a line per record.
+func (r *UpdateResponse) String() string {
+	var published []string
+	for _, result := range r.Results {
+		if !result.Failed() && !slices.Contains(published, result.IP) {
+			published = append(published, result.IP)
+		}
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "published %d of %d records on %s", r.Succeeded, len(r.Results), r.Domain)
+	if len(published) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(published, ", "))
+	}
+
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "\n%s %s %s %s", result.FQDN(), result.Type, result.IP, result.Status)
+		if result.Failed() {
+			fmt.Fprintf(&b, ": %s", result.Error)
+		}
+	}
+
+	return b.String()
+}
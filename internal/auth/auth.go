@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"net/url"
+	"strings"
+)
+
+// contextKey is the key the authenticated credential is stored under in the echo context.
+const contextKey = "credential"
+
+// sensitiveParams are query parameters whose values never make it into logs.
+var sensitiveParams = []string{"password", "token"}
+
+type Credential struct {
+	Name         string `mapstructure:"name"`
+	Username     string `mapstructure:"username"`
+	PasswordHash string `mapstructure:"passwordHash"`
+	TokenHash    string `mapstructure:"tokenHash"`
+	policies     []Policy
+}
+
+type Authenticator struct {
+	credentials []Credential
+	// dummy is verified for unknown usernames, so the response time doesn't tell which usernames exist.
+	dummy verifier
+}
+
+// LoadAuthenticator reads the configured credentials. Without credentials, authentication is disabled.
+func LoadAuthenticator() (*Authenticator, error) {
+	var credentials []Credential
+
+	err := viper.UnmarshalKey("auth.credentials", &credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []Policy
+
+	err = viper.UnmarshalKey("auth.policies", &policies)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuthenticator(credentials, policies...)
+}
+
+// NewAuthenticator validates the credentials and attaches the policies to the credentials they name.
+func NewAuthenticator(credentials []Credential, policies ...Policy) (*Authenticator, error) {
+	for i := range credentials {
+		credential := &credentials[i]
+
+		if len(credential.Name) == 0 {
+			credential.Name = credential.Username
+		}
+
+		if len(credential.PasswordHash) == 0 && len(credential.TokenHash) == 0 {
+			return nil, ErrMissingSecret
+		}
+
+		if len(credential.PasswordHash) > 0 {
+			if len(credential.Username) == 0 {
+				return nil, ErrMissingUsername
+			}
+
+			if _, err := newVerifier(credential.PasswordHash); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(credential.TokenHash) > 0 {
+			if b, err := hex.DecodeString(credential.TokenHash); err != nil || len(b) != sha256.Size {
+				return nil, ErrInvalidTokenHash
+			}
+		}
+
+		if len(credential.Name) == 0 {
+			return nil, ErrMissingName
+		}
+
+		log.Debug().Str("credential", credential.Name).Msg("registered credential")
+	}
+
+	for _, policy := range policies {
+		if err := validatePolicy(policy); err != nil {
+			return nil, err
+		}
+
+		found := false
+		for i := range credentials {
+			if credentials[i].Name == policy.Credential {
+				credentials[i].policies = append(credentials[i].policies, policy)
+				found = true
+			}
+		}
+
+		if !found {
+			log.Error().Str("credential", policy.Credential).Msg(ErrUnknownCredential.Error())
+			return nil, ErrUnknownCredential
+		}
+	}
+
+	a := &Authenticator{credentials: credentials}
+
+	for _, credential := range credentials {
+		if len(credential.PasswordHash) > 0 {
+			dummy, err := newDummyVerifier(credential.PasswordHash)
+			if err != nil {
+				return nil, err
+			}
+
+			a.dummy = dummy
+			break
+		}
+	}
+
+	return a, nil
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.credentials) > 0
+}
+
+// Authenticate checks a username and password against the configured password hashes.
+func (a *Authenticator) Authenticate(username string, password string) (*Credential, error) {
+	verified := false
+
+	for i := range a.credentials {
+		credential := &a.credentials[i]
+		if len(credential.PasswordHash) == 0 || credential.Username != username {
+			continue
+		}
+
+		verifier, err := newVerifier(credential.PasswordHash)
+		if err != nil {
+			return nil, err
+		}
+
+		verified = true
+		if verifier.verify(password) {
+			return credential, nil
+		}
+	}
+
+	if !verified && a.dummy != nil {
+		a.dummy.verify(password)
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// AuthenticateToken checks a bearer token against the configured SHA-256 token hashes.
+func (a *Authenticator) AuthenticateToken(token string) (*Credential, error) {
+	sum := sha256.Sum256([]byte(token))
+
+	for i := range a.credentials {
+		credential := &a.credentials[i]
+		if len(credential.TokenHash) == 0 {
+			continue
+		}
+
+		expected, err := hex.DecodeString(credential.TokenHash)
+		if err != nil {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare(sum[:], expected) == 1 {
+			return credential, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Middleware authenticates requests via bearer token, HTTP Basic auth or the username, password and token query
+// parameters (matching the FritzBox <username> and <pass> placeholders). Rejected requests are answered by
+// unauthorized, authenticated ones carry their credential in the context, see FromContext.
+func (a *Authenticator) Middleware(unauthorized echo.HandlerFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.Enabled() {
+				return next(c)
+			}
+
+			credential, err := a.authenticateRequest(c)
+			if err != nil {
+				zerolog.Ctx(c.Request().Context()).Warn().Ctx(c.Request().Context()).Err(err).Str("client", c.RealIP()).Str("path", c.Path()).Msg("authentication failed")
+				return unauthorized(c)
+			}
+
+			zerolog.Ctx(c.Request().Context()).Debug().Ctx(c.Request().Context()).Str("credential", credential.Name).Msg("request authenticated")
+			c.Set(contextKey, credential)
+
+			return next(c)
+		}
+	}
+}
+
+func (a *Authenticator) authenticateRequest(c echo.Context) (*Credential, error) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return a.AuthenticateToken(token)
+	}
+
+	if username, password, ok := c.Request().BasicAuth(); ok {
+		return a.Authenticate(username, password)
+	}
+
+	if token := c.QueryParam("token"); len(token) > 0 {
+		return a.AuthenticateToken(token)
+	}
+
+	if username := c.QueryParam("username"); len(username) > 0 {
+		return a.Authenticate(username, c.QueryParam("password"))
+	}
+
+	return nil, ErrMissingCredentials
+}
+
+// FromContext returns the credential a request was authenticated with, nil if authentication is disabled.
+func FromContext(c echo.Context) *Credential {
+	credential, _ := c.Get(contextKey).(*Credential)
+	return credential
+}
+
+// RedactURI replaces the values of secret query parameters in a request URI.
+func RedactURI(uri string) string {
+	path, query, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return path + "?REDACTED"
+	}
+
+	redacted := false
+	for _, param := range sensitiveParams {
+		if values.Has(param) {
+			values.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return uri
+	}
+
+	return path + "?" + values.Encode()
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hash)
+}
+
+func argon2idHash(password string) string {
+	salt := []byte("somesaltsomesalt")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, 32)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	a, err := NewAuthenticator([]Credential{
+		{Username: "fritzbox", PasswordHash: bcryptHash(t, "secret")},
+		{Name: "office", Username: "office", PasswordHash: argon2idHash("hunter2")},
+		{Name: "ci", TokenHash: tokenHash("sometoken")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a
+}
+
+func TestAuthenticateBcrypt(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	credential, err := a.Authenticate("fritzbox", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "fritzbox", credential.Name)
+
+	_, err = a.Authenticate("fritzbox", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestAuthenticateArgon2id(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	credential, err := a.Authenticate("office", "hunter2")
+	assert.Nil(t, err)
+	assert.Equal(t, "office", credential.Name)
+
+	_, err = a.Authenticate("office", "hunter3")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = a.Authenticate("unknown", "hunter2")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+type countingVerifier struct {
+	calls int
+}
+
+func (c *countingVerifier) verify(string) bool {
+	c.calls++
+	return false
+}
+
+func TestAuthenticateUnknownUsernameVerifiesDummy(t *testing.T) {
+	a := newTestAuthenticator(t)
+	if assert.NotNil(t, a.dummy) {
+		assert.False(t, a.dummy.verify("secret"))
+	}
+
+	dummy := &countingVerifier{}
+	a.dummy = dummy
+
+	_, err := a.Authenticate("fritzbox", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, 0, dummy.calls)
+
+	_, err = a.Authenticate("unknown", "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Equal(t, 1, dummy.calls)
+}
+
+func TestNewDummyVerifier(t *testing.T) {
+	for _, hash := range []string{bcryptHash(t, "secret"), argon2idHash("secret")} {
+		dummy, err := newDummyVerifier(hash)
+		assert.NoError(t, err)
+		assert.False(t, dummy.verify("secret"))
+	}
+
+	_, err := newDummyVerifier("plain")
+	assert.ErrorIs(t, err, ErrInvalidPasswordHash)
+}
+
+func TestParseArgon2idInvalidParameters(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString([]byte("saltsalt"))
+	key := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	for _, hash := range []string{
+		fmt.Sprintf("$argon2id$v=%d$m=1024,t=0,p=1$%s$%s", argon2.Version, salt, key),
+		fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=0$%s$%s", argon2.Version, salt, key),
+		fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$$%s", argon2.Version, key),
+		fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$", argon2.Version, salt),
+	} {
+		_, err := NewAuthenticator([]Credential{{Username: "foo", PasswordHash: hash}})
+		assert.ErrorIs(t, err, ErrInvalidPasswordHash, hash)
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	credential, err := a.AuthenticateToken("sometoken")
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", credential.Name)
+
+	_, err = a.AuthenticateToken("othertoken")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestNewAuthenticatorInvalidConfig(t *testing.T) {
+	_, err := NewAuthenticator([]Credential{{Username: "foo"}})
+	assert.ErrorIs(t, err, ErrMissingSecret)
+
+	_, err = NewAuthenticator([]Credential{{Username: "foo", PasswordHash: "plaintext"}})
+	assert.ErrorIs(t, err, ErrInvalidPasswordHash)
+
+	_, err = NewAuthenticator([]Credential{{Username: "foo", PasswordHash: "$argon2id$v=19$m=1,t=1$foo$bar"}})
+	assert.ErrorIs(t, err, ErrInvalidPasswordHash)
+
+	_, err = NewAuthenticator([]Credential{{Name: "foo", PasswordHash: bcryptHash(t, "secret")}})
+	assert.ErrorIs(t, err, ErrMissingUsername)
+
+	_, err = NewAuthenticator([]Credential{{TokenHash: tokenHash("foo")}})
+	assert.ErrorIs(t, err, ErrMissingName)
+
+	_, err = NewAuthenticator([]Credential{{Name: "foo", TokenHash: "foo"}})
+	assert.ErrorIs(t, err, ErrInvalidTokenHash)
+}
+
+func TestLoadAuthenticator(t *testing.T) {
+	viper.Set("auth.credentials", []map[string]any{{"username": "fritzbox", "passwordHash": bcryptHash(t, "secret")}})
+	defer viper.Set("auth.credentials", nil)
+
+	a, err := LoadAuthenticator()
+	assert.Nil(t, err)
+	assert.True(t, a.Enabled())
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newTestAuthenticator(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		prepare    func(r *http.Request)
+		credential string
+	}{
+		{"no credentials", "/api/update", func(r *http.Request) {}, ""},
+		{"basic auth", "/api/update", func(r *http.Request) { r.SetBasicAuth("fritzbox", "secret") }, "fritzbox"},
+		{"basic auth wrong password", "/api/update", func(r *http.Request) { r.SetBasicAuth("fritzbox", "foo") }, ""},
+		{"query", "/api/update?username=office&password=hunter2", func(r *http.Request) {}, "office"},
+		{"query wrong password", "/api/update?username=office&password=foo", func(r *http.Request) {}, ""},
+		{"bearer", "/api/update", func(r *http.Request) { r.Header.Set("Authorization", "Bearer sometoken") }, "ci"},
+		{"query token", "/api/update?token=sometoken", func(r *http.Request) {}, "ci"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			tt.prepare(req)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			var authenticated *Credential
+			handler := a.Middleware(func(c echo.Context) error {
+				return c.NoContent(http.StatusUnauthorized)
+			})(func(c echo.Context) error {
+				authenticated = FromContext(c)
+				return c.NoContent(http.StatusOK)
+			})
+
+			assert.NoError(t, handler(c))
+
+			if tt.credential == "" {
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+				assert.Nil(t, authenticated)
+			} else {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, tt.credential, authenticated.Name)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	a, _ := NewAuthenticator(nil)
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/update", nil), rec)
+
+	handler := a.Middleware(func(c echo.Context) error {
+		return c.NoContent(http.StatusUnauthorized)
+	})(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	assert.NoError(t, handler(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, a.Enabled())
+}
+
+func TestRedactURI(t *testing.T) {
+	assert.Equal(t, "/api/status", RedactURI("/api/status"))
+	assert.Equal(t, "/api/update?domain=foo.com", RedactURI("/api/update?domain=foo.com"))
+	assert.Equal(t, "/api/update?domain=foo.com&password=REDACTED&username=fritzbox",
+		RedactURI("/api/update?domain=foo.com&username=fritzbox&password=secret"))
+	assert.Equal(t, "/api/update?token=REDACTED", RedactURI("/api/update?token=secret"))
+	assert.Equal(t, "/api/update?REDACTED", RedactURI("/api/update?password=%zz"))
+	assert.Equal(t, "/api/update?pass=foo", RedactURI("/api/update?pass=foo"))
+}
@@ -0,0 +1,15 @@
+package auth
+
+import "errors"
+
+var (
+	ErrMissingCredentials  = errors.New("missing credentials")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrMissingName         = errors.New("credential needs a name or username")
+	ErrMissingUsername     = errors.New("credential with password hash needs a username")
+	ErrMissingSecret       = errors.New("credential needs a password hash or token hash")
+	ErrInvalidPasswordHash = errors.New("invalid password hash, must be bcrypt or argon2id")
+	ErrInvalidTokenHash    = errors.New("invalid token hash, must be hex encoded SHA-256")
+	ErrUnknownCredential   = errors.New("policy refers to unknown credential")
+	ErrInvalidPattern      = errors.New("invalid pattern in policy")
+)
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+type verifier interface {
+	verify(password string) bool
+}
+
+// newVerifier returns a verifier for a bcrypt hash or an argon2id hash in PHC string format.
+func newVerifier(hash string) (verifier, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, ErrInvalidPasswordHash
+		}
+		return bcryptVerifier(hash), nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return parseArgon2id(hash)
+	default:
+		return nil, ErrInvalidPasswordHash
+	}
+}
+
+// newDummyVerifier returns a verifier for a random password, hashed with the same algorithm and cost as hash. Verifying
+// against it takes as long as verifying against hash, without ever succeeding.
+func newDummyVerifier(hash string) (verifier, error) {
+	v, err := newVerifier(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 32)
+	_, _ = rand.Read(random)
+
+	switch v := v.(type) {
+	case bcryptVerifier:
+		cost, _ := bcrypt.Cost([]byte(v))
+		dummy, err := bcrypt.GenerateFromPassword(random[:16], cost)
+		if err != nil {
+			return nil, err
+		}
+		return bcryptVerifier(dummy), nil
+	case *argon2idVerifier:
+		return &argon2idVerifier{memory: v.memory, time: v.time, threads: v.threads, salt: random[:16],
+			key: random[16 : 16+min(len(v.key), 16)]}, nil
+	default:
+		return v, nil
+	}
+}
+
+type bcryptVerifier string
+
+func (b bcryptVerifier) verify(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(b), []byte(password)) == nil
+}
+
+type argon2idVerifier struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id parses hashes like $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key> with unpadded base64 salt and key.
+func parseArgon2id(hash string) (*argon2idVerifier, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	v := &argon2idVerifier{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &v.memory, &v.time, &v.threads); err != nil {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	// argon2 panics on these, fail when loading the config rather than on every login
+	if v.time < 1 || v.threads < 1 {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	var err error
+	if v.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(v.salt) == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	if v.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(v.key) == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	return v, nil
+}
+
+func (a *argon2idVerifier) verify(password string) bool {
+	key := argon2.IDKey([]byte(password), a.salt, a.time, a.memory, a.threads, uint32(len(a.key)))
+	return subtle.ConstantTimeCompare(key, a.key) == 1
+}
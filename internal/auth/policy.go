@@ -0,0 +1,44 @@
+package auth
+
+import "github.com/davidramiro/frigabun/internal/match"
+
+// Policy limits what a credential may update. Empty lists allow any value, patterns are globs as understood by
+// path.Match. The apex of a domain is matched by the subdomain pattern "@".
+type Policy struct {
+	Credential string   `mapstructure:"credential"`
+	Registrars []string `mapstructure:"registrars"`
+	Domains    []string `mapstructure:"domains"`
+	Subdomains []string `mapstructure:"subdomains"`
+}
+
+// Allows reports whether the credential may update the record. Credentials without policies are unrestricted,
+// otherwise at least one of their policies has to match.
+func (c *Credential) Allows(registrar string, domain string, subdomain string) bool {
+	if len(c.policies) == 0 {
+		return true
+	}
+
+	for _, policy := range c.policies {
+		if policy.allows(registrar, domain, subdomain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Policy) allows(registrar string, domain string, subdomain string) bool {
+	if len(subdomain) == 0 {
+		subdomain = "@"
+	}
+
+	return match.Any(p.Registrars, registrar) && match.Any(p.Domains, domain) && match.Any(p.Subdomains, subdomain)
+}
+
+func validatePolicy(policy Policy) error {
+	if !match.Valid(policy.Registrars, policy.Domains, policy.Subdomains) {
+		return ErrInvalidPattern
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCredentialAllowsWithoutPolicies(t *testing.T) {
+	credential := &Credential{Name: "fritzbox"}
+	assert.True(t, credential.Allows("cloudflare", "foo.com", ""))
+}
+
+func TestCredentialAllows(t *testing.T) {
+	a, err := NewAuthenticator([]Credential{{Name: "office", TokenHash: tokenHash("office")}},
+		Policy{Credential: "office", Registrars: []string{"cloudflare"}, Domains: []string{"foo.com"}, Subdomains: []string{"office", "*.lab"}},
+		Policy{Credential: "office", Registrars: []string{"gandi"}, Domains: []string{"*.org"}, Subdomains: []string{"@"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, _ := a.AuthenticateToken("office")
+
+	assert.True(t, credential.Allows("cloudflare", "foo.com", "office"))
+	assert.True(t, credential.Allows("cloudflare", "FOO.com", "Office"))
+	assert.True(t, credential.Allows("cloudflare", "foo.com", "nas.lab"))
+	assert.True(t, credential.Allows("gandi", "bar.org", ""))
+	assert.False(t, credential.Allows("cloudflare", "foo.com", ""))
+	assert.False(t, credential.Allows("cloudflare", "foo.com", "mail"))
+	assert.False(t, credential.Allows("porkbun", "foo.com", "office"))
+	assert.False(t, credential.Allows("cloudflare", "bar.com", "office"))
+	assert.False(t, credential.Allows("gandi", "bar.org", "www"))
+}
+
+func TestPolicyEmptyListsAllowAny(t *testing.T) {
+	policy := Policy{Domains: []string{"foo.com"}}
+
+	assert.True(t, policy.allows("porkbun", "foo.com", "anything"))
+	assert.False(t, policy.allows("porkbun", "bar.com", "anything"))
+}
+
+func TestNewAuthenticatorInvalidPolicy(t *testing.T) {
+	credentials := []Credential{{Name: "office", TokenHash: tokenHash("office")}}
+
+	_, err := NewAuthenticator(credentials, Policy{Credential: "home"})
+	assert.ErrorIs(t, err, ErrUnknownCredential)
+
+	_, err = NewAuthenticator(credentials, Policy{Credential: "office", Subdomains: []string{"[office"}})
+	assert.ErrorIs(t, err, ErrInvalidPattern)
+}
+
+func TestLoadAuthenticatorWithPolicies(t *testing.T) {
+	viper.Set("auth.credentials", []map[string]any{{"name": "office", "tokenHash": tokenHash("office")}})
+	viper.Set("auth.policies", []map[string]any{{"credential": "office", "subdomains": []string{"office"}}})
+	defer viper.Set("auth.credentials", nil)
+	defer viper.Set("auth.policies", nil)
+
+	a, err := LoadAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, _ := a.AuthenticateToken("office")
+	assert.True(t, credential.Allows("cloudflare", "foo.com", "office"))
+	assert.False(t, credential.Allows("cloudflare", "foo.com", "mail"))
+}
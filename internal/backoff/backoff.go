@@ -0,0 +1,18 @@
+// Package backoff implements the exponentially growing delays between retries of registrar requests and webhooks.
+package backoff
+
+import "time"
+
+// Limit returns minDelay doubled for every attempt after the first, capped at maxDelay.
+func Limit(minDelay time.Duration, maxDelay time.Duration, attempt int) time.Duration {
+	limit := min(minDelay, maxDelay)
+	for i := 1; i < attempt && limit < maxDelay; i++ {
+		// doubling beyond maxDelay could overflow
+		if limit > maxDelay/2 {
+			return maxDelay
+		}
+		limit *= 2
+	}
+
+	return limit
+}
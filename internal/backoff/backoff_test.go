@@ -0,0 +1,25 @@
+package backoff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLimit(t *testing.T) {
+	assert.Equal(t, time.Second, Limit(time.Second, 10*time.Second, 1))
+	assert.Equal(t, 2*time.Second, Limit(time.Second, 10*time.Second, 2))
+	assert.Equal(t, 8*time.Second, Limit(time.Second, 10*time.Second, 4))
+	assert.Equal(t, 10*time.Second, Limit(time.Second, 10*time.Second, 5))
+	assert.Equal(t, time.Second, Limit(5*time.Second, time.Second, 1), "minDelay is capped as well")
+}
+
+func TestLimitDoesNotOverflow(t *testing.T) {
+	for _, attempt := range []int{63, 64, 100, 1000, math.MaxInt32} {
+		assert.Equal(t, time.Hour, Limit(time.Second, time.Hour, attempt), "attempt %d", attempt)
+	}
+
+	odd := time.Duration(math.MaxInt64)
+	assert.Equal(t, odd, Limit(time.Nanosecond, odd, 100))
+}
@@ -0,0 +1,216 @@
+package detect
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestHTTPDetector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.7\n"))
+	}))
+	defer server.Close()
+
+	d, err := NewHTTPDetector(server.URL, time.Second)
+	assert.NoError(t, err)
+
+	addr, err := d.Detect(context.Background(), IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+}
+
+func TestHTTPDetector_InvalidAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>not an address</html>"))
+	}))
+	defer server.Close()
+
+	d, err := NewHTTPDetector(server.URL, time.Second)
+	assert.NoError(t, err)
+
+	_, err = d.Detect(context.Background(), IPv4)
+	assert.ErrorIs(t, err, ErrInvalidAnswer)
+}
+
+func TestNewDetector_Invalid(t *testing.T) {
+	_, err := NewDetector(DetectorConfig{Type: "carrier-pigeon"}, time.Second)
+	assert.ErrorIs(t, err, ErrUnknownDetectorType)
+
+	_, err = NewDetector(DetectorConfig{Type: "http", URL: "ftp://example.com"}, time.Second)
+	assert.ErrorIs(t, err, ErrInvalidDetectorConfig)
+
+	_, err = NewDetector(DetectorConfig{Type: "dns", Server: "208.67.222.222"}, time.Second)
+	assert.ErrorIs(t, err, ErrInvalidDetectorConfig)
+
+	d, err := NewDetector(DetectorConfig{Type: "stun", Name: "google", Server: "stun.l.google.com:19302"}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "google", d.Name())
+}
+
+func TestSTUNDetector(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil || n < stunHeaderLength {
+			return
+		}
+
+		_, _ = conn.WriteTo(stunResponse(buf[8:20], netip.MustParseAddr("203.0.113.7")), from)
+	}()
+
+	d, err := NewSTUNDetector(conn.LocalAddr().String())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	addr, err := d.Detect(ctx, IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+}
+
+func TestParseSTUNResponse_IPv6(t *testing.T) {
+	addr, err := parseSTUNResponse(stunResponse(make([]byte, 12), netip.MustParseAddr("2001:db8::7")))
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::7"), addr)
+
+	_, err = parseSTUNResponse([]byte{0x01, 0x01})
+	assert.ErrorIs(t, err, ErrInvalidAnswer)
+}
+
+// stunResponse builds a binding response carrying addr as XOR-MAPPED-ADDRESS.
+func stunResponse(transactionID []byte, addr netip.Addr) []byte {
+	ip := addr.AsSlice()
+	family := byte(0x01)
+	if addr.Is6() {
+		family = 0x02
+	}
+
+	msg := make([]byte, stunHeaderLength+8+len(ip))
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingResponse)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(8+len(ip)))
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], transactionID)
+
+	binary.BigEndian.PutUint16(msg[20:22], stunXorMappedAddress)
+	binary.BigEndian.PutUint16(msg[22:24], uint16(4+len(ip)))
+	msg[25] = family
+	for i := range ip {
+		msg[28+i] = ip[i] ^ msg[4+i]
+	}
+
+	return msg
+}
+
+type fakeDetector struct {
+	name string
+	addr netip.Addr
+	err  error
+}
+
+func (f fakeDetector) Name() string {
+	return f.name
+}
+
+func (f fakeDetector) Detect(context.Context, Family) (netip.Addr, error) {
+	return f.addr, f.err
+}
+
+type fakePublisher struct {
+	published []netip.Addr
+	status    updater.Status
+}
+
+func (f *fakePublisher) Publish(_ context.Context, source string, addresses ...netip.Addr) []updater.Result {
+	f.published = append(f.published, addresses...)
+	return []updater.Result{{Status: f.status}}
+}
+
+func TestMonitor_Agreement(t *testing.T) {
+	addr := netip.MustParseAddr("203.0.113.7")
+	publisher := &fakePublisher{status: updater.StatusUpdated}
+
+	m, err := NewMonitor(publisher, []Detector{
+		fakeDetector{name: "upnp", addr: addr},
+		fakeDetector{name: "http", addr: netip.MustParseAddr("198.51.100.1")},
+		fakeDetector{name: "dns", err: errors.New("unreachable")},
+		fakeDetector{name: "stun", addr: addr},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, m.Addresses())
+
+	m.Check(context.Background())
+	m.Check(context.Background())
+
+	// unchanged addresses are published only once
+	assert.Equal(t, []netip.Addr{addr}, publisher.published)
+
+	if addresses := m.Addresses(); assert.Len(t, addresses, 1) {
+		assert.Equal(t, IPv4, addresses[0].Family)
+		assert.Equal(t, addr, addresses[0].IP)
+		assert.Equal(t, []string{"upnp", "stun"}, addresses[0].Sources)
+	}
+}
+
+func TestMonitor_NoAgreement(t *testing.T) {
+	publisher := &fakePublisher{status: updater.StatusUpdated}
+
+	m, err := NewMonitor(publisher, []Detector{
+		fakeDetector{addr: netip.MustParseAddr("203.0.113.7")},
+		fakeDetector{addr: netip.MustParseAddr("198.51.100.1")},
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Detect(context.Background(), IPv4)
+	assert.ErrorIs(t, err, ErrNoAgreement)
+
+	m.Check(context.Background())
+	assert.Empty(t, publisher.published)
+}
+
+func TestMonitor_RejectsPrivateAddresses(t *testing.T) {
+	m, err := NewMonitor(&fakePublisher{}, []Detector{
+		fakeDetector{addr: netip.MustParseAddr("192.168.178.2")},
+		fakeDetector{addr: netip.MustParseAddr("2001:db8::1")},
+	}, WithAgreement(1))
+	assert.NoError(t, err)
+
+	_, err = m.Detect(context.Background(), IPv4)
+	assert.ErrorIs(t, err, ErrNoAgreement)
+}
+
+func TestMonitor_RetriesFailedUpdates(t *testing.T) {
+	addr := netip.MustParseAddr("203.0.113.7")
+	publisher := &fakePublisher{status: updater.StatusFailed}
+
+	m, err := NewMonitor(publisher, []Detector{fakeDetector{addr: addr}})
+	assert.NoError(t, err)
+
+	m.Check(context.Background())
+	m.Check(context.Background())
+
+	assert.Equal(t, []netip.Addr{addr, addr}, publisher.published)
+}
+
+func TestNewMonitor_InvalidAgreement(t *testing.T) {
+	_, err := NewMonitor(&fakePublisher{}, []Detector{fakeDetector{}}, WithAgreement(2))
+	assert.ErrorIs(t, err, ErrInvalidAgreement)
+
+	_, err = NewMonitor(&fakePublisher{}, nil)
+	assert.ErrorIs(t, err, ErrNoDetectors)
+}
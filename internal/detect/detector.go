@@ -0,0 +1,86 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// Family is the address family to detect the public address of.
+type Family string
+
+const (
+	IPv4 Family = "ipv4"
+	IPv6 Family = "ipv6"
+)
+
+// network returns the network with the suffix restricting it to the family, e.g. tcp4 for tcp.
+func (f Family) network(network string) string {
+	if f == IPv6 {
+		return network + "6"
+	}
+
+	return network + "4"
+}
+
+// matches reports whether addr belongs to the family.
+func (f Family) matches(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return (f == IPv4 && addr.Is4()) || (f == IPv6 && addr.Is6())
+}
+
+// Detector discovers the public address of this host as seen by a remote service.
+type Detector interface {
+	Name() string
+	Detect(ctx context.Context, family Family) (netip.Addr, error)
+}
+
+// DetectorConfig configures a detector. Which fields are used depends on the type:
+//   - http: url of a service answering with the address of the client as plain text
+//   - dns: server to query for name, returning the client address as A/AAAA or, with type TXT, as TXT record
+//   - stun: server answering STUN binding requests
+//   - upnp: optional url of the device description of a gateway, discovered via SSDP otherwise
+type DetectorConfig struct {
+	Name       string `mapstructure:"name"`
+	Type       string `mapstructure:"type"`
+	URL        string `mapstructure:"url"`
+	Server     string `mapstructure:"server"`
+	Query      string `mapstructure:"query"`
+	RecordType string `mapstructure:"recordType"`
+}
+
+// NewDetector creates the detector of the configured type.
+func NewDetector(config DetectorConfig, timeout time.Duration) (Detector, error) {
+	var detector Detector
+	var err error
+
+	switch config.Type {
+	case "http":
+		detector, err = NewHTTPDetector(config.URL, timeout)
+	case "dns":
+		detector, err = NewDNSDetector(config.Server, config.Query, config.RecordType)
+	case "stun":
+		detector, err = NewSTUNDetector(config.Server)
+	case "upnp":
+		detector, err = NewUPnPDetector(config.URL, timeout)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDetectorType, config.Type)
+	}
+
+	if err != nil || len(config.Name) == 0 {
+		return detector, err
+	}
+
+	return named{Detector: detector, name: config.Name}, nil
+}
+
+type named struct {
+	Detector
+	name string
+}
+
+func (n named) Name() string {
+	return n.name
+}
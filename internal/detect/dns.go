@@ -0,0 +1,84 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// DNSDetector queries a resolver that answers with the address of the client, such as myip.opendns.com on the
+// OpenDNS resolvers or the TXT record o-o.myaddr.l.google.com on ns1.google.com.
+type DNSDetector struct {
+	server     string
+	query      string
+	recordType string
+}
+
+func NewDNSDetector(server string, query string, recordType string) (*DNSDetector, error) {
+	if len(server) == 0 || len(query) == 0 {
+		return nil, ErrInvalidDetectorConfig
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	recordType = strings.ToUpper(recordType)
+	if recordType != "" && recordType != "TXT" {
+		return nil, ErrInvalidDetectorConfig
+	}
+
+	return &DNSDetector{server: server, query: query, recordType: recordType}, nil
+}
+
+func (d *DNSDetector) Name() string {
+	return "dns " + d.query + "@" + d.server
+}
+
+func (d *DNSDetector) Detect(ctx context.Context, family Family) (netip.Addr, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		// every query goes to the configured server, over the family to detect
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, family.network(strings.TrimRight(network, "46")), d.server)
+		},
+	}
+
+	if d.recordType == "TXT" {
+		return d.detectTXT(ctx, resolver)
+	}
+
+	ipNetwork := "ip4"
+	if family == IPv6 {
+		ipNetwork = "ip6"
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, ipNetwork, d.query)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if len(addrs) == 0 {
+		return netip.Addr{}, ErrInvalidAnswer
+	}
+
+	return addrs[0].Unmap(), nil
+}
+
+func (d *DNSDetector) detectTXT(ctx context.Context, resolver *net.Resolver) (netip.Addr, error) {
+	records, err := resolver.LookupTXT(ctx, d.query)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	for _, record := range records {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(record)); err == nil {
+			return addr.Unmap(), nil
+		}
+	}
+
+	return netip.Addr{}, fmt.Errorf("%w: no address in TXT records", ErrInvalidAnswer)
+}
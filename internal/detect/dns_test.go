@@ -0,0 +1,153 @@
+package detect
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+const (
+	dnsTypeA   = 1
+	dnsTypeTXT = 16
+)
+
+// stubResolver answers every query with the records of its type in answers, given as rdata, and returns its address.
+func stubResolver(t *testing.T, answers map[uint16][][]byte) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if response, ok := dnsResponse(buf[:n], answers); ok {
+				_, _ = conn.WriteTo(response, from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// dnsResponse builds the answer to a query with a single question, copying its id and question section.
+func dnsResponse(query []byte, answers map[uint16][][]byte) ([]byte, bool) {
+	if len(query) < 12 {
+		return nil, false
+	}
+
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	if end > len(query) {
+		return nil, false
+	}
+
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+	records := answers[qtype]
+
+	response := make([]byte, 12, 512)
+	copy(response, query[:2])
+	binary.BigEndian.PutUint16(response[2:], 0x8180)
+	binary.BigEndian.PutUint16(response[4:], 1)
+	binary.BigEndian.PutUint16(response[6:], uint16(len(records)))
+	response = append(response, query[12:end]...)
+
+	for _, rdata := range records {
+		// the name points to the question
+		response = binary.BigEndian.AppendUint16(response, 0xc00c)
+		response = binary.BigEndian.AppendUint16(response, qtype)
+		response = binary.BigEndian.AppendUint16(response, 1)
+		response = binary.BigEndian.AppendUint32(response, 60)
+		response = binary.BigEndian.AppendUint16(response, uint16(len(rdata)))
+		response = append(response, rdata...)
+	}
+
+	return response, true
+}
+
+func txt(value string) []byte {
+	return append([]byte{byte(len(value))}, value...)
+}
+
+func TestNewDNSDetector(t *testing.T) {
+	d, err := NewDNSDetector("208.67.222.222", "myip.opendns.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "dns myip.opendns.com@208.67.222.222:53", d.Name())
+
+	d, err = NewDNSDetector("ns1.google.com:5353", "o-o.myaddr.l.google.com", "txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "dns o-o.myaddr.l.google.com@ns1.google.com:5353", d.Name())
+
+	_, err = NewDNSDetector("", "myip.opendns.com", "")
+	assert.ErrorIs(t, err, ErrInvalidDetectorConfig)
+
+	_, err = NewDNSDetector("208.67.222.222", "myip.opendns.com", "MX")
+	assert.ErrorIs(t, err, ErrInvalidDetectorConfig)
+}
+
+func TestDNSDetector(t *testing.T) {
+	server := stubResolver(t, map[uint16][][]byte{dnsTypeA: {{203, 0, 113, 7}}})
+
+	d, err := NewDNSDetector(server, "myip.example.com", "")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	addr, err := d.Detect(ctx, IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+}
+
+func TestDNSDetector_NoAnswer(t *testing.T) {
+	server := stubResolver(t, nil)
+
+	d, err := NewDNSDetector(server, "myip.example.com", "")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = d.Detect(ctx, IPv4)
+	assert.Error(t, err)
+}
+
+func TestDNSDetector_TXT(t *testing.T) {
+	server := stubResolver(t, map[uint16][][]byte{dnsTypeTXT: {txt("edns0-client-subnet 198.51.100.0/24"), txt("203.0.113.7")}})
+
+	d, err := NewDNSDetector(server, "o-o.myaddr.example.com", "TXT")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	addr, err := d.Detect(ctx, IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+}
+
+func TestDNSDetector_TXTWithoutAddress(t *testing.T) {
+	server := stubResolver(t, map[uint16][][]byte{dnsTypeTXT: {txt("not an address")}})
+
+	d, err := NewDNSDetector(server, "o-o.myaddr.example.com", "TXT")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = d.Detect(ctx, IPv4)
+	assert.ErrorIs(t, err, ErrInvalidAnswer)
+}
@@ -0,0 +1,16 @@
+package detect
+
+import "errors"
+
+var (
+	ErrUnknownDetectorType   = errors.New("unknown detector type")
+	ErrInvalidDetectorConfig = errors.New("invalid detector config")
+	ErrInvalidAnswer         = errors.New("invalid answer from detector")
+	ErrNoDetectors           = errors.New("no detectors configured")
+	ErrNoFamilies            = errors.New("neither ipv4 nor ipv6 detection enabled")
+	ErrInvalidAgreement      = errors.New("agreement exceeds number of detectors")
+	ErrNoAgreement           = errors.New("detectors did not agree on an address")
+	ErrNotPublic             = errors.New("detected address is not public")
+	ErrUnsupportedFamily     = errors.New("address family not supported by detector")
+	ErrNoGateway             = errors.New("no upnp internet gateway found")
+)
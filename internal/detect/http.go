@@ -0,0 +1,76 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPDetector asks a web service echoing the address of the client, such as https://api64.ipify.org.
+type HTTPDetector struct {
+	url     string
+	clients map[Family]*http.Client
+}
+
+func NewHTTPDetector(rawURL string, timeout time.Duration) (*HTTPDetector, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, ErrInvalidDetectorConfig
+	}
+
+	d := &HTTPDetector{url: rawURL, clients: make(map[Family]*http.Client)}
+
+	// the connection is pinned to the family, so the service sees the address of that family
+	for _, family := range []Family{IPv4, IPv6} {
+		dialer := &net.Dialer{}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, family.network("tcp"), addr)
+		}
+
+		d.clients[family] = &http.Client{Transport: transport, Timeout: timeout}
+	}
+
+	return d, nil
+}
+
+func (d *HTTPDetector) Name() string {
+	return "http " + d.url
+}
+
+func (d *HTTPDetector) Detect(ctx context.Context, family Family) (netip.Addr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.url, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := d.clients[family].Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("%w: status %d", ErrInvalidAnswer, resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(b)))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %w", ErrInvalidAnswer, err)
+	}
+
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,56 @@
+package detect
+
+import (
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services/factory"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Load creates the monitor configured in the detect section, returning nil if detection is disabled.
+func Load(serviceFactory factory.ServiceFactory, u *updater.Updater) (*Monitor, error) {
+	if !viper.GetBool("detect.enabled") {
+		return nil, nil
+	}
+
+	r, err := records.New(serviceFactory, u, viper.GetStringSlice("detect.hostnames"))
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []DetectorConfig
+	if err := viper.UnmarshalKey("detect.detectors", &configs); err != nil {
+		return nil, err
+	}
+
+	timeout := viper.GetDuration("detect.timeout")
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	var detectors []Detector
+	for _, config := range configs {
+		detector, err := NewDetector(config, timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debug().Str("detector", detector.Name()).Msg("registered address detector")
+		detectors = append(detectors, detector)
+	}
+
+	var families []Family
+	if !viper.IsSet("detect.ipv4") || viper.GetBool("detect.ipv4") {
+		families = append(families, IPv4)
+	}
+	if viper.GetBool("detect.ipv6") {
+		families = append(families, IPv6)
+	}
+
+	return NewMonitor(r, detectors,
+		WithFamilies(families...),
+		WithAgreement(viper.GetInt("detect.agree")),
+		WithInterval(viper.GetDuration("detect.interval")),
+		WithTimeout(timeout))
+}
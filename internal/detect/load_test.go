@@ -0,0 +1,71 @@
+package detect
+
+import (
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// setupConfig enables detection for home.example.com with the given detectors.
+func setupConfig(t *testing.T, detectors ...map[string]any) *mockfactory.MockServiceFactory {
+	viper.Set("detect.enabled", true)
+	viper.Set("detect.hostnames", []string{"home.example.com"})
+	viper.Set("detect.detectors", detectors)
+	t.Cleanup(func() { viper.Set("detect", nil) })
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.example.com").Return("cloudflare", "example.com", nil)
+
+	return sf
+}
+
+func TestLoadDisabled(t *testing.T) {
+	m, err := Load(mockfactory.NewMockServiceFactory(t), updater.New())
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestLoad(t *testing.T) {
+	sf := setupConfig(t,
+		map[string]any{"type": "http", "url": "https://ifconfig.example.com"},
+		map[string]any{"type": "dns", "name": "opendns", "server": "208.67.222.222", "query": "myip.opendns.com"})
+	viper.Set("detect.ipv6", true)
+	viper.Set("detect.agree", 2)
+	viper.Set("detect.interval", "10m")
+
+	m, err := Load(sf, updater.New())
+	assert.NoError(t, err)
+	if assert.NotNil(t, m) {
+		if assert.Len(t, m.detectors, 2) {
+			assert.Equal(t, "opendns", m.detectors[1].Name())
+		}
+		assert.Equal(t, []Family{IPv4, IPv6}, m.families)
+		assert.Equal(t, 2, m.agree)
+		assert.Equal(t, 10*time.Minute, m.interval)
+		assert.Equal(t, defaultTimeout, m.timeout)
+	}
+}
+
+func TestLoadUnknownDetectorType(t *testing.T) {
+	sf := setupConfig(t, map[string]any{"type": "carrier-pigeon"})
+
+	_, err := Load(sf, updater.New())
+	assert.ErrorIs(t, err, ErrUnknownDetectorType)
+}
+
+func TestLoadInvalidDetectorConfig(t *testing.T) {
+	sf := setupConfig(t, map[string]any{"type": "dns", "server": "208.67.222.222", "recordType": "MX", "query": "myip.opendns.com"})
+
+	_, err := Load(sf, updater.New())
+	assert.ErrorIs(t, err, ErrInvalidDetectorConfig)
+}
+
+func TestLoadNoDetectors(t *testing.T) {
+	sf := setupConfig(t)
+
+	_, err := Load(sf, updater.New())
+	assert.ErrorIs(t, err, ErrNoDetectors)
+}
@@ -0,0 +1,263 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/rs/zerolog"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// Source is recorded as origin of the updates triggered by the monitor.
+	Source = "detect"
+
+	defaultInterval = 5 * time.Minute
+	defaultTimeout  = 10 * time.Second
+)
+
+// Publisher updates the records to a detected address, implemented by records.Records.
+type Publisher interface {
+	Publish(ctx context.Context, source string, addresses ...netip.Addr) []updater.Result
+}
+
+// Address is the last public address published by the monitor, reported by the status endpoint.
+type Address struct {
+	Family Family     `json:"family"`
+	IP     netip.Addr `json:"ip"`
+	// Sources names the detectors that reported the address.
+	Sources   []string  `json:"sources"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Monitor periodically asks all detectors for the public address and publishes it once it changed. An address is
+// only trusted if enough detectors agree on it, so a single misbehaving service can't redirect the records.
+type Monitor struct {
+	publisher Publisher
+	detectors []Detector
+	families  []Family
+	agree     int
+	interval  time.Duration
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	last map[Family]Address
+}
+
+type Option func(*Monitor)
+
+// WithFamilies sets the address families to detect, only IPv4 by default.
+func WithFamilies(families ...Family) Option {
+	return func(m *Monitor) {
+		m.families = families
+	}
+}
+
+// WithAgreement sets how many detectors have to report the same address, two by default or one if only a single
+// detector is configured.
+func WithAgreement(agree int) Option {
+	return func(m *Monitor) {
+		if agree > 0 {
+			m.agree = agree
+		}
+	}
+}
+
+// WithInterval sets the time between two detections, five minutes by default.
+func WithInterval(interval time.Duration) Option {
+	return func(m *Monitor) {
+		if interval > 0 {
+			m.interval = interval
+		}
+	}
+}
+
+// WithTimeout limits the time a detection may take, ten seconds by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(m *Monitor) {
+		if timeout > 0 {
+			m.timeout = timeout
+		}
+	}
+}
+
+func NewMonitor(publisher Publisher, detectors []Detector, opts ...Option) (*Monitor, error) {
+	if len(detectors) == 0 {
+		return nil, ErrNoDetectors
+	}
+
+	m := &Monitor{
+		publisher: publisher,
+		detectors: detectors,
+		families:  []Family{IPv4},
+		agree:     min(2, len(detectors)),
+		interval:  defaultInterval,
+		timeout:   defaultTimeout,
+		last:      make(map[Family]Address),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if len(m.families) == 0 {
+		return nil, ErrNoFamilies
+	}
+
+	if m.agree > len(detectors) {
+		return nil, ErrInvalidAgreement
+	}
+
+	return m, nil
+}
+
+// Run checks for changes right away and then every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check detects the address of every family and publishes those that changed since the last check.
+func (m *Monitor) Check(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("source", Source).Logger()
+
+	for _, family := range m.families {
+		addr, sources, err := m.detect(ctx, family)
+		if err != nil {
+			logger.Warn().Err(err).Str("family", string(family)).Msg("detecting public address failed")
+			continue
+		}
+
+		current := Address{Family: family, IP: addr, Sources: sources, CheckedAt: time.Now().UTC()}
+
+		m.mu.Lock()
+		changed := m.last[family].IP != addr
+		if !changed {
+			m.last[family] = current
+		}
+		m.mu.Unlock()
+
+		if !changed {
+			logger.Debug().Str("family", string(family)).Str("ip", addr.String()).Strs("sources", sources).
+				Msg("public address unchanged")
+			continue
+		}
+
+		logger.Info().Str("family", string(family)).Str("ip", addr.String()).Strs("sources", sources).
+			Msg("public address changed")
+
+		failed := false
+		for _, result := range m.publisher.Publish(ctx, Source, addr) {
+			failed = failed || result.Failed()
+		}
+
+		// failed records are retried with the next check
+		if !failed {
+			m.mu.Lock()
+			m.last[family] = current
+			m.mu.Unlock()
+		}
+	}
+}
+
+// Addresses returns the addresses published last, per family.
+func (m *Monitor) Addresses() []Address {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var addresses []Address
+	for _, family := range m.families {
+		if addr, ok := m.last[family]; ok {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	return addresses
+}
+
+// Detect asks all detectors concurrently and returns the address reported by most of them, if at least the
+// required number of detectors agree on it.
+func (m *Monitor) Detect(ctx context.Context, family Family) (netip.Addr, error) {
+	addr, _, err := m.detect(ctx, family)
+	return addr, err
+}
+
+// detect works like Detect, additionally returning the names of the detectors that reported the address.
+func (m *Monitor) detect(ctx context.Context, family Family) (netip.Addr, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	logger := zerolog.Ctx(ctx)
+	addrs := make([]netip.Addr, len(m.detectors))
+
+	var wg sync.WaitGroup
+	for i, detector := range m.detectors {
+		wg.Go(func() {
+			addr, err := detector.Detect(ctx, family)
+			if err == nil {
+				err = checkAddress(family, addr)
+			}
+
+			if err != nil {
+				logger.Debug().Err(err).Str("detector", detector.Name()).Str("family", string(family)).
+					Msg("detector failed")
+				return
+			}
+
+			addrs[i] = addr
+		})
+	}
+	wg.Wait()
+
+	votes := make(map[netip.Addr]int)
+	var best netip.Addr
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			continue
+		}
+
+		votes[addr]++
+		if votes[addr] > votes[best] {
+			best = addr
+		}
+	}
+
+	if votes[best] < m.agree {
+		return netip.Addr{}, nil, fmt.Errorf("%w: %d of %d required", ErrNoAgreement, votes[best], m.agree)
+	}
+
+	var sources []string
+	for i, addr := range addrs {
+		if addr == best {
+			sources = append(sources, m.detectors[i].Name())
+		}
+	}
+
+	return best, sources, nil
+}
+
+// checkAddress rejects addresses that can't be reached from the internet, e.g. when a detector is answered by a
+// service on the local network.
+func checkAddress(family Family, addr netip.Addr) error {
+	if !family.matches(addr) {
+		return fmt.Errorf("%w: %s is not %s", ErrInvalidAnswer, addr, family)
+	}
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrNotPublic, addr)
+	}
+
+	return nil
+}
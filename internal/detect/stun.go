@@ -0,0 +1,172 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderLength    = 20
+
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+
+	stunDefaultTimeout = 5 * time.Second
+)
+
+// STUNDetector sends a binding request (RFC 5389) to a STUN server, e.g. stun.l.google.com:19302, which answers
+// with the address and port it received the request from.
+type STUNDetector struct {
+	server string
+}
+
+func NewSTUNDetector(server string) (*STUNDetector, error) {
+	if len(server) == 0 {
+		return nil, ErrInvalidDetectorConfig
+	}
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "3478")
+	}
+
+	return &STUNDetector{server: server}, nil
+}
+
+func (d *STUNDetector) Name() string {
+	return "stun " + d.server
+}
+
+func (d *STUNDetector) Detect(ctx context.Context, family Family) (netip.Addr, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, family.network("udp"), d.server)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(stunDefaultTimeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return netip.Addr{}, err
+	}
+
+	request := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return netip.Addr{}, err
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return netip.Addr{}, err
+	}
+
+	response := make([]byte, 1500)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+
+		// answers to other transactions are stale responses to an earlier request
+		if n < stunHeaderLength || !bytes.Equal(response[8:20], request[8:20]) {
+			continue
+		}
+
+		return parseSTUNResponse(response[:n])
+	}
+}
+
+// parseSTUNResponse returns the address of a binding response, preferring XOR-MAPPED-ADDRESS over the
+// MAPPED-ADDRESS sent by servers implementing only RFC 3489.
+func parseSTUNResponse(msg []byte) (netip.Addr, error) {
+	if len(msg) < stunHeaderLength || binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse {
+		return netip.Addr{}, fmt.Errorf("%w: no stun binding response", ErrInvalidAnswer)
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if stunHeaderLength+length > len(msg) {
+		return netip.Addr{}, fmt.Errorf("%w: truncated stun message", ErrInvalidAnswer)
+	}
+
+	var mapped netip.Addr
+	attributes := msg[stunHeaderLength : stunHeaderLength+length]
+
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:2])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:4]))
+		if 4+attrLength > len(attributes) {
+			break
+		}
+
+		value := attributes[4 : 4+attrLength]
+
+		switch attrType {
+		case stunXorMappedAddress:
+			if addr, ok := parseSTUNAddress(value, msg[4:20]); ok {
+				return addr, nil
+			}
+		case stunMappedAddress:
+			if addr, ok := parseSTUNAddress(value, nil); ok {
+				mapped = addr
+			}
+		}
+
+		// attributes are padded to a multiple of four bytes
+		next := 4 + (attrLength+3)&^3
+		if next > len(attributes) {
+			break
+		}
+		attributes = attributes[next:]
+	}
+
+	if !mapped.IsValid() {
+		return netip.Addr{}, fmt.Errorf("%w: no mapped address in stun response", ErrInvalidAnswer)
+	}
+
+	return mapped, nil
+}
+
+// parseSTUNAddress decodes an address attribute, XORing it with the magic cookie and transaction ID if given.
+func parseSTUNAddress(value []byte, xor []byte) (netip.Addr, bool) {
+	if len(value) < 4 {
+		return netip.Addr{}, false
+	}
+
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = 4
+	case 0x02:
+		size = 16
+	default:
+		return netip.Addr{}, false
+	}
+
+	if len(value) < 4+size {
+		return netip.Addr{}, false
+	}
+
+	ip := bytes.Clone(value[4 : 4+size])
+	if xor != nil {
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+
+	return addr.Unmap(), ok
+}
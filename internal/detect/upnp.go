@@ -0,0 +1,306 @@
+package detect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/tr064"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ssdpAddress        = "239.255.255.250:1900"
+	ssdpDiscoverWindow = 2 * time.Second
+)
+
+// ssdpTargets are searched for gateways, version 2 devices answer to both searches.
+var ssdpTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+}
+
+// wanServices provide GetExternalIPAddress, depending on how the gateway is connected.
+var wanServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:",
+	"urn:schemas-upnp-org:service:WANPPPConnection:",
+}
+
+type gateway struct {
+	location   string
+	service    string
+	controlURL string
+	client     *tr064.Client
+}
+
+// UPnPDetector asks the UPnP Internet Gateway Devices of the local network for their external IPv4 address. Gateways
+// are discovered via SSDP unless the location of a device description is configured. With several gateways, e.g.
+// behind a double NAT, the first reporting a public address is used.
+type UPnPDetector struct {
+	location string
+	ssdp     string
+	http     *http.Client
+
+	mu       sync.Mutex
+	gateways []gateway
+}
+
+// NewUPnPDetector creates a detector for the device described at location, or discovering all gateways if empty.
+func NewUPnPDetector(location string, timeout time.Duration) (*UPnPDetector, error) {
+	if len(location) > 0 {
+		u, err := url.Parse(location)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return nil, ErrInvalidDetectorConfig
+		}
+	}
+
+	return &UPnPDetector{location: location, ssdp: ssdpAddress, http: &http.Client{Timeout: timeout}}, nil
+}
+
+func (d *UPnPDetector) Name() string {
+	if len(d.location) > 0 {
+		return "upnp " + d.location
+	}
+
+	return "upnp"
+}
+
+func (d *UPnPDetector) Detect(ctx context.Context, family Family) (netip.Addr, error) {
+	// IGD only reports the address of the IPv4 connection
+	if family != IPv4 {
+		return netip.Addr{}, ErrUnsupportedFamily
+	}
+
+	gateways, err := d.discover(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var errs []error
+	for _, gw := range gateways {
+		args, err := gw.client.Call(ctx, gw.service, gw.controlURL, "GetExternalIPAddress")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", gw.location, err))
+			continue
+		}
+
+		addr, err := netip.ParseAddr(args["NewExternalIPAddress"])
+		if err == nil {
+			err = checkAddress(IPv4, addr.Unmap())
+		}
+
+		// a gateway behind another NAT reports a private address, the next one may know better
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", gw.location, err))
+			continue
+		}
+
+		return addr.Unmap(), nil
+	}
+
+	// gateways may have changed their address or been disabled, discover them again next time
+	d.mu.Lock()
+	d.gateways = nil
+	d.mu.Unlock()
+
+	return netip.Addr{}, errors.Join(errs...)
+}
+
+// discover returns the known gateways, searching for them if there are none yet.
+func (d *UPnPDetector) discover(ctx context.Context) ([]gateway, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.gateways) > 0 {
+		return d.gateways, nil
+	}
+
+	locations := []string{d.location}
+	if len(d.location) == 0 {
+		var err error
+		if locations, err = searchGateways(ctx, d.ssdp); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, location := range locations {
+		gateways, err := d.describe(ctx, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", location, err))
+			continue
+		}
+
+		d.gateways = append(d.gateways, gateways...)
+	}
+
+	if len(d.gateways) == 0 {
+		return nil, errors.Join(append([]error{ErrNoGateway}, errs...)...)
+	}
+
+	return d.gateways, nil
+}
+
+// searchGateways sends an SSDP search for gateways to addr and collects the locations of their device descriptions
+// until the discovery window closes.
+func searchGateways(ctx context.Context, addr string) ([]string, error) {
+	target, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// leave half of the remaining time for querying the gateways found
+	window := ssdpDiscoverWindow
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		window = min(window, time.Until(ctxDeadline)/2)
+	}
+
+	deadline := time.Now().Add(window)
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, st := range ssdpTargets {
+		search := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddress + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 1\r\n" +
+			"ST: " + st + "\r\n\r\n"
+
+		if _, err := conn.WriteToUDP([]byte(search), target); err != nil {
+			return nil, err
+		}
+	}
+
+	var locations []string
+	seen := make(map[string]bool)
+	buf := make([]byte, 2048)
+
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// the window closing ends the search
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		location := resp.Header.Get("Location")
+		if len(location) > 0 && !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+
+	if len(locations) == 0 {
+		return nil, ErrNoGateway
+	}
+
+	return locations, nil
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// describe fetches the device description at location and returns a gateway per WAN connection service.
+func (d *UPnPDetector) describe(ctx context.Context, location string) ([]gateway, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrInvalidAnswer, resp.StatusCode)
+	}
+
+	var root upnpRoot
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&root); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAnswer, err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(root.URLBase) > 0 {
+		if base, err = url.Parse(root.URLBase); err != nil {
+			return nil, err
+		}
+	}
+
+	var gateways []gateway
+	walkServices(root.Device, func(serviceType string, controlURL string) {
+		control, err := base.Parse(controlURL)
+		if err != nil {
+			return
+		}
+
+		gateways = append(gateways, gateway{
+			location:   location,
+			service:    serviceType,
+			controlURL: control.RequestURI(),
+			client:     tr064.NewClient(control.Scheme+"://"+control.Host, "", ""),
+		})
+	})
+
+	if len(gateways) == 0 {
+		return nil, ErrNoGateway
+	}
+
+	return gateways, nil
+}
+
+// walkServices calls fn for every WAN connection service of the device and its embedded devices.
+func walkServices(device upnpDevice, fn func(serviceType string, controlURL string)) {
+	for _, service := range device.Services {
+		for _, prefix := range wanServices {
+			if strings.HasPrefix(service.ServiceType, prefix) {
+				fn(service.ServiceType, service.ControlURL)
+			}
+		}
+	}
+
+	for _, embedded := range device.Devices {
+		walkServices(embedded, fn)
+	}
+}
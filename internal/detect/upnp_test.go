@@ -0,0 +1,136 @@
+package detect
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newGateway serves the device description and WANIPConnection control of an IGD reporting addr, or a fault
+// like a gateway with UPnP disabled if addr is empty.
+func newGateway(t *testing.T, addr string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<?xml version="1.0"?><root xmlns="urn:schemas-upnp-org:device-1-0"><device>`+
+			`<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType><deviceList><device>`+
+			`<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType><deviceList><device>`+
+			`<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType><serviceList><service>`+
+			`<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>`+
+			`<controlURL>/ctl/IPConn</controlURL></service></serviceList>`+
+			`</device></deviceList></device></deviceList></device></root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress", r.Header.Get("SoapAction"))
+
+		if len(addr) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">`+
+				`<s:Body><s:Fault><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>606</errorCode>`+
+				`<errorDescription>Action not authorized</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">`+
+			`<s:Body><u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+			`<NewExternalIPAddress>%s</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`, addr)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// newSSDP answers M-SEARCH requests with a response per location.
+func newSSDP(t *testing.T, locations ...string) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if !strings.HasPrefix(string(buf[:n]), "M-SEARCH") {
+				continue
+			}
+
+			for _, location := range locations {
+				_, _ = conn.WriteTo([]byte("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\n"+
+					"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n"+
+					"LOCATION: "+location+"\r\n\r\n"), from)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestUPnPDetector_MultipleGateways(t *testing.T) {
+	// the gateway of the local network sits behind another NAT
+	inner := newGateway(t, "192.168.0.2")
+	defer inner.Close()
+	outer := newGateway(t, "203.0.113.7")
+	defer outer.Close()
+
+	d, err := NewUPnPDetector("", time.Second)
+	assert.NoError(t, err)
+	d.ssdp = newSSDP(t, inner.URL+"/rootDesc.xml", outer.URL+"/rootDesc.xml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	addr, err := d.Detect(ctx, IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+	assert.Len(t, d.gateways, 2)
+
+	_, err = d.Detect(context.Background(), IPv6)
+	assert.ErrorIs(t, err, ErrUnsupportedFamily)
+}
+
+func TestUPnPDetector_Location(t *testing.T) {
+	gw := newGateway(t, "203.0.113.7")
+	defer gw.Close()
+
+	d, err := NewUPnPDetector(gw.URL+"/rootDesc.xml", time.Second)
+	assert.NoError(t, err)
+
+	addr, err := d.Detect(context.Background(), IPv4)
+	assert.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), addr)
+}
+
+func TestUPnPDetector_Disabled(t *testing.T) {
+	gw := newGateway(t, "")
+	defer gw.Close()
+
+	d, err := NewUPnPDetector(gw.URL+"/rootDesc.xml", time.Second)
+	assert.NoError(t, err)
+
+	_, err = d.Detect(context.Background(), IPv4)
+	assert.ErrorContains(t, err, "606 Action not authorized")
+	assert.Empty(t, d.gateways)
+}
+
+func TestUPnPDetector_NoGateway(t *testing.T) {
+	d, err := NewUPnPDetector("", time.Second)
+	assert.NoError(t, err)
+	d.ssdp = newSSDP(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = d.Detect(ctx, IPv4)
+	assert.ErrorIs(t, err, ErrNoGateway)
+}
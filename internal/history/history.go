@@ -0,0 +1,304 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxEntries = 10000
+	defaultMaxAge     = 90 * 24 * time.Hour
+)
+
+// Entry is a single update attempt of a record.
+type Entry struct {
+	Time          time.Time           `json:"time"`
+	Client        string              `json:"client,omitempty"`
+	Credential    string              `json:"credential,omitempty"`
+	RequestID     string              `json:"request_id,omitempty"`
+	Source        string              `json:"source,omitempty"`
+	Registrar     services.Registrar  `json:"registrar"`
+	Domain        string              `json:"domain"`
+	FQDN          string              `json:"fqdn"`
+	Type          services.RecordType `json:"type"`
+	PreviousValue string              `json:"previous_value,omitempty"`
+	Value         string              `json:"value"`
+	Status        updater.Status      `json:"status"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// Subdomain returns the FQDN without the domain, empty for the domain itself.
+func (e Entry) Subdomain() string {
+	subdomain, _ := strings.CutSuffix(strings.ToLower(e.FQDN), "."+strings.ToLower(e.Domain))
+	if strings.EqualFold(subdomain, e.Domain) {
+		return ""
+	}
+
+	return subdomain
+}
+
+// Query filters the history. Zero values match every entry.
+type Query struct {
+	// Domain matches the domain of an entry or its FQDN.
+	Domain    string
+	Registrar services.Registrar
+	From      time.Time
+	To        time.Time
+	// Allow, if set, drops the entries it returns false for before the result is paginated.
+	Allow  func(Entry) bool
+	Offset int
+	Limit  int
+}
+
+// Store keeps the update history in memory, ordered by time. If a path is set, entries are appended to it as JSON
+// lines and restored on start.
+type Store struct {
+	path       string
+	maxEntries int
+	maxAge     time.Duration
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// LoadStore opens the history configured in the history section.
+func LoadStore() (*Store, error) {
+	return NewStore(viper.GetString("history.path"), viper.GetInt("history.maxEntries"),
+		viper.GetDuration("history.maxAge"))
+}
+
+// NewStore reads the history from path, if set, and applies the retention limits.
+func NewStore(path string, maxEntries int, maxAge time.Duration) (*Store, error) {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+
+	s := &Store{path: path, maxEntries: maxEntries, maxAge: maxAge}
+
+	if len(path) == 0 {
+		log.Info().Msg("no history path configured, keeping history in memory")
+		return s, nil
+	}
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	if s.prune() {
+		if err := s.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().Str("path", path).Int("entries", len(s.entries)).Msg("loaded history")
+
+	return s, nil
+}
+
+// Updated records the results of an update, implementing updater.Listener.
+func (s *Store) Updated(ctx context.Context, results []updater.Result) {
+	origin := updater.OriginFrom(ctx)
+	now := time.Now().UTC()
+
+	entries := make([]Entry, len(results))
+	for i, result := range results {
+		entries[i] = Entry{
+			Time:          now,
+			Client:        origin.Client,
+			Credential:    origin.Credential,
+			RequestID:     origin.RequestID,
+			Source:        origin.Source,
+			Registrar:     result.Registrar,
+			Domain:        result.Domain,
+			FQDN:          result.FQDN(),
+			Type:          result.Type,
+			PreviousValue: result.PreviousIP,
+			Value:         result.IP,
+			Status:        result.Status,
+			Error:         result.Error,
+		}
+	}
+
+	if err := s.Add(entries...); err != nil {
+		log.Error().Err(err).Str("path", s.path).Msg("cannot persist history")
+	}
+}
+
+// Add appends entries to the history, dropping the oldest ones exceeding the retention limits.
+func (s *Store) Add(entries ...Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entries...)
+
+	if len(s.path) == 0 {
+		s.prune()
+		return nil
+	}
+
+	// the file is only rewritten once a tenth of the limit is exceeded, appending otherwise
+	if len(s.entries) > s.maxEntries+s.maxEntries/10 || s.expired() {
+		s.prune()
+		return s.rewrite()
+	}
+
+	return s.append(entries)
+}
+
+// Query returns the entries matching q, newest first, and the total number of matching entries.
+func (s *Store) Query(q Query) ([]Entry, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []Entry
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if q.matches(s.entries[i]) {
+			matches = append(matches, s.entries[i])
+		}
+	}
+
+	total := len(matches)
+	if q.Offset >= total {
+		return []Entry{}, total
+	}
+
+	matches = matches[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matches) {
+		matches = matches[:q.Limit]
+	}
+
+	return matches, total
+}
+
+func (q Query) matches(e Entry) bool {
+	if len(q.Domain) > 0 && !strings.EqualFold(q.Domain, e.Domain) && !strings.EqualFold(q.Domain, e.FQDN) {
+		return false
+	}
+
+	if len(q.Registrar) > 0 && q.Registrar != e.Registrar {
+		return false
+	}
+
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !e.Time.Before(q.To) {
+		return false
+	}
+
+	return q.Allow == nil || q.Allow(e)
+}
+
+// prune drops entries exceeding the retention limits and reports whether any were dropped.
+func (s *Store) prune() bool {
+	cutoff := time.Now().Add(-s.maxAge)
+
+	drop := max(len(s.entries)-s.maxEntries, 0)
+	for drop < len(s.entries) && s.entries[drop].Time.Before(cutoff) {
+		drop++
+	}
+
+	if drop == 0 {
+		return false
+	}
+
+	s.entries = append([]Entry(nil), s.entries[drop:]...)
+
+	return true
+}
+
+func (s *Store) expired() bool {
+	return len(s.entries) > 0 && time.Since(s.entries[0].Time) > s.maxAge
+}
+
+// read loads the history file, skipping lines that can't be parsed, such as one cut off by a crash.
+func (s *Store) read() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warn().Err(err).Str("path", s.path).Msg("skipping invalid history entry")
+			continue
+		}
+
+		s.entries = append(s.entries, entry)
+	}
+
+	return scanner.Err()
+}
+
+func (s *Store) append(entries []Entry) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := encode(f, entries); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// rewrite replaces the history file with the retained entries via a temporary file in the same directory.
+func (s *Store) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := encode(tmp, s.entries); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func encode(f *os.File, entries []Entry) error {
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,181 @@
+package history
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func entry(fqdn string, domain string, registrar services.Registrar, at time.Time) Entry {
+	return Entry{Time: at, FQDN: fqdn, Domain: domain, Registrar: registrar, Type: services.RecordTypeA, Value: "10.0.0.1", Status: updater.StatusUpdated}
+}
+
+func TestQueryFilters(t *testing.T) {
+	store, _ := NewStore("", 0, 0)
+	now := time.Now()
+
+	assert.Nil(t, store.Add(
+		entry("bar.foo.com", "foo.com", "cloudflare", now.Add(-3*time.Hour)),
+		entry("foo.com", "foo.com", "cloudflare", now.Add(-2*time.Hour)),
+		entry("bar.foo.org", "foo.org", "gandi", now.Add(-time.Hour)),
+	))
+
+	entries, total := store.Query(Query{})
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "bar.foo.org", entries[0].FQDN, "newest entry should come first")
+
+	_, total = store.Query(Query{Domain: "FOO.com"})
+	assert.Equal(t, 2, total)
+
+	entries, total = store.Query(Query{Domain: "bar.foo.com"})
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "bar.foo.com", entries[0].FQDN)
+
+	_, total = store.Query(Query{Registrar: "gandi"})
+	assert.Equal(t, 1, total)
+
+	entries, total = store.Query(Query{From: now.Add(-150 * time.Minute), To: now.Add(-30 * time.Minute)})
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "bar.foo.org", entries[0].FQDN)
+	assert.Equal(t, "foo.com", entries[1].FQDN)
+}
+
+func TestQueryAllow(t *testing.T) {
+	store, _ := NewStore("", 0, 0)
+	now := time.Now()
+
+	for i := range 4 {
+		fqdn := "foo.com"
+		if i%2 == 0 {
+			fqdn = "bar.foo.com"
+		}
+		assert.Nil(t, store.Add(entry(fqdn, "foo.com", "cloudflare", now.Add(time.Duration(i)*time.Minute))))
+	}
+
+	entries, total := store.Query(Query{Allow: func(e Entry) bool { return e.Subdomain() == "bar" }, Limit: 1})
+	assert.Equal(t, 2, total)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "bar.foo.com", entries[0].FQDN)
+	}
+}
+
+func TestEntrySubdomain(t *testing.T) {
+	assert.Equal(t, "bar", entry("bar.foo.com", "foo.com", "cloudflare", time.Now()).Subdomain())
+	assert.Equal(t, "a.bar", entry("A.bar.foo.com", "foo.com", "cloudflare", time.Now()).Subdomain())
+	assert.Equal(t, "", entry("foo.com", "foo.com", "cloudflare", time.Now()).Subdomain())
+}
+
+func TestQueryPagination(t *testing.T) {
+	store, _ := NewStore("", 0, 0)
+	now := time.Now()
+
+	for i := range 5 {
+		assert.Nil(t, store.Add(entry("foo.com", "foo.com", "cloudflare", now.Add(time.Duration(i)*time.Minute))))
+	}
+
+	entries, total := store.Query(Query{Offset: 1, Limit: 2})
+	assert.Equal(t, 5, total)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, now.Add(3*time.Minute), entries[0].Time)
+		assert.Equal(t, now.Add(2*time.Minute), entries[1].Time)
+	}
+
+	entries, total = store.Query(Query{Offset: 10, Limit: 2})
+	assert.Equal(t, 5, total)
+	assert.Empty(t, entries)
+}
+
+func TestRetention(t *testing.T) {
+	store, _ := NewStore("", 3, time.Hour)
+	now := time.Now()
+
+	assert.Nil(t, store.Add(entry("old.foo.com", "foo.com", "cloudflare", now.Add(-2*time.Hour))))
+	_, total := store.Query(Query{})
+	assert.Equal(t, 0, total, "entries older than max age should be dropped")
+
+	for range 5 {
+		assert.Nil(t, store.Add(entry("foo.com", "foo.com", "cloudflare", now)))
+	}
+
+	_, total = store.Query(Query{})
+	assert.Equal(t, 3, total)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	store, err := NewStore(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, store.Add(entry("bar.foo.com", "foo.com", "cloudflare", now)))
+	assert.Nil(t, store.Add(entry("foo.com", "foo.com", "cloudflare", now)))
+
+	// simulate a crash while appending
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	_, _ = f.WriteString(`{"time":"20`)
+	_ = f.Close()
+
+	reopened, err := NewStore(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, total := reopened.Query(Query{})
+	assert.Equal(t, 2, total)
+	assert.Equal(t, now, entries[0].Time)
+	assert.Equal(t, "foo.com", entries[0].FQDN)
+}
+
+func TestPersistenceRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	store, err := NewStore(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 12 {
+		assert.Nil(t, store.Add(entry("foo.com", "foo.com", "cloudflare", time.Now())))
+	}
+
+	reopened, err := NewStore(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, total := reopened.Query(Query{})
+	assert.Equal(t, 10, total)
+}
+
+func TestUpdatedRecordsOrigin(t *testing.T) {
+	store, _ := NewStore("", 0, 0)
+
+	ctx := updater.WithOrigin(context.Background(), updater.Origin{Client: "192.0.2.1", Credential: "fritzbox",
+		RequestID: "abc123"})
+	store.Updated(ctx, []updater.Result{
+		{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "bar", Type: services.RecordTypeA, IP: "10.0.0.1", PreviousIP: "10.0.0.2", Status: updater.StatusUpdated},
+		{Registrar: "cloudflare", Domain: "foo.com", Type: services.RecordTypeA, IP: "10.0.0.1", Status: updater.StatusFailed, Error: "registrar rejected request"},
+	})
+
+	entries, total := store.Query(Query{})
+	if assert.Equal(t, 2, total) {
+		assert.Equal(t, "foo.com", entries[0].FQDN)
+		assert.Equal(t, updater.StatusFailed, entries[0].Status)
+		assert.Equal(t, "registrar rejected request", entries[0].Error)
+
+		assert.Equal(t, "bar.foo.com", entries[1].FQDN)
+		assert.Equal(t, "192.0.2.1", entries[1].Client)
+		assert.Equal(t, "fritzbox", entries[1].Credential)
+		assert.Equal(t, "abc123", entries[1].RequestID)
+		assert.Equal(t, "10.0.0.2", entries[1].PreviousValue)
+		assert.Equal(t, "10.0.0.1", entries[1].Value)
+	}
+}
@@ -0,0 +1,9 @@
+package ifwatch
+
+import "errors"
+
+var (
+	ErrNoInterfaces        = errors.New("no interfaces configured")
+	ErrUnsupportedPlatform = errors.New("watching interface addresses is only supported on linux")
+	ErrSubscriptionClosed  = errors.New("netlink address subscription closed")
+)
@@ -0,0 +1,134 @@
+//go:build linux
+
+package ifwatch
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"net/netip"
+	"time"
+)
+
+const supported = true
+
+// netlinkClient is the part of netlink the watcher depends on, replaced in tests.
+type netlinkClient interface {
+	AddrSubscribeWithOptions(ch chan<- netlink.AddrUpdate, done <-chan struct{}, options netlink.AddrSubscribeOptions) error
+	LinkByName(name string) (netlink.Link, error)
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+}
+
+// kernel talks netlink to the kernel of the host.
+type kernel struct{}
+
+func (kernel) AddrSubscribeWithOptions(ch chan<- netlink.AddrUpdate, done <-chan struct{}, options netlink.AddrSubscribeOptions) error {
+	return netlink.AddrSubscribeWithOptions(ch, done, options)
+}
+
+func (kernel) LinkByName(name string) (netlink.Link, error) {
+	return netlink.LinkByName(name)
+}
+
+func (kernel) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	return netlink.AddrList(link, family)
+}
+
+// Run publishes the current addresses and then subscribes to address changes via netlink until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	return w.run(ctx, kernel{})
+}
+
+func (w *Watcher) run(ctx context.Context, client netlinkClient) error {
+	logger := zerolog.Ctx(ctx).With().Str("source", Source).Logger()
+
+	updates := make(chan netlink.AddrUpdate, 64)
+	done := make(chan struct{})
+	defer close(done)
+
+	err := client.AddrSubscribeWithOptions(updates, done, netlink.AddrSubscribeOptions{
+		ErrorCallback: func(err error) {
+			logger.Error().Err(err).Msg("receiving netlink address updates failed")
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.resync)
+	defer ticker.Stop()
+
+	for {
+		addrs, err := listAddresses(client, w.interfaces)
+		if err != nil {
+			logger.Error().Err(err).Msg("listing interface addresses failed")
+		} else {
+			w.Sync(ctx, addrs)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case _, ok := <-updates:
+			if !ok {
+				return ErrSubscriptionClosed
+			}
+
+			// changes come in bursts, e.g. when a PPPoE session is established, listing once covers all of them
+			drain(updates)
+		}
+	}
+}
+
+func drain(updates <-chan netlink.AddrUpdate) {
+	for {
+		select {
+		case <-updates:
+		default:
+			return
+		}
+	}
+}
+
+// listAddresses returns the addresses of the interfaces that currently exist.
+func listAddresses(client netlinkClient, interfaces []string) ([]Address, error) {
+	var result []Address
+
+	for _, name := range interfaces {
+		link, err := client.LinkByName(name)
+		if err != nil {
+			// dial-up interfaces only exist while connected
+			var notFound netlink.LinkNotFoundError
+			if errors.As(err, &notFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		addrs, err := client.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			ip, ok := netip.AddrFromSlice(addr.IP)
+			if !ok {
+				continue
+			}
+
+			result = append(result, Address{
+				Interface:  name,
+				IP:         ip.Unmap(),
+				Global:     addr.Scope == unix.RT_SCOPE_UNIVERSE,
+				Temporary:  addr.Flags&unix.IFA_F_TEMPORARY != 0,
+				Deprecated: addr.Flags&unix.IFA_F_DEPRECATED != 0,
+				Tentative:  addr.Flags&(unix.IFA_F_TENTATIVE|unix.IFA_F_DADFAILED) != 0,
+			})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,166 @@
+//go:build linux
+
+package ifwatch
+
+import (
+	"context"
+	"errors"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListAddresses_Loopback(t *testing.T) {
+	addrs, err := listAddresses(kernel{}, []string{"lo", "frigabun-missing0"})
+	if err != nil {
+		t.Skipf("netlink not available: %v", err)
+	}
+
+	for _, addr := range addrs {
+		assert.Equal(t, "lo", addr.Interface)
+		assert.False(t, addr.Global, addr.IP.String())
+		assert.False(t, addr.usable())
+	}
+}
+
+// fakeNetlink serves the addresses of its links and forwards the events sent via notify to the subscriber.
+type fakeNetlink struct {
+	mu        sync.Mutex
+	links     map[string][]netlink.Addr
+	updates   chan<- netlink.AddrUpdate
+	subscribe error
+}
+
+func (f *fakeNetlink) AddrSubscribeWithOptions(ch chan<- netlink.AddrUpdate, _ <-chan struct{}, _ netlink.AddrSubscribeOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.updates = ch
+	return f.subscribe
+}
+
+func (f *fakeNetlink) LinkByName(name string) (netlink.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.links[name]; !ok {
+		return nil, netlink.LinkNotFoundError{}
+	}
+
+	return &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: name}}, nil
+}
+
+func (f *fakeNetlink) AddrList(link netlink.Link, _ int) ([]netlink.Addr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.links[link.Attrs().Name], nil
+}
+
+// notify applies change to the links and sends the matching event, like the kernel does.
+func (f *fakeNetlink) notify(update netlink.AddrUpdate, change func(links map[string][]netlink.Addr)) {
+	f.mu.Lock()
+	change(f.links)
+	updates := f.updates
+	f.mu.Unlock()
+
+	updates <- update
+}
+
+func globalAddr(ip string) netlink.Addr {
+	addr := net.ParseIP(ip)
+	return netlink.Addr{IPNet: &net.IPNet{IP: addr, Mask: net.CIDRMask(32, 32)}, Scope: unix.RT_SCOPE_UNIVERSE}
+}
+
+// chanPublisher reports every published address on a channel.
+type chanPublisher chan netip.Addr
+
+func (c chanPublisher) Publish(_ context.Context, _ string, addresses ...netip.Addr) []updater.Result {
+	for _, addr := range addresses {
+		c <- addr
+	}
+
+	return []updater.Result{{Status: updater.StatusUpdated}}
+}
+
+func (c chanPublisher) next(t *testing.T) netip.Addr {
+	select {
+	case addr := <-c:
+		return addr
+	case <-time.After(time.Second):
+		t.Fatal("no address published")
+		return netip.Addr{}
+	}
+}
+
+func TestRun_AddressEvents(t *testing.T) {
+	client := &fakeNetlink{links: map[string][]netlink.Addr{
+		"eth0": {globalAddr("198.51.100.1"), {IPNet: &net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)}, Scope: unix.RT_SCOPE_LINK}},
+	}}
+	publisher := make(chanPublisher, 8)
+
+	w, err := NewWatcher(publisher, []string{"ppp0", "eth0"}, WithRecordTypes(services.RecordTypeA))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- w.run(ctx, client) }()
+
+	assert.Equal(t, netip.MustParseAddr("198.51.100.1"), publisher.next(t))
+
+	// the dial-up interface comes up and takes precedence
+	added := globalAddr("203.0.113.7")
+	client.notify(netlink.AddrUpdate{LinkAddress: *added.IPNet, NewAddr: true}, func(links map[string][]netlink.Addr) {
+		links["ppp0"] = []netlink.Addr{added}
+	})
+	assert.Equal(t, netip.MustParseAddr("203.0.113.7"), publisher.next(t))
+
+	// once its address is removed, the address of the next interface is published again
+	client.notify(netlink.AddrUpdate{LinkAddress: *added.IPNet, NewAddr: false}, func(links map[string][]netlink.Addr) {
+		delete(links, "ppp0")
+	})
+	assert.Equal(t, netip.MustParseAddr("198.51.100.1"), publisher.next(t))
+
+	cancel()
+	assert.NoError(t, <-result)
+	assert.Empty(t, publisher, "unchanged addresses should not be published")
+}
+
+func TestRun_SubscriptionClosed(t *testing.T) {
+	client := &fakeNetlink{links: map[string][]netlink.Addr{}}
+	w, err := NewWatcher(make(chanPublisher, 8), []string{"eth0"})
+	assert.NoError(t, err)
+
+	result := make(chan error)
+	go func() { result <- w.run(context.Background(), client) }()
+
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.updates != nil
+	}, time.Second, time.Millisecond)
+
+	close(client.updates)
+
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, ErrSubscriptionClosed)
+	case <-time.After(time.Second):
+		t.Fatal("watcher did not stop")
+	}
+}
+
+func TestRun_SubscribeFails(t *testing.T) {
+	client := &fakeNetlink{subscribe: errors.New("operation not permitted")}
+	w, err := NewWatcher(make(chanPublisher, 8), []string{"eth0"})
+	assert.NoError(t, err)
+
+	assert.EqualError(t, w.run(context.Background(), client), "operation not permitted")
+}
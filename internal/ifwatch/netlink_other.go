@@ -0,0 +1,12 @@
+//go:build !linux
+
+package ifwatch
+
+import "context"
+
+const supported = false
+
+// Run fails, netlink is only available on linux.
+func (w *Watcher) Run(context.Context) error {
+	return ErrUnsupportedPlatform
+}
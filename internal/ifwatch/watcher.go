@@ -0,0 +1,178 @@
+package ifwatch
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services/factory"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// Source is recorded as origin of the updates triggered by the watcher.
+	Source = "netlink"
+
+	defaultResync = 5 * time.Minute
+)
+
+// Address is an address assigned to a local interface.
+type Address struct {
+	Interface string
+	IP        netip.Addr
+	// Global is set for addresses of universe scope, as opposed to link or host local ones.
+	Global bool
+	// Temporary is set for IPv6 privacy extension addresses (RFC 8981), which change regularly.
+	Temporary bool
+	// Deprecated is set once the preferred lifetime of the address ended.
+	Deprecated bool
+	// Tentative is set while duplicate address detection hasn't completed or failed.
+	Tentative bool
+}
+
+// sharedAddressSpace is used by carrier-grade NAT between the provider and its customers (RFC 6598), addresses in it
+// aren't reachable from the internet.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// usable reports whether the address is stable and reachable from the internet.
+func (a Address) usable() bool {
+	return a.Global && !a.Temporary && !a.Deprecated && !a.Tentative &&
+		a.IP.IsGlobalUnicast() && !a.IP.IsPrivate() && !sharedAddressSpace.Contains(a.IP.Unmap())
+}
+
+// Publisher updates the records to the addresses of the interfaces, implemented by records.Records.
+type Publisher interface {
+	Publish(ctx context.Context, source string, addresses ...netip.Addr) []updater.Result
+}
+
+// Watcher publishes the addresses of local interfaces as soon as the kernel reports a change, for hosts holding
+// their public addresses directly, e.g. on a PPPoE interface or via SLAAC.
+type Watcher struct {
+	publisher  Publisher
+	interfaces []string
+	types      []services.RecordType
+	resync     time.Duration
+
+	mu   sync.Mutex
+	last map[services.RecordType]netip.Addr
+}
+
+type Option func(*Watcher)
+
+// WithRecordTypes limits the published records, A and AAAA by default.
+func WithRecordTypes(types ...services.RecordType) Option {
+	return func(w *Watcher) {
+		w.types = types
+	}
+}
+
+// WithResync sets the interval the addresses are listed in even without a change, retrying failed updates. Five
+// minutes by default.
+func WithResync(interval time.Duration) Option {
+	return func(w *Watcher) {
+		if interval > 0 {
+			w.resync = interval
+		}
+	}
+}
+
+// NewWatcher creates a watcher for the addresses of interfaces, earlier interfaces taking precedence.
+func NewWatcher(publisher Publisher, interfaces []string, opts ...Option) (*Watcher, error) {
+	if len(interfaces) == 0 {
+		return nil, ErrNoInterfaces
+	}
+
+	w := &Watcher{
+		publisher:  publisher,
+		interfaces: interfaces,
+		types:      []services.RecordType{services.RecordTypeA, services.RecordTypeAAAA},
+		resync:     defaultResync,
+		last:       make(map[services.RecordType]netip.Addr),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w, nil
+}
+
+// Load creates the watcher configured in the netlink section, returning nil if watching is disabled.
+func Load(serviceFactory factory.ServiceFactory, u *updater.Updater) (*Watcher, error) {
+	if !viper.GetBool("netlink.enabled") {
+		return nil, nil
+	}
+
+	if !supported {
+		return nil, ErrUnsupportedPlatform
+	}
+
+	r, err := records.New(serviceFactory, u, viper.GetStringSlice("netlink.hostnames"))
+	if err != nil {
+		return nil, err
+	}
+
+	var types []services.RecordType
+	if !viper.IsSet("netlink.ipv4") || viper.GetBool("netlink.ipv4") {
+		types = append(types, services.RecordTypeA)
+	}
+	if !viper.IsSet("netlink.ipv6") || viper.GetBool("netlink.ipv6") {
+		types = append(types, services.RecordTypeAAAA)
+	}
+
+	return NewWatcher(r, viper.GetStringSlice("netlink.interfaces"),
+		WithRecordTypes(types...),
+		WithResync(viper.GetDuration("netlink.resync")))
+}
+
+// Sync publishes the usable addresses among addrs that changed since the last successful publish, one per record
+// type.
+func (w *Watcher) Sync(ctx context.Context, addrs []Address) {
+	logger := zerolog.Ctx(ctx).With().Str("source", Source).Logger()
+
+	for recordType, addr := range w.choose(addrs) {
+		w.mu.Lock()
+		changed := w.last[recordType] != addr
+		w.mu.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		logger.Info().Str("type", string(recordType)).Str("ip", addr.String()).Msg("interface address changed")
+
+		results := w.publisher.Publish(ctx, Source, addr)
+
+		// failed records are retried with the next change or resync
+		if !slices.ContainsFunc(results, updater.Result.Failed) {
+			w.mu.Lock()
+			w.last[recordType] = addr
+			w.mu.Unlock()
+		}
+	}
+}
+
+// choose returns the first usable address per record type, following the order of the configured interfaces.
+func (w *Watcher) choose(addrs []Address) map[services.RecordType]netip.Addr {
+	chosen := make(map[services.RecordType]netip.Addr)
+
+	for _, name := range w.interfaces {
+		for _, addr := range addrs {
+			if addr.Interface != name || !addr.usable() {
+				continue
+			}
+
+			recordType := services.RecordTypeFor(addr.IP.Unmap())
+			if _, ok := chosen[recordType]; !ok && slices.Contains(w.types, recordType) {
+				chosen[recordType] = addr.IP.Unmap()
+			}
+		}
+	}
+
+	return chosen
+}
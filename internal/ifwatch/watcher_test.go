@@ -0,0 +1,140 @@
+package ifwatch
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type fakePublisher struct {
+	published []netip.Addr
+	failed    bool
+}
+
+func (f *fakePublisher) Publish(_ context.Context, _ string, addresses ...netip.Addr) []updater.Result {
+	f.published = append(f.published, addresses...)
+
+	if f.failed {
+		return []updater.Result{{Status: updater.StatusFailed}}
+	}
+
+	return []updater.Result{{Status: updater.StatusUpdated}}
+}
+
+func TestSync_FiltersAddresses(t *testing.T) {
+	publisher := &fakePublisher{}
+	w, err := NewWatcher(publisher, []string{"ppp0", "eth0"})
+	assert.NoError(t, err)
+
+	w.Sync(context.Background(), []Address{
+		{Interface: "eth0", IP: netip.MustParseAddr("192.168.1.2"), Global: true},
+		{Interface: "eth0", IP: netip.MustParseAddr("fe80::1")},
+		{Interface: "eth0", IP: netip.MustParseAddr("2001:db8::abcd"), Global: true, Temporary: true},
+		{Interface: "eth0", IP: netip.MustParseAddr("2001:db8::dead"), Global: true, Deprecated: true},
+		{Interface: "eth0", IP: netip.MustParseAddr("2001:db8::beef"), Global: true, Tentative: true},
+		{Interface: "eth0", IP: netip.MustParseAddr("2001:db8::10"), Global: true},
+		{Interface: "ppp0", IP: netip.MustParseAddr("100.64.12.34"), Global: true},
+		{Interface: "ppp0", IP: netip.MustParseAddr("::ffff:100.127.255.254"), Global: true},
+		{Interface: "ppp0", IP: netip.MustParseAddr("203.0.113.7"), Global: true},
+		{Interface: "wlan0", IP: netip.MustParseAddr("198.51.100.1"), Global: true},
+	})
+
+	assert.ElementsMatch(t, []netip.Addr{
+		netip.MustParseAddr("203.0.113.7"),
+		netip.MustParseAddr("2001:db8::10"),
+	}, publisher.published)
+}
+
+func TestSync_InterfaceOrder(t *testing.T) {
+	publisher := &fakePublisher{}
+	w, err := NewWatcher(publisher, []string{"ppp0", "eth0"}, WithRecordTypes(services.RecordTypeA))
+	assert.NoError(t, err)
+
+	addrs := []Address{
+		{Interface: "eth0", IP: netip.MustParseAddr("198.51.100.1"), Global: true},
+		{Interface: "ppp0", IP: netip.MustParseAddr("203.0.113.7"), Global: true},
+		{Interface: "ppp0", IP: netip.MustParseAddr("2001:db8::10"), Global: true},
+	}
+
+	w.Sync(context.Background(), addrs)
+	w.Sync(context.Background(), addrs)
+
+	// unchanged addresses are published only once
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("203.0.113.7")}, publisher.published)
+
+	// the dial-up interface went away
+	w.Sync(context.Background(), addrs[:1])
+
+	assert.Equal(t, []netip.Addr{
+		netip.MustParseAddr("203.0.113.7"),
+		netip.MustParseAddr("198.51.100.1"),
+	}, publisher.published)
+}
+
+func TestSync_RetriesFailedUpdates(t *testing.T) {
+	publisher := &fakePublisher{failed: true}
+	w, err := NewWatcher(publisher, []string{"eth0"})
+	assert.NoError(t, err)
+
+	addrs := []Address{{Interface: "eth0", IP: netip.MustParseAddr("2001:db8::10"), Global: true}}
+
+	w.Sync(context.Background(), addrs)
+	w.Sync(context.Background(), addrs)
+
+	assert.Len(t, publisher.published, 2)
+}
+
+func TestNewWatcher_NoInterfaces(t *testing.T) {
+	_, err := NewWatcher(&fakePublisher{}, nil)
+	assert.ErrorIs(t, err, ErrNoInterfaces)
+}
+
+func TestLoadDisabled(t *testing.T) {
+	w, err := Load(mockfactory.NewMockServiceFactory(t), updater.New())
+	assert.NoError(t, err)
+	assert.Nil(t, w)
+}
+
+func TestLoad(t *testing.T) {
+	if !supported {
+		t.Skip("netlink is only available on linux")
+	}
+
+	viper.Set("netlink.enabled", true)
+	viper.Set("netlink.hostnames", []string{"home.example.com"})
+	viper.Set("netlink.interfaces", []string{"ppp0"})
+	viper.Set("netlink.ipv6", false)
+	viper.Set("netlink.resync", "1m")
+	t.Cleanup(func() { viper.Set("netlink", nil) })
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.example.com").Return("cloudflare", "example.com", nil)
+
+	w, err := Load(sf, updater.New())
+	assert.NoError(t, err)
+	if assert.NotNil(t, w) {
+		assert.Equal(t, []string{"ppp0"}, w.interfaces)
+		assert.Equal(t, []services.RecordType{services.RecordTypeA}, w.types)
+		assert.Equal(t, time.Minute, w.resync)
+	}
+}
+
+func TestLoadNoHostnames(t *testing.T) {
+	if !supported {
+		t.Skip("netlink is only available on linux")
+	}
+
+	viper.Set("netlink.enabled", true)
+	viper.Set("netlink.interfaces", []string{"ppp0"})
+	t.Cleanup(func() { viper.Set("netlink", nil) })
+
+	_, err := Load(mockfactory.NewMockServiceFactory(t), updater.New())
+	assert.ErrorIs(t, err, records.ErrNoHostnames)
+}
@@ -0,0 +1,10 @@
+package ipv6
+
+import "errors"
+
+var (
+	ErrInvalidPrefix      = errors.New("invalid IPv6 prefix, must be /64 or shorter")
+	ErrInvalidSuffix      = errors.New("invalid IPv6 interface identifier")
+	ErrInvalidMAC         = errors.New("invalid MAC address")
+	ErrMissingInterfaceID = errors.New("missing suffix or MAC address")
+)
@@ -0,0 +1,106 @@
+package ipv6
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"net"
+	"net/netip"
+)
+
+// Host describes the interface identifier of a host behind the delegated prefix, either as a static suffix
+// or derived from the MAC address of its interface.
+type Host struct {
+	Subdomain string `mapstructure:"subdomain"`
+	Suffix    string `mapstructure:"suffix"`
+	MAC       string `mapstructure:"mac"`
+}
+
+// LoadHosts reads the configured hosts and returns their interface identifiers by subdomain.
+func LoadHosts() (map[string]netip.Addr, error) {
+	var hosts []Host
+
+	err := viper.UnmarshalKey("ipv6.hosts", &hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	identifiers := make(map[string]netip.Addr, len(hosts))
+
+	for _, host := range hosts {
+		iid, err := host.InterfaceID()
+		if err != nil {
+			log.Error().Err(err).Str("subdomain", host.Subdomain).Msg("invalid ipv6 host config")
+			return nil, err
+		}
+
+		log.Debug().Str("subdomain", host.Subdomain).Str("iid", iid.String()).Msg("registered ipv6 host")
+		identifiers[host.Subdomain] = iid
+	}
+
+	return identifiers, nil
+}
+
+// InterfaceID returns the interface identifier of the host. A static suffix takes precedence over the MAC address.
+func (h Host) InterfaceID() (netip.Addr, error) {
+	if len(h.Suffix) > 0 {
+		suffix, err := netip.ParseAddr(h.Suffix)
+		if err != nil || !suffix.Is6() || suffix.Is4In6() {
+			return netip.Addr{}, ErrInvalidSuffix
+		}
+
+		return suffix, nil
+	}
+
+	if len(h.MAC) > 0 {
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil {
+			return netip.Addr{}, ErrInvalidMAC
+		}
+
+		return EUI64(mac)
+	}
+
+	return netip.Addr{}, ErrMissingInterfaceID
+}
+
+// EUI64 derives a modified EUI-64 interface identifier from a 48 bit MAC address as per RFC 4291, appendix A.
+func EUI64(mac net.HardwareAddr) (netip.Addr, error) {
+	if len(mac) != 6 {
+		return netip.Addr{}, ErrInvalidMAC
+	}
+
+	var b [16]byte
+	copy(b[8:11], mac[0:3])
+	b[11] = 0xff
+	b[12] = 0xfe
+	copy(b[13:16], mac[3:6])
+	b[8] ^= 0x02
+
+	return netip.AddrFrom16(b), nil
+}
+
+// Combine returns the address made up of the network bits of prefix and the remaining bits of iid.
+func Combine(prefix netip.Prefix, iid netip.Addr) (netip.Addr, error) {
+	if !prefix.IsValid() || !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() > 64 {
+		return netip.Addr{}, ErrInvalidPrefix
+	}
+
+	network := prefix.Masked().Addr().As16()
+	host := iid.As16()
+
+	var b [16]byte
+	for i := range b {
+		bits := prefix.Bits() - i*8
+		switch {
+		case bits >= 8:
+			b[i] = network[i]
+		case bits <= 0:
+			b[i] = host[i]
+		default:
+			mask := byte(0xff << (8 - bits))
+			b[i] = network[i]&mask | host[i]&^mask
+		}
+	}
+
+	return netip.AddrFrom16(b), nil
+}
@@ -0,0 +1,92 @@
+package ipv6
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestEUI64(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:32:12:34:56")
+	iid, err := EUI64(mac)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "::211:32ff:fe12:3456", iid.String())
+}
+
+func TestEUI64InvalidMAC(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:32:12:34:56:78:9a")
+	_, err := EUI64(mac)
+
+	assert.ErrorIs(t, err, ErrInvalidMAC)
+}
+
+func TestCombine(t *testing.T) {
+	iid := netip.MustParseAddr("::211:32ff:fe12:3456")
+
+	addr, err := Combine(netip.MustParsePrefix("2001:db8:1:2::/64"), iid)
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8:1:2:211:32ff:fe12:3456", addr.String())
+
+	addr, err = Combine(netip.MustParsePrefix("2001:db8:aa00::/56"), netip.MustParseAddr("::1:0:0:0:10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8:aa00:1::10", addr.String())
+
+	addr, err = Combine(netip.MustParsePrefix("2001:db8:aa00::/60"), netip.MustParseAddr("::1f:0:0:0:10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8:aa00:f::10", addr.String())
+}
+
+func TestCombineInvalidPrefix(t *testing.T) {
+	iid := netip.MustParseAddr("::1")
+
+	_, err := Combine(netip.MustParsePrefix("2001:db8:1:2::/80"), iid)
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+
+	_, err = Combine(netip.MustParsePrefix("10.0.0.0/8"), iid)
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+}
+
+func TestHostInterfaceID(t *testing.T) {
+	iid, err := Host{Suffix: "::10", MAC: "00:11:32:12:34:56"}.InterfaceID()
+	assert.Nil(t, err)
+	assert.Equal(t, "::10", iid.String())
+
+	iid, err = Host{MAC: "00:11:32:12:34:56"}.InterfaceID()
+	assert.Nil(t, err)
+	assert.Equal(t, "::211:32ff:fe12:3456", iid.String())
+
+	_, err = Host{Suffix: "10.0.0.1"}.InterfaceID()
+	assert.ErrorIs(t, err, ErrInvalidSuffix)
+
+	_, err = Host{MAC: "foo"}.InterfaceID()
+	assert.ErrorIs(t, err, ErrInvalidMAC)
+
+	_, err = Host{}.InterfaceID()
+	assert.ErrorIs(t, err, ErrMissingInterfaceID)
+}
+
+func TestLoadHosts(t *testing.T) {
+	viper.Set("ipv6.hosts", []map[string]any{
+		{"subdomain": "nas", "suffix": "::10"},
+		{"subdomain": "server", "mac": "00:11:32:12:34:56"},
+	})
+	defer viper.Set("ipv6.hosts", nil)
+
+	hosts, err := LoadHosts()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "::10", hosts["nas"].String())
+	assert.Equal(t, "::211:32ff:fe12:3456", hosts["server"].String())
+}
+
+func TestLoadHostsInvalid(t *testing.T) {
+	viper.Set("ipv6.hosts", []map[string]any{{"subdomain": "nas"}})
+	defer viper.Set("ipv6.hosts", nil)
+
+	_, err := LoadHosts()
+
+	assert.ErrorIs(t, err, ErrMissingInterfaceID)
+}
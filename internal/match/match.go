@@ -0,0 +1,38 @@
+// Package match implements the case-insensitive glob filters of policies and webhooks.
+package match
+
+import (
+	"path"
+	"strings"
+)
+
+// Any reports whether value matches one of the patterns, ignoring case. Patterns are globs as understood by
+// path.Match, an empty list matches any value.
+func Any(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	value = strings.ToLower(value)
+
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToLower(pattern), value); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Valid reports whether all patterns are well-formed, malformed patterns never match.
+func Valid(patterns ...[]string) bool {
+	for _, list := range patterns {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
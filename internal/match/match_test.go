@@ -0,0 +1,20 @@
+package match
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAny(t *testing.T) {
+	assert.True(t, Any(nil, "foo.com"), "empty list should match anything")
+	assert.True(t, Any([]string{"foo.org", "FOO.com"}, "foo.COM"))
+	assert.True(t, Any([]string{"*.foo.com"}, "bar.foo.com"))
+	assert.False(t, Any([]string{"*.foo.com"}, "foo.com"))
+	assert.False(t, Any([]string{"[foo"}, "[foo"), "malformed pattern should not match")
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid())
+	assert.True(t, Valid([]string{"*.foo.com", "office"}, nil))
+	assert.False(t, Valid([]string{"foo.com"}, []string{"[foo"}))
+}
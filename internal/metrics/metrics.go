@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Recorder exports the results of record updates, implementing updater.Listener.
+type Recorder struct {
+	updates     *prometheus.CounterVec
+	publishedIP *prometheus.GaugeVec
+	lastSuccess *prometheus.GaugeVec
+
+	mu        sync.Mutex
+	published map[recordKey]string
+}
+
+type recordKey struct {
+	registrar  string
+	fqdn       string
+	recordType string
+}
+
+func NewRecorder(registerer prometheus.Registerer) *Recorder {
+	factory := promauto.With(registerer)
+
+	return &Recorder{
+		updates: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "frigabun",
+			Name:      "record_updates_total",
+			Help:      "Record updates by registrar and outcome.",
+		}, []string{"registrar", "status"}),
+		publishedIP: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "frigabun",
+			Name:      "published_ip_info",
+			Help:      "Address last published for a record, always 1.",
+		}, []string{"registrar", "fqdn", "type", "ip"}),
+		lastSuccess: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "frigabun",
+			Name:      "last_successful_update_timestamp_seconds",
+			Help:      "Unix time of the last successful update of a record.",
+		}, []string{"registrar", "fqdn", "type"}),
+		published: make(map[recordKey]string),
+	}
+}
+
+func (r *Recorder) Updated(_ context.Context, results []updater.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := float64(time.Now().Unix())
+
+	for _, result := range results {
+		registrar := string(result.Registrar)
+		r.updates.WithLabelValues(registrar, string(result.Status)).Inc()
+
+		if result.Failed() {
+			continue
+		}
+
+		key := recordKey{registrar: registrar, fqdn: result.FQDN(), recordType: string(result.Type)}
+
+		// only one address per record is exported, replacing the series of the previous one
+		if previous, ok := r.published[key]; ok && previous != result.IP {
+			r.publishedIP.DeleteLabelValues(key.registrar, key.fqdn, key.recordType, previous)
+		}
+
+		r.published[key] = result.IP
+		r.publishedIP.WithLabelValues(key.registrar, key.fqdn, key.recordType, result.IP).Set(1)
+		r.lastSuccess.WithLabelValues(key.registrar, key.fqdn, key.recordType).Set(now)
+	}
+}
+
+// Middleware measures the requests served by echo, labeled by route instead of the full URL.
+func Middleware(registerer prometheus.Registerer) echo.MiddlewareFunc {
+	factory := promauto.With(registerer)
+
+	requests := factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "frigabun",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests served by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	duration := factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "frigabun",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests served by route and method.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method"})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			route := c.Path()
+			if len(route) == 0 {
+				route = "unmatched"
+			}
+
+			status := c.Response().Status
+			if err != nil {
+				// the error response is written by echo after the middleware chain returns
+				status = http.StatusInternalServerError
+				if httpErr, ok := err.(*echo.HTTPError); ok {
+					status = httpErr.Code
+				}
+			}
+
+			requests.WithLabelValues(route, c.Request().Method, strconv.Itoa(status)).Inc()
+			duration.WithLabelValues(route, c.Request().Method).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// Handler serves the metrics gathered by gatherer.
+func Handler(gatherer prometheus.Gatherer) echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecorderUpdated(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder := NewRecorder(registry)
+
+	recorder.Updated(context.Background(), []updater.Result{
+		{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "bar", Type: services.RecordTypeA, IP: "10.0.0.1", Status: updater.StatusUpdated},
+		{Registrar: "cloudflare", Domain: "foo.com", Type: services.RecordTypeA, IP: "10.0.0.1", Status: updater.StatusFailed},
+	})
+	recorder.Updated(context.Background(), []updater.Result{
+		{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "bar", Type: services.RecordTypeA, IP: "10.0.0.2", Status: updater.StatusUpdated},
+	})
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(recorder.updates.WithLabelValues("cloudflare", "updated")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(recorder.updates.WithLabelValues("cloudflare", "failed")))
+
+	expected := `
+# HELP frigabun_published_ip_info Address last published for a record, always 1.
+# TYPE frigabun_published_ip_info gauge
+frigabun_published_ip_info{fqdn="bar.foo.com",ip="10.0.0.2",registrar="cloudflare",type="A"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "frigabun_published_ip_info"))
+	assert.Equal(t, 1, testutil.CollectAndCount(recorder.lastSuccess))
+}
+
+func TestMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	e.Use(Middleware(registry))
+	e.GET("/api/status", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.GET("/metrics", Handler(registry))
+
+	for _, path := range []string{"/api/status", "/api/status?foo=bar", "/unknown"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `frigabun_http_requests_total{code="200",method="GET",route="/api/status"} 2`)
+	assert.Contains(t, rec.Body.String(), `frigabun_http_requests_total{code="404",method="GET",route="unmatched"} 1`)
+}
+
+func TestMiddlewareCountsRecoveredPanics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	e := echo.New()
+	e.Use(Middleware(registry))
+	e.Use(middleware.Recover())
+	e.GET("/api/update", func(c echo.Context) error { panic("boom") })
+	e.GET("/metrics", Handler(registry))
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/update", nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, rec.Body.String(), `frigabun_http_requests_total{code="500",method="GET",route="/api/update"} 1`)
+}
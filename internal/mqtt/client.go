@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"github.com/davidramiro/frigabun/services/factory"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"time"
+)
+
+const (
+	defaultClientID = "frigabun"
+	publishTimeout  = 10 * time.Second
+)
+
+// pahoClient publishes with QoS 1, waiting up to timeout for the broker's acknowledgement.
+type pahoClient struct {
+	client  paho.Client
+	timeout time.Duration
+}
+
+func (c *pahoClient) Publish(topic string, retained bool, payload []byte) error {
+	token := c.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(c.timeout) {
+		return ErrPublishTimeout
+	}
+
+	return token.Error()
+}
+
+// Load connects to the broker configured in the mqtt section, returning nil if mqtt is disabled. The connection is
+// retried in the background if the broker isn't reachable yet. The broker publishes offline to the availability
+// topic as last will once the connection is lost.
+func Load(serviceFactory factory.ServiceFactory) (*Publisher, error) {
+	if !viper.GetBool("mqtt.enabled") {
+		return nil, nil
+	}
+
+	broker := viper.GetString("mqtt.broker")
+	if len(broker) == 0 {
+		return nil, ErrMissingBroker
+	}
+
+	opts := []Option{WithTopicPrefix(viper.GetString("mqtt.topicPrefix"))}
+	if !viper.IsSet("mqtt.discovery") || viper.GetBool("mqtt.discovery") {
+		opts = append(opts, WithDiscovery(viper.GetString("mqtt.discoveryPrefix")))
+	}
+
+	client := &pahoClient{timeout: publishTimeout}
+	publisher := NewPublisher(client, serviceFactory, opts...)
+
+	clientID := viper.GetString("mqtt.clientId")
+	if len(clientID) == 0 {
+		clientID = defaultClientID
+	}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(viper.GetString("mqtt.username")).
+		SetPassword(viper.GetString("mqtt.password")).
+		SetWill(publisher.AvailabilityTopic(), offline, 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(paho.Client) {
+			log.Info().Str("broker", broker).Msg("connected to mqtt broker")
+			publisher.Connected()
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Str("broker", broker).Msg("lost connection to mqtt broker, reconnecting")
+		})
+
+	client.client = paho.NewClient(clientOpts)
+
+	token := client.client.Connect()
+	if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	if !client.client.IsConnected() {
+		log.Warn().Str("broker", broker).Msg("mqtt broker not reachable yet, retrying in background")
+	}
+
+	return publisher, nil
+}
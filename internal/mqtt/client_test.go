@@ -0,0 +1,170 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/davidramiro/frigabun/internal/updater"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker speaks just enough MQTT 3.1.1 to accept connections and QoS 1 publishes. Publishes are only
+// acknowledged if ack is set.
+type fakeBroker struct {
+	listener net.Listener
+	ack      bool
+
+	mu        sync.Mutex
+	published []message
+}
+
+func newFakeBroker(t *testing.T, ack bool) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &fakeBroker{listener: listener, ack: ack}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			topicLength := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+topicLength])
+			rest := body[2+topicLength:]
+
+			qos := (header >> 1) & 0x03
+			var id []byte
+			if qos > 0 {
+				id, rest = rest[:2], rest[2:]
+			}
+
+			b.mu.Lock()
+			b.published = append(b.published, message{topic: topic, retained: header&0x01 == 1, payload: string(rest)})
+			b.mu.Unlock()
+
+			if qos == 1 && b.ack {
+				_, _ = conn.Write([]byte{0x40, 0x02, id[0], id[1]})
+			}
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) received(topic string, payload string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.ContainsFunc(b.published, func(m message) bool {
+		return m.topic == topic && (payload == "" || m.payload == payload) && m.retained
+	})
+}
+
+func setupMQTTConfig(t *testing.T, broker string) {
+	viper.Set("mqtt.enabled", true)
+	viper.Set("mqtt.broker", broker)
+	t.Cleanup(func() { viper.Set("mqtt", nil) })
+}
+
+func TestLoadDisabled(t *testing.T) {
+	sf, _ := setupFactory(t)
+
+	publisher, err := Load(sf)
+	assert.NoError(t, err)
+	assert.Nil(t, publisher)
+}
+
+func TestLoadMissingBroker(t *testing.T) {
+	sf, _ := setupFactory(t)
+	setupMQTTConfig(t, "")
+
+	publisher, err := Load(sf)
+	assert.ErrorIs(t, err, ErrMissingBroker)
+	assert.Nil(t, publisher)
+}
+
+func TestLoadConnectsAndPublishes(t *testing.T) {
+	sf, _ := setupFactory(t)
+	broker := newFakeBroker(t, true)
+	setupMQTTConfig(t, broker.url())
+	viper.Set("mqtt.topicPrefix", "home/frigabun")
+
+	publisher, err := Load(sf)
+	if !assert.NoError(t, err) || !assert.NotNil(t, publisher) {
+		return
+	}
+	defer publisher.client.(*pahoClient).client.Disconnect(0)
+
+	assert.Eventually(t, func() bool {
+		return broker.received("home/frigabun/status", online) &&
+			broker.received("homeassistant/binary_sensor/frigabun/registrar_cloudflare/config", "")
+	}, 5*time.Second, 10*time.Millisecond, "connecting should announce availability and discovery")
+
+	publisher.Updated(context.Background(), []updater.Result{updated})
+	publisher.Wait()
+
+	assert.True(t, broker.received("home/frigabun/record/vpn_example_com_a/state", ""))
+}
+
+func TestPahoClientPublishTimeout(t *testing.T) {
+	broker := newFakeBroker(t, false)
+
+	client := paho.NewClient(paho.NewClientOptions().AddBroker(broker.url()).SetClientID("test"))
+	if token := client.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatal("cannot connect to fake broker", token.Error())
+	}
+	defer client.Disconnect(0)
+
+	err := (&pahoClient{client: client, timeout: 50 * time.Millisecond}).Publish("frigabun/status", true, []byte(online))
+	assert.ErrorIs(t, err, ErrPublishTimeout)
+}
@@ -0,0 +1,77 @@
+package mqtt
+
+import (
+	"github.com/davidramiro/frigabun/services"
+	"github.com/rs/zerolog"
+)
+
+// discoveryConfig is the subset of Home Assistant's MQTT discovery payload used for frigabun's entities.
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	ObjectID            string          `json:"object_id"`
+	StateTopic          string          `json:"state_topic"`
+	ValueTemplate       string          `json:"value_template"`
+	JSONAttributesTopic string          `json:"json_attributes_topic,omitempty"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	DeviceClass         string          `json:"device_class,omitempty"`
+	EntityCategory      string          `json:"entity_category,omitempty"`
+	Icon                string          `json:"icon,omitempty"`
+	Device              discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+var device = discoveryDevice{
+	Identifiers:  []string{"frigabun"},
+	Name:         "frigabun",
+	Manufacturer: "frigabun",
+	Model:        "DynDNS updater",
+}
+
+// announceRecord publishes the configs of the IP and last update sensors of a record.
+func (p *Publisher) announceRecord(logger zerolog.Logger, id string, state RecordState) {
+	name := state.FQDN + " " + string(state.Type)
+
+	p.announce(logger, "sensor", id+"_ip", discoveryConfig{
+		Name:                name,
+		StateTopic:          p.recordTopic(id),
+		ValueTemplate:       "{{ value_json.ip }}",
+		JSONAttributesTopic: p.recordTopic(id),
+		Icon:                "mdi:ip-network",
+	})
+
+	p.announce(logger, "sensor", id+"_last_update", discoveryConfig{
+		Name:           name + " last update",
+		StateTopic:     p.recordTopic(id),
+		ValueTemplate:  "{{ value_json.last_update }}",
+		DeviceClass:    "timestamp",
+		EntityCategory: "diagnostic",
+	})
+}
+
+// announceRegistrar publishes the config of a problem sensor, on while the registrar's circuit breaker isn't closed.
+func (p *Publisher) announceRegistrar(logger zerolog.Logger, registrar services.Registrar) {
+	p.announce(logger, "binary_sensor", "registrar_"+string(registrar), discoveryConfig{
+		Name:                string(registrar) + " registrar",
+		StateTopic:          p.registrarTopic(registrar),
+		ValueTemplate:       "{{ 'OFF' if value_json.healthy else 'ON' }}",
+		JSONAttributesTopic: p.registrarTopic(registrar),
+		DeviceClass:         "problem",
+		EntityCategory:      "diagnostic",
+	})
+}
+
+func (p *Publisher) announce(logger zerolog.Logger, component string, objectID string, config discoveryConfig) {
+	config.UniqueID = "frigabun_" + objectID
+	config.ObjectID = "frigabun_" + objectID
+	config.AvailabilityTopic = p.AvailabilityTopic()
+	config.Device = device
+
+	p.publishJSON(logger, p.discoveryPrefix+"/"+component+"/frigabun/"+objectID+"/config", config)
+}
@@ -0,0 +1,8 @@
+package mqtt
+
+import "errors"
+
+var (
+	ErrMissingBroker  = errors.New("mqtt enabled without broker")
+	ErrPublishTimeout = errors.New("timeout publishing to mqtt broker")
+)
@@ -0,0 +1,297 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services/factory"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTopicPrefix     = "frigabun"
+	defaultDiscoveryPrefix = "homeassistant"
+	defaultHealthInterval  = 30 * time.Second
+	// queueSize is the number of messages waiting for the broker before further ones are dropped.
+	queueSize = 256
+
+	online  = "online"
+	offline = "offline"
+)
+
+// Client publishes messages to the broker.
+type Client interface {
+	Publish(topic string, retained bool, payload []byte) error
+}
+
+// RecordState is published retained to <prefix>/record/<id>/state for every successfully published record.
+type RecordState struct {
+	FQDN       string              `json:"fqdn"`
+	Type       services.RecordType `json:"type"`
+	IP         string              `json:"ip"`
+	PreviousIP string              `json:"previous_ip,omitempty"`
+	Registrar  services.Registrar  `json:"registrar"`
+	Status     updater.Status      `json:"status"`
+	LastUpdate time.Time           `json:"last_update"`
+}
+
+// RegistrarState is published retained to <prefix>/registrar/<registrar>/state.
+type RegistrarState struct {
+	services.BreakerStatus
+	Healthy bool `json:"healthy"`
+}
+
+// Publisher mirrors the published records and the health of the registrars to MQTT, implementing updater.Listener.
+// With discovery enabled, Home Assistant creates sensors for them on its own. Messages are queued and sent in order
+// by a background goroutine, so a slow broker doesn't hold up updates.
+type Publisher struct {
+	client          Client
+	factory         factory.ServiceFactory
+	topicPrefix     string
+	discoveryPrefix string
+	discovery       bool
+
+	mu      sync.Mutex
+	records map[string]RecordState
+
+	queue chan publication
+	wg    sync.WaitGroup
+}
+
+// publication is a message waiting in the queue.
+type publication struct {
+	logger   zerolog.Logger
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+type Option func(*Publisher)
+
+// WithTopicPrefix sets the prefix of all state topics, frigabun by default.
+func WithTopicPrefix(prefix string) Option {
+	return func(p *Publisher) {
+		if len(prefix) > 0 {
+			p.topicPrefix = strings.TrimSuffix(prefix, "/")
+		}
+	}
+}
+
+// WithDiscovery publishes Home Assistant discovery configs below prefix, homeassistant by default.
+func WithDiscovery(prefix string) Option {
+	return func(p *Publisher) {
+		p.discovery = true
+		if len(prefix) > 0 {
+			p.discoveryPrefix = strings.TrimSuffix(prefix, "/")
+		}
+	}
+}
+
+func NewPublisher(client Client, serviceFactory factory.ServiceFactory, opts ...Option) *Publisher {
+	p := &Publisher{
+		client:          client,
+		factory:         serviceFactory,
+		topicPrefix:     defaultTopicPrefix,
+		discoveryPrefix: defaultDiscoveryPrefix,
+		records:         make(map[string]RecordState),
+		queue:           make(chan publication, queueSize),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	go p.drain()
+
+	return p
+}
+
+// AvailabilityTopic carries online while connected, the broker publishes offline as last will once the connection
+// is lost.
+func (p *Publisher) AvailabilityTopic() string {
+	return p.topicPrefix + "/status"
+}
+
+// Updated queues the state of the published records and the registrar health.
+func (p *Publisher) Updated(ctx context.Context, results []updater.Result) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Logger()
+	now := time.Now().UTC()
+
+	for _, result := range results {
+		if result.Failed() {
+			continue
+		}
+
+		state := RecordState{
+			FQDN:       result.FQDN(),
+			Type:       result.Type,
+			IP:         result.IP,
+			PreviousIP: result.PreviousIP,
+			Registrar:  result.Registrar,
+			Status:     result.Status,
+			LastUpdate: now,
+		}
+
+		id := recordID(state.FQDN, state.Type)
+
+		p.mu.Lock()
+		_, known := p.records[id]
+		p.records[id] = state
+		p.mu.Unlock()
+
+		if !known && p.discovery {
+			p.announceRecord(logger, id, state)
+		}
+
+		p.publishJSON(logger, p.recordTopic(id), state)
+	}
+
+	// a failed update may have opened a circuit breaker
+	p.PublishHealth(ctx)
+}
+
+// Connected announces the availability and all known entities, called on every (re)connect to the broker.
+func (p *Publisher) Connected() {
+	logger := log.Logger
+
+	p.publish(logger, p.AvailabilityTopic(), []byte(online))
+
+	if p.discovery {
+		for _, registrar := range p.factory.ListServices() {
+			p.announceRegistrar(logger, registrar)
+		}
+
+		p.mu.Lock()
+		records := make(map[string]RecordState, len(p.records))
+		for id, state := range p.records {
+			records[id] = state
+		}
+		p.mu.Unlock()
+
+		for id, state := range records {
+			p.announceRecord(logger, id, state)
+		}
+	}
+
+	p.PublishHealth(context.Background())
+}
+
+// PublishHealth publishes the circuit breaker state of every registrar.
+func (p *Publisher) PublishHealth(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Logger()
+
+	for _, registrar := range p.factory.ListServices() {
+		service, err := p.factory.Find(registrar)
+		if err != nil {
+			continue
+		}
+
+		state := RegistrarState{BreakerStatus: services.BreakerStatus{State: services.BreakerClosed}}
+		if breaker, ok := service.(services.Breaker); ok {
+			state.BreakerStatus = breaker.Breaker()
+		}
+		state.Healthy = state.State == services.BreakerClosed
+
+		p.publishJSON(logger, p.registrarTopic(registrar), state)
+	}
+}
+
+// Wait blocks until all queued messages are sent.
+func (p *Publisher) Wait() {
+	p.wg.Wait()
+}
+
+// Run publishes the registrar health every interval until ctx is done, then announces going offline.
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.PublishHealth(ctx)
+		case <-ctx.Done():
+			if err := p.client.Publish(p.AvailabilityTopic(), true, []byte(offline)); err != nil {
+				log.Error().Err(err).Msg("cannot publish availability")
+			}
+			return
+		}
+	}
+}
+
+func (p *Publisher) recordTopic(id string) string {
+	return p.topicPrefix + "/record/" + id + "/state"
+}
+
+func (p *Publisher) registrarTopic(registrar services.Registrar) string {
+	return p.topicPrefix + "/registrar/" + string(registrar) + "/state"
+}
+
+func (p *Publisher) publishJSON(logger zerolog.Logger, topic string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Error().Err(err).Str("topic", topic).Msg("cannot encode mqtt payload")
+		return
+	}
+
+	p.publish(logger, topic, b)
+}
+
+// publish queues a retained message, dropping it if the queue is full.
+func (p *Publisher) publish(logger zerolog.Logger, topic string, payload []byte) {
+	p.wg.Add(1)
+
+	select {
+	case p.queue <- publication{logger: logger, topic: topic, retained: true, payload: payload}:
+	default:
+		p.wg.Done()
+		logger.Warn().Str("topic", topic).Msg("mqtt queue full, dropping message")
+	}
+}
+
+// drain sends the queued messages.
+func (p *Publisher) drain() {
+	for m := range p.queue {
+		if err := p.client.Publish(m.topic, m.retained, m.payload); err != nil {
+			m.logger.Error().Err(err).Str("topic", m.topic).Msg("cannot publish to mqtt")
+		}
+
+		p.wg.Done()
+	}
+}
+
+// recordID derives an ID usable in topics and Home Assistant entity IDs, e.g. vpn_example_com_a. Names with
+// characters other than letters, digits and dots get a hash of the name appended, so a-b.example.com and
+// a_b.example.com don't share an ID.
+func recordID(fqdn string, recordType services.RecordType) string {
+	fqdn = strings.ToLower(fqdn)
+	lossy := false
+
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			return r
+		case r != '.':
+			lossy = true
+		}
+		return '_'
+	}, fqdn)
+
+	if lossy {
+		sum := sha256.Sum256([]byte(fqdn))
+		id += "_" + hex.EncodeToString(sum[:4])
+	}
+
+	return id + "_" + strings.ToLower(string(recordType))
+}
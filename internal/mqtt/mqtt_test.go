@@ -0,0 +1,263 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"sync"
+	"testing"
+	"time"
+)
+
+type message struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+type fakeClient struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (f *fakeClient) Publish(topic string, retained bool, payload []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, message{topic: topic, retained: retained, payload: string(payload)})
+	return nil
+}
+
+func (f *fakeClient) topics() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var topics []string
+	for _, m := range f.messages {
+		topics = append(topics, m.topic)
+	}
+	return topics
+}
+
+func (f *fakeClient) last(topic string) (message, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.messages) - 1; i >= 0; i-- {
+		if f.messages[i].topic == topic {
+			return f.messages[i], true
+		}
+	}
+	return message{}, false
+}
+
+// setupFactory registers cloudflare behind a circuit breaker opening after a single failure.
+func setupFactory(t *testing.T) (*mockfactory.MockServiceFactory, *services.CircuitBreaker) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("Registrar").Return(services.Registrar("cloudflare")).Maybe()
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, services.ErrRegistrarUnavailable).Maybe()
+
+	breaker := services.NewCircuitBreaker(cs)
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.On("ListServices").Return([]services.Registrar{"cloudflare"}).Maybe()
+	sf.On("Find", services.Registrar("cloudflare")).Return(breaker, nil).Maybe()
+
+	return sf, breaker
+}
+
+var updated = updater.Result{Registrar: "cloudflare", Domain: "example.com", Subdomain: "vpn", Type: services.RecordTypeA, IP: "203.0.113.7", PreviousIP: "203.0.113.6", Status: updater.StatusUpdated}
+
+func TestUpdatedPublishesRecordState(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &fakeClient{}
+	p := NewPublisher(client, sf)
+
+	p.Updated(context.Background(), []updater.Result{updated,
+		{Registrar: "cloudflare", Domain: "example.com", Type: services.RecordTypeA, IP: "203.0.113.7", Status: updater.StatusFailed}})
+	p.Wait()
+
+	m, ok := client.last("frigabun/record/vpn_example_com_a/state")
+	if assert.True(t, ok) {
+		assert.True(t, m.retained)
+
+		var state RecordState
+		assert.Nil(t, json.Unmarshal([]byte(m.payload), &state))
+		assert.Equal(t, "vpn.example.com", state.FQDN)
+		assert.Equal(t, "203.0.113.7", state.IP)
+		assert.Equal(t, "203.0.113.6", state.PreviousIP)
+		assert.False(t, state.LastUpdate.IsZero())
+	}
+
+	_, ok = client.last("frigabun/record/example_com_a/state")
+	assert.False(t, ok, "failed records should not be published")
+
+	m, ok = client.last("frigabun/registrar/cloudflare/state")
+	if assert.True(t, ok) {
+		assert.JSONEq(t, `{"state":"closed","consecutive_failures":0,"healthy":true}`, m.payload)
+	}
+
+	for _, topic := range client.topics() {
+		assert.NotContains(t, topic, "homeassistant", "discovery is disabled")
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &fakeClient{}
+	p := NewPublisher(client, sf, WithDiscovery(""), WithTopicPrefix("home/frigabun/"))
+
+	p.Updated(context.Background(), []updater.Result{updated})
+	p.Updated(context.Background(), []updater.Result{updated})
+	p.Wait()
+
+	count := 0
+	for _, topic := range client.topics() {
+		if topic == "homeassistant/sensor/frigabun/vpn_example_com_a_ip/config" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count, "records should be announced once")
+
+	m, ok := client.last("homeassistant/sensor/frigabun/vpn_example_com_a_ip/config")
+	if assert.True(t, ok) {
+		var config discoveryConfig
+		assert.Nil(t, json.Unmarshal([]byte(m.payload), &config))
+		assert.Equal(t, "frigabun_vpn_example_com_a_ip", config.UniqueID)
+		assert.Equal(t, "home/frigabun/record/vpn_example_com_a/state", config.StateTopic)
+		assert.Equal(t, "home/frigabun/status", config.AvailabilityTopic)
+		assert.Equal(t, "{{ value_json.ip }}", config.ValueTemplate)
+	}
+
+	m, ok = client.last("homeassistant/sensor/frigabun/vpn_example_com_a_last_update/config")
+	if assert.True(t, ok) {
+		assert.Contains(t, m.payload, `"device_class":"timestamp"`)
+	}
+}
+
+func TestConnectedAnnouncesAvailability(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &fakeClient{}
+	p := NewPublisher(client, sf, WithDiscovery("ha"))
+
+	p.Updated(context.Background(), []updater.Result{updated})
+	p.Wait()
+
+	// a reconnect announces everything again, in case the broker lost its retained messages
+	client.messages = nil
+	p.Connected()
+	p.Wait()
+
+	m, ok := client.last("frigabun/status")
+	if assert.True(t, ok) {
+		assert.Equal(t, "online", m.payload)
+		assert.True(t, m.retained)
+	}
+
+	assert.Contains(t, client.topics(), "ha/binary_sensor/frigabun/registrar_cloudflare/config")
+	assert.Contains(t, client.topics(), "ha/sensor/frigabun/vpn_example_com_a_ip/config")
+	assert.Contains(t, client.topics(), "frigabun/registrar/cloudflare/state")
+}
+
+func TestPublishHealthOpenBreaker(t *testing.T) {
+	sf, breaker := setupFactory(t)
+	client := &fakeClient{}
+	p := NewPublisher(client, sf)
+
+	for range 5 {
+		_, _ = breaker.UpdateRecord(context.Background(), &services.DynDnsRequest{})
+	}
+
+	p.PublishHealth(context.Background())
+	p.Wait()
+
+	m, ok := client.last("frigabun/registrar/cloudflare/state")
+	if assert.True(t, ok) {
+		var state RegistrarState
+		assert.Nil(t, json.Unmarshal([]byte(m.payload), &state))
+		assert.Equal(t, services.BreakerOpen, state.State)
+		assert.False(t, state.Healthy)
+		assert.NotNil(t, state.RetryAt)
+	}
+}
+
+func TestRunPublishesOfflineOnShutdown(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &fakeClient{}
+	p := NewPublisher(client, sf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx, 0)
+
+	m, ok := client.last("frigabun/status")
+	if assert.True(t, ok) {
+		assert.Equal(t, "offline", m.payload)
+	}
+}
+
+func TestRecordID(t *testing.T) {
+	assert.Equal(t, "vpn_example_com_aaaa", recordID("VPN.example.com", services.RecordTypeAAAA))
+	assert.Regexp(t, "^my_host_example_com_[0-9a-f]{8}_a$", recordID("my-host.example.com", services.RecordTypeA))
+	assert.NotEqual(t, recordID("a-b.example.com", services.RecordTypeA), recordID("a_b.example.com", services.RecordTypeA))
+	assert.NotEqual(t, recordID("a-b.example.com", services.RecordTypeA), recordID("a.b.example.com", services.RecordTypeA))
+	assert.Equal(t, recordID("A-b.example.com", services.RecordTypeA), recordID("a-b.example.com", services.RecordTypeA))
+}
+
+// blockingClient holds every publish until released.
+type blockingClient struct {
+	fakeClient
+	release chan struct{}
+}
+
+func (b *blockingClient) Publish(topic string, retained bool, payload []byte) error {
+	<-b.release
+	return b.fakeClient.Publish(topic, retained, payload)
+}
+
+func TestUpdatedDoesNotWaitForBroker(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &blockingClient{release: make(chan struct{})}
+	p := NewPublisher(client, sf)
+
+	done := make(chan struct{})
+	go func() {
+		p.Updated(context.Background(), []updater.Result{updated})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Updated blocked on the broker")
+	}
+
+	close(client.release)
+	p.Wait()
+
+	assert.Equal(t, []string{"frigabun/record/vpn_example_com_a/state", "frigabun/registrar/cloudflare/state"},
+		client.topics(), "messages should be sent in order")
+}
+
+func TestFullQueueDropsMessages(t *testing.T) {
+	sf, _ := setupFactory(t)
+	client := &blockingClient{release: make(chan struct{})}
+	p := NewPublisher(client, sf)
+
+	// one message is held by the client, the others fill the queue
+	for range queueSize + 10 {
+		p.PublishHealth(context.Background())
+	}
+
+	close(client.release)
+	p.Wait()
+
+	count := len(client.topics())
+	assert.GreaterOrEqual(t, count, queueSize)
+	assert.LessOrEqual(t, count, queueSize+1)
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultChannelTimeout = 10 * time.Second
+
+// ChannelConfig configures a notification channel. Which fields are required depends on the type:
+//   - ntfy: url of the topic, optional token and priority
+//   - gotify: url of the server, token of the application, optional priority
+//   - matrix: url of the homeserver, room id and access token
+//   - smtp: host, port, from and to, optional username and password
+type ChannelConfig struct {
+	Name       string        `mapstructure:"name"`
+	Type       string        `mapstructure:"type"`
+	Severities []Severity    `mapstructure:"severities"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+
+	URL      string `mapstructure:"url"`
+	Token    string `mapstructure:"token"`
+	Priority int    `mapstructure:"priority"`
+	Room     string `mapstructure:"room"`
+
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// NewChannel creates the channel of the configured type.
+func NewChannel(config ChannelConfig) (Channel, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultChannelTimeout
+	}
+
+	client := &http.Client{Timeout: config.Timeout}
+
+	switch config.Type {
+	case "ntfy":
+		return NewNtfyChannel(config.URL, config.Token, config.Priority, client)
+	case "gotify":
+		return NewGotifyChannel(config.URL, config.Token, config.Priority, client)
+	case "matrix":
+		return NewMatrixChannel(config.URL, config.Room, config.Token, client)
+	case "smtp":
+		return NewSMTPChannel(config.Host, config.Port, config.Username, config.Password, config.From, config.To,
+			config.Timeout)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChannelType, config.Type)
+	}
+}
+
+// checkResponse fails for responses other than 2xx, including the start of the body for troubleshooting.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	return fmt.Errorf("%w with status %d: %s", ErrChannelRejected, resp.StatusCode, b)
+}
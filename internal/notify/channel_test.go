@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var failure = Message{Severity: SeverityFailure, Title: "DNS update failed", Body: "foo.org (A) via gandi: registrar rejected request"}
+
+func TestNtfyChannel(t *testing.T) {
+	var req *http.Request
+	var body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req, body = r, string(b)
+	}))
+	defer server.Close()
+
+	ch, err := NewNtfyChannel(server.URL+"/frigabun", "tk_foo", 0, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ch.Send(context.Background(), failure))
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/frigabun", req.URL.Path)
+	assert.Equal(t, "DNS update failed", req.Header.Get("Title"))
+	assert.Equal(t, "4", req.Header.Get("Priority"))
+	assert.Equal(t, "Bearer tk_foo", req.Header.Get("Authorization"))
+	assert.Equal(t, failure.Body, body)
+}
+
+func TestGotifyChannel(t *testing.T) {
+	var req *http.Request
+	var message gotifyMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		_ = json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer server.Close()
+
+	ch, err := NewGotifyChannel(server.URL+"/", "app-token", 0, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ch.Send(context.Background(), failure))
+
+	assert.Equal(t, "/message", req.URL.Path)
+	assert.Equal(t, "app-token", req.Header.Get("X-Gotify-Key"))
+	assert.Equal(t, gotifyMessage{Title: failure.Title, Message: failure.Body, Priority: 8}, message)
+}
+
+func TestMatrixChannel(t *testing.T) {
+	var req *http.Request
+	var message matrixMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		_, _ = w.Write([]byte(`{"event_id":"$foo"}`))
+	}))
+	defer server.Close()
+
+	ch, err := NewMatrixChannel(server.URL, "!room:foo.com", "syt_foo", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ch.Send(context.Background(), failure))
+
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.True(t, strings.HasPrefix(req.URL.EscapedPath(),
+		"/_matrix/client/v3/rooms/%21room:foo.com/send/m.room.message/frigabun-"), req.URL.EscapedPath())
+	assert.Equal(t, "Bearer syt_foo", req.Header.Get("Authorization"))
+	assert.Equal(t, matrixMessage{MsgType: "m.text", Body: failure.Title + "\n" + failure.Body}, message)
+}
+
+func TestHTTPChannelRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"unauthorized"}`))
+	}))
+	defer server.Close()
+
+	ch, _ := NewGotifyChannel(server.URL, "wrong", 0, server.Client())
+
+	err := ch.Send(context.Background(), failure)
+	assert.ErrorIs(t, err, ErrChannelRejected)
+	assert.ErrorContains(t, err, "unauthorized")
+}
+
+// smtpServer accepts a single mail, answering every command positively, and returns the commands and data received.
+func smtpServer(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		defer func() { received <- lines }()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					data = strings.TrimRight(data, "\r\n")
+					if data == "." {
+						break
+					}
+					lines = append(lines, data)
+				}
+				reply("250 queued")
+			case line == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPChannel(t *testing.T) {
+	port, received := smtpServer(t)
+
+	ch, err := NewSMTPChannel("127.0.0.1", port, "", "", "frigabun@foo.com",
+		[]string{"admin@foo.com", "oncall@foo.com"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, ch.Send(context.Background(), failure))
+
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<frigabun@foo.com>")
+	assert.Contains(t, lines, "RCPT TO:<admin@foo.com>")
+	assert.Contains(t, lines, "RCPT TO:<oncall@foo.com>")
+	assert.Contains(t, lines, "Subject: DNS update failed")
+	assert.Contains(t, lines, "To: admin@foo.com, oncall@foo.com")
+	assert.Contains(t, lines, failure.Body)
+}
+
+func TestSMTPChannelLineEndings(t *testing.T) {
+	ch, err := NewSMTPChannel("127.0.0.1", 25, "", "", "frigabun@foo.com", []string{"admin@foo.com"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := string(ch.compose(Message{Title: "test", Body: "unix\nwindows\r\nend"}))
+
+	assert.True(t, strings.HasSuffix(mail, "\r\n\r\nunix\r\nwindows\r\nend\r\n"), mail)
+	assert.NotContains(t, mail, "\r\r")
+}
+
+func TestNewChannelMissingInfo(t *testing.T) {
+	for _, config := range []ChannelConfig{
+		{Type: "ntfy"},
+		{Type: "gotify", URL: "https://gotify.foo.com"},
+		{Type: "matrix", URL: "https://matrix.org", Room: "!room:foo.com"},
+		{Type: "smtp", Host: "mail.foo.com", Port: 587, From: "frigabun@foo.com"},
+	} {
+		t.Run(config.Type+"/"+strconv.Itoa(config.Port), func(t *testing.T) {
+			ch, err := NewChannel(config)
+			assert.ErrorIs(t, err, ErrMissingChannelInfo)
+			assert.Nil(t, ch)
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package notify
+
+import "errors"
+
+var (
+	ErrUnknownChannelType = errors.New("unknown notification channel type")
+	ErrMissingChannelInfo = errors.New("missing config param for notification channel")
+	ErrInvalidSeverity    = errors.New("invalid severity, must be change or failure")
+	ErrInvalidTemplate    = errors.New("invalid notification template")
+	ErrChannelRejected    = errors.New("notification channel rejected message")
+)
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// GotifyChannel pushes messages to a Gotify server as an application.
+type GotifyChannel struct {
+	url      string
+	token    string
+	priority int
+	client   *http.Client
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// NewGotifyChannel pushes to the server at url with the token of an application. Failures are sent with at least
+// priority 8 if no priority is configured.
+func NewGotifyChannel(url string, token string, priority int, client *http.Client) (*GotifyChannel, error) {
+	if len(url) == 0 || len(token) == 0 {
+		return nil, ErrMissingChannelInfo
+	}
+
+	return &GotifyChannel{url: strings.TrimSuffix(url, "/"), token: token, priority: priority, client: client}, nil
+}
+
+func (g *GotifyChannel) Send(ctx context.Context, message Message) error {
+	priority := g.priority
+	if priority == 0 {
+		priority = 5
+		if message.Severity == SeverityFailure {
+			priority = 8
+		}
+	}
+
+	b, err := json.Marshal(gotifyMessage{Title: message.Title, Message: message.Body, Priority: priority})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url+"/message", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MatrixChannel sends messages to a Matrix room as the user of the access token.
+type MatrixChannel struct {
+	homeserver  string
+	room        string
+	accessToken string
+	client      *http.Client
+}
+
+type matrixMessage struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+// NewMatrixChannel sends to the room with the given id, e.g. !abc:matrix.org, which the user has to be a member of.
+func NewMatrixChannel(homeserver string, room string, accessToken string, client *http.Client) (*MatrixChannel, error) {
+	if len(homeserver) == 0 || len(room) == 0 || len(accessToken) == 0 {
+		return nil, ErrMissingChannelInfo
+	}
+
+	return &MatrixChannel{homeserver: strings.TrimSuffix(homeserver, "/"), room: room, accessToken: accessToken,
+		client: client}, nil
+}
+
+func (m *MatrixChannel) Send(ctx context.Context, message Message) error {
+	b, err := json.Marshal(matrixMessage{MsgType: "m.text", Body: message.Title + "\n" + message.Body})
+	if err != nil {
+		return err
+	}
+
+	endpoint := m.homeserver + "/_matrix/client/v3/rooms/" + url.PathEscape(m.room) + "/send/m.room.message/" +
+		transactionID()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+// transactionID returns a unique ID, letting the homeserver deduplicate retried requests.
+func transactionID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+
+	return "frigabun-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,351 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Severity classifies notifications, channels subscribe to the severities they are routed.
+type Severity string
+
+const (
+	// SeverityChange is sent for records whose value was created or changed.
+	SeverityChange Severity = "change"
+	// SeverityFailure is sent for records that couldn't be published.
+	SeverityFailure Severity = "failure"
+)
+
+const defaultThrottle = 10 * time.Minute
+
+var defaultTemplates = map[Severity]Template{
+	SeverityChange: {
+		Title: "DNS records updated",
+		Body: `{{range .Records}}{{.FQDN}} ({{.Type}}): {{with .PreviousIP}}{{.}} -> {{end}}{{.IP}}
+{{end}}{{if .Suppressed}}{{.Suppressed}} earlier notifications were suppressed
+{{end}}`,
+	},
+	SeverityFailure: {
+		Title: "DNS update failed",
+		Body: `{{range .Records}}{{.FQDN}} ({{.Type}}) via {{.Registrar}}: {{.Error}}
+{{end}}{{if .Suppressed}}{{.Suppressed}} earlier notifications were suppressed
+{{end}}`,
+	},
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Severity Severity
+	Title    string
+	Body     string
+}
+
+// Channel delivers messages to a notification service.
+type Channel interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Template holds the Go templates of title and body, executed with a Notification.
+type Template struct {
+	Title string `mapstructure:"title"`
+	Body  string `mapstructure:"body"`
+}
+
+// Notification is the data templates are executed with.
+type Notification struct {
+	Severity Severity
+	Records  []updater.Result
+	// Suppressed is the number of notifications about these records dropped by throttling since the last one sent.
+	Suppressed int
+	updater.Origin
+}
+
+type channel struct {
+	name       string
+	severities []Severity
+	Channel
+}
+
+type templates struct {
+	title *template.Template
+	body  *template.Template
+}
+
+type throttleKey struct {
+	channel  string
+	severity Severity
+	record   string
+}
+
+type throttleEntry struct {
+	sent       time.Time
+	suppressed int
+}
+
+// Notifier sends human-readable notifications about changed and failed records to the channels routed the
+// respective severity, implementing updater.Listener. Notifications about a record are sent at most once per
+// throttle window and channel, so a flapping connection doesn't flood the channels.
+type Notifier struct {
+	channels  []channel
+	templates map[Severity]templates
+	throttle  time.Duration
+
+	mu        sync.Mutex
+	throttled map[throttleKey]*throttleEntry
+
+	wg sync.WaitGroup
+}
+
+type Option func(*Notifier) error
+
+// WithChannel routes notifications of the given severities, or all if none are given, to a channel.
+func WithChannel(name string, ch Channel, severities ...Severity) Option {
+	return func(n *Notifier) error {
+		if len(severities) == 0 {
+			severities = []Severity{SeverityChange, SeverityFailure}
+		}
+
+		for _, severity := range severities {
+			if _, ok := defaultTemplates[severity]; !ok {
+				return fmt.Errorf("%w: %s", ErrInvalidSeverity, severity)
+			}
+		}
+
+		n.channels = append(n.channels, channel{name: name, severities: severities, Channel: ch})
+		return nil
+	}
+}
+
+// WithTemplate replaces the default template of a severity. Empty title or body keep their default.
+func WithTemplate(severity Severity, tmpl Template) Option {
+	return func(n *Notifier) error {
+		if _, ok := defaultTemplates[severity]; !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidSeverity, severity)
+		}
+
+		if len(tmpl.Title) == 0 {
+			tmpl.Title = defaultTemplates[severity].Title
+		}
+		if len(tmpl.Body) == 0 {
+			tmpl.Body = defaultTemplates[severity].Body
+		}
+
+		parsed, err := parseTemplate(tmpl)
+		if err != nil {
+			return err
+		}
+
+		n.templates[severity] = parsed
+		return nil
+	}
+}
+
+// WithThrottle sets the window notifications about the same record are throttled for, 0 disables throttling.
+func WithThrottle(throttle time.Duration) Option {
+	return func(n *Notifier) error {
+		n.throttle = throttle
+		return nil
+	}
+}
+
+func New(opts ...Option) (*Notifier, error) {
+	n := &Notifier{
+		templates: make(map[Severity]templates),
+		throttle:  defaultThrottle,
+		throttled: make(map[throttleKey]*throttleEntry),
+	}
+
+	for severity, tmpl := range defaultTemplates {
+		parsed, err := parseTemplate(tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		n.templates[severity] = parsed
+	}
+
+	for _, opt := range opts {
+		if err := opt(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// Load creates the channels configured in notify.channels, with templates and throttling from the notify section.
+func Load() (*Notifier, error) {
+	var configs []ChannelConfig
+
+	err := viper.UnmarshalKey("notify.channels", &configs)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []Option
+
+	for _, config := range configs {
+		ch, err := NewChannel(config)
+		if err != nil {
+			return nil, err
+		}
+
+		name := config.Name
+		if len(name) == 0 {
+			name = config.Type
+		}
+
+		log.Debug().Str("channel", name).Str("type", config.Type).Msg("registered notification channel")
+		opts = append(opts, WithChannel(name, ch, config.Severities...))
+	}
+
+	for _, severity := range []Severity{SeverityChange, SeverityFailure} {
+		var tmpl Template
+		if err := viper.UnmarshalKey("notify.templates."+string(severity), &tmpl); err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithTemplate(severity, tmpl))
+	}
+
+	if viper.IsSet("notify.throttle") {
+		opts = append(opts, WithThrottle(viper.GetDuration("notify.throttle")))
+	}
+
+	return New(opts...)
+}
+
+func (n *Notifier) Updated(ctx context.Context, results []updater.Result) {
+	if len(n.channels) == 0 {
+		return
+	}
+
+	records := make(map[Severity][]updater.Result)
+	for _, result := range results {
+		switch {
+		case result.Changed():
+			records[SeverityChange] = append(records[SeverityChange], result)
+		case result.Failed():
+			records[SeverityFailure] = append(records[SeverityFailure], result)
+		}
+	}
+
+	origin := updater.OriginFrom(ctx)
+
+	// notifications outlive the request, but keep its logger and trace
+	ctx = context.WithoutCancel(ctx)
+
+	for _, ch := range n.channels {
+		for _, severity := range ch.severities {
+			if len(records[severity]) == 0 {
+				continue
+			}
+
+			notification := n.admit(ch.name, severity, records[severity])
+			if len(notification.Records) == 0 {
+				continue
+			}
+
+			notification.Origin = origin
+
+			n.wg.Add(1)
+			go func() {
+				defer n.wg.Done()
+				n.send(ctx, ch, notification)
+			}()
+		}
+	}
+}
+
+// Wait blocks until all pending notifications are sent.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+// admit drops records notified about within the throttle window, counting them for the next notification.
+func (n *Notifier) admit(channel string, severity Severity, records []updater.Result) Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	notification := Notification{Severity: severity}
+	now := time.Now()
+
+	for _, record := range records {
+		key := throttleKey{channel: channel, severity: severity, record: record.FQDN() + "/" + string(record.Type)}
+
+		entry, ok := n.throttled[key]
+		if !ok {
+			entry = &throttleEntry{}
+			n.throttled[key] = entry
+		}
+
+		if ok && now.Sub(entry.sent) < n.throttle {
+			entry.suppressed++
+			continue
+		}
+
+		notification.Records = append(notification.Records, record)
+		notification.Suppressed += entry.suppressed
+		entry.sent = now
+		entry.suppressed = 0
+	}
+
+	return notification
+}
+
+func (n *Notifier) send(ctx context.Context, ch channel, notification Notification) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("channel", ch.name).
+		Str("severity", string(notification.Severity)).Logger()
+
+	message, err := n.templates[notification.Severity].render(notification)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot render notification")
+		return
+	}
+
+	if err := ch.Send(ctx, message); err != nil {
+		logger.Error().Err(err).Msg("cannot send notification")
+		return
+	}
+
+	logger.Info().Int("records", len(notification.Records)).Msg("notification sent")
+}
+
+func parseTemplate(tmpl Template) (templates, error) {
+	title, err := template.New("title").Parse(tmpl.Title)
+	if err != nil {
+		return templates{}, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+
+	body, err := template.New("body").Parse(tmpl.Body)
+	if err != nil {
+		return templates{}, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+
+	return templates{title: title, body: body}, nil
+}
+
+func (t templates) render(notification Notification) (Message, error) {
+	var title, body strings.Builder
+
+	if err := t.title.Execute(&title, notification); err != nil {
+		return Message{}, err
+	}
+
+	if err := t.body.Execute(&body, notification); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Severity: notification.Severity,
+		Title:    strings.TrimSpace(title.String()),
+		Body:     strings.TrimSpace(body.String()),
+	}, nil
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingChannel struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (r *recordingChannel) Send(_ context.Context, message Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *recordingChannel) received() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Message(nil), r.messages...)
+}
+
+var (
+	changed   = updater.Result{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "vpn", Type: services.RecordTypeA, IP: "203.0.113.7", PreviousIP: "203.0.113.6", Status: updater.StatusUpdated}
+	unchanged = updater.Result{Registrar: "cloudflare", Domain: "foo.com", Type: services.RecordTypeA, IP: "203.0.113.7", Status: updater.StatusUnchanged}
+	failed    = updater.Result{Registrar: "gandi", Domain: "foo.org", Type: services.RecordTypeA, IP: "203.0.113.7", Status: updater.StatusFailed, Error: "registrar rejected request"}
+)
+
+func notify(n *Notifier, results ...updater.Result) {
+	n.Updated(context.Background(), results)
+	n.Wait()
+}
+
+func TestNotifierRoutesBySeverity(t *testing.T) {
+	all, changes, failures := &recordingChannel{}, &recordingChannel{}, &recordingChannel{}
+
+	n, err := New(WithChannel("all", all), WithChannel("changes", changes, SeverityChange),
+		WithChannel("failures", failures, SeverityFailure))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notify(n, changed, unchanged, failed)
+
+	assert.Len(t, all.received(), 2)
+
+	if assert.Len(t, changes.received(), 1) {
+		message := changes.received()[0]
+		assert.Equal(t, SeverityChange, message.Severity)
+		assert.Equal(t, "DNS records updated", message.Title)
+		assert.Equal(t, "vpn.foo.com (A): 203.0.113.6 -> 203.0.113.7", message.Body)
+	}
+
+	if assert.Len(t, failures.received(), 1) {
+		message := failures.received()[0]
+		assert.Equal(t, SeverityFailure, message.Severity)
+		assert.Equal(t, "foo.org (A) via gandi: registrar rejected request", message.Body)
+	}
+}
+
+func TestNotifierTemplates(t *testing.T) {
+	ch := &recordingChannel{}
+
+	n, err := New(WithChannel("chat", ch),
+		WithTemplate(SeverityChange, Template{Body: "{{range .Records}}{{.FQDN}}={{.IP}} {{end}}by {{.Credential}}"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := updater.WithOrigin(context.Background(), updater.Origin{Credential: "fritzbox"})
+	n.Updated(ctx, []updater.Result{changed})
+	n.Wait()
+
+	if assert.Len(t, ch.received(), 1) {
+		assert.Equal(t, "DNS records updated", ch.received()[0].Title, "title should keep its default")
+		assert.Equal(t, "vpn.foo.com=203.0.113.7 by fritzbox", ch.received()[0].Body)
+	}
+}
+
+func TestNotifierThrottles(t *testing.T) {
+	ch := &recordingChannel{}
+
+	n, err := New(WithChannel("phone", ch), WithThrottle(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notify(n, changed)
+	notify(n, changed)
+	notify(n, changed)
+	assert.Len(t, ch.received(), 1, "repeated changes of a record should be throttled")
+
+	other := changed
+	other.Subdomain = "nas"
+	notify(n, other)
+	assert.Len(t, ch.received(), 2, "other records should not be throttled")
+
+	// pretend the window has passed
+	n.mu.Lock()
+	for _, entry := range n.throttled {
+		entry.sent = entry.sent.Add(-time.Hour)
+	}
+	n.mu.Unlock()
+
+	notify(n, changed)
+
+	messages := ch.received()
+	if assert.Len(t, messages, 3) {
+		assert.Contains(t, messages[2].Body, "2 earlier notifications were suppressed")
+	}
+}
+
+func TestNotifierThrottleDisabled(t *testing.T) {
+	ch := &recordingChannel{}
+
+	n, err := New(WithChannel("phone", ch), WithThrottle(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notify(n, changed)
+	notify(n, changed)
+
+	assert.Len(t, ch.received(), 2)
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	_, err := New(WithChannel("phone", &recordingChannel{}, "warning"))
+	assert.ErrorIs(t, err, ErrInvalidSeverity)
+
+	_, err = New(WithTemplate(SeverityFailure, Template{Title: "{{.Severity"}))
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+}
+
+func TestLoad(t *testing.T) {
+	viper.SetConfigType("toml")
+	err := viper.ReadConfig(strings.NewReader(`
+[notify]
+throttle = "5m"
+
+[notify.templates.failure]
+title = "frigabun: {{len .Records}} failed"
+
+[[notify.channels]]
+name = "phone"
+type = "ntfy"
+url = "https://ntfy.sh/frigabun"
+severities = ["failure"]
+
+[[notify.channels]]
+type = "smtp"
+host = "mail.foo.com"
+from = "frigabun@foo.com"
+to = ["admin@foo.com"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+
+	n, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 5*time.Minute, n.throttle)
+
+	if assert.Len(t, n.channels, 2) {
+		assert.Equal(t, "phone", n.channels[0].name)
+		assert.Equal(t, []Severity{SeverityFailure}, n.channels[0].severities)
+		assert.IsType(t, &NtfyChannel{}, n.channels[0].Channel)
+
+		assert.Equal(t, "smtp", n.channels[1].name)
+		assert.IsType(t, &SMTPChannel{}, n.channels[1].Channel)
+	}
+
+	message, err := n.templates[SeverityFailure].render(Notification{Severity: SeverityFailure,
+		Records: []updater.Result{failed}})
+	assert.Nil(t, err)
+	assert.Equal(t, "frigabun: 1 failed", message.Title)
+	assert.Equal(t, "foo.org (A) via gandi: registrar rejected request", message.Body)
+}
+
+func TestLoadUnknownChannelType(t *testing.T) {
+	viper.Set("notify.channels", []map[string]any{{"type": "pager"}})
+	t.Cleanup(viper.Reset)
+
+	_, err := Load()
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+}
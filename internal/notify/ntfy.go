@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NtfyChannel publishes messages to a topic of an ntfy server.
+type NtfyChannel struct {
+	url      string
+	token    string
+	priority int
+	client   *http.Client
+}
+
+// NewNtfyChannel publishes to the topic at url, e.g. https://ntfy.sh/mytopic. Failures are sent with at least high
+// priority if no priority is configured.
+func NewNtfyChannel(url string, token string, priority int, client *http.Client) (*NtfyChannel, error) {
+	if len(url) == 0 {
+		return nil, ErrMissingChannelInfo
+	}
+
+	return &NtfyChannel{url: url, token: token, priority: priority, client: client}, nil
+}
+
+func (n *NtfyChannel) Send(ctx context.Context, message Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(message.Body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Title", message.Title)
+
+	priority := n.priority
+	if priority == 0 && message.Severity == SeverityFailure {
+		priority = 4
+	}
+	if priority > 0 {
+		req.Header.Set("Priority", strconv.Itoa(priority))
+	}
+
+	if message.Severity == SeverityFailure {
+		req.Header.Set("Tags", "warning")
+	} else {
+		req.Header.Set("Tags", "globe_with_meridians")
+	}
+
+	if len(n.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPChannel sends messages as plain text email.
+type SMTPChannel struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+	timeout  time.Duration
+}
+
+// NewSMTPChannel sends via the server at host and port. Port 465 uses implicit TLS, other ports upgrade via
+// STARTTLS if the server supports it. Without username, no authentication is attempted.
+func NewSMTPChannel(host string, port int, username string, password string, from string, to []string,
+	timeout time.Duration) (*SMTPChannel, error) {
+	if len(host) == 0 || len(from) == 0 || len(to) == 0 {
+		return nil, ErrMissingChannelInfo
+	}
+
+	if port == 0 {
+		port = 587
+	}
+
+	return &SMTPChannel{host: host, port: port, username: username, password: password, from: from, to: to,
+		timeout: timeout}, nil
+}
+
+func (s *SMTPChannel) Send(ctx context.Context, message Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp doesn't take a context, the deadline of the connection bounds the whole conversation
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := s.send(client, message); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (s *SMTPChannel) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+
+	if s.port == 465 {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: s.host}}
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+func (s *SMTPChannel) send(client *smtp.Client, message Message) error {
+	if ok, _ := client.Extension("STARTTLS"); ok && s.port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+
+	if len(s.username) > 0 {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(s.compose(message)); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+func (s *SMTPChannel) compose(message Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	// normalize first, bodies may already contain CRLF line endings
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,8 @@
+package records
+
+import "errors"
+
+var (
+	ErrNoHostnames     = errors.New("no hostnames configured")
+	ErrInvalidHostname = errors.New("invalid hostname, must be fully qualified")
+)
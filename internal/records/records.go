@@ -0,0 +1,138 @@
+package records
+
+import (
+	"context"
+	"github.com/asaskevich/govalidator"
+	"github.com/davidramiro/frigabun/internal/ipv6"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services/factory"
+	"github.com/rs/zerolog"
+	"net/netip"
+	"strings"
+)
+
+type record struct {
+	registrar services.Registrar
+	domain    string
+	subdomain string
+}
+
+// Records publishes addresses detected by frigabun itself, rather than pushed by a client, to a fixed list of
+// hostnames. Hostnames are mapped to registrars by the domains configured for each registrar.
+type Records struct {
+	factory   factory.ServiceFactory
+	updater   *updater.Updater
+	ipv6Hosts map[string]netip.Addr
+	records   []record
+}
+
+type Option func(*Records)
+
+// WithIPv6Hosts sets the interface identifiers by subdomain that get combined with a delegated IPv6 prefix.
+func WithIPv6Hosts(hosts map[string]netip.Addr) Option {
+	return func(r *Records) {
+		r.ipv6Hosts = hosts
+	}
+}
+
+// New resolves the registrar of every hostname, failing for hostnames no registrar is configured for.
+func New(serviceFactory factory.ServiceFactory, u *updater.Updater, hostnames []string, opts ...Option) (*Records, error) {
+	if len(hostnames) == 0 {
+		return nil, ErrNoHostnames
+	}
+
+	r := &Records{factory: serviceFactory, updater: u}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	for _, hostname := range hostnames {
+		if !govalidator.IsDNSName(hostname) || !strings.Contains(hostname, ".") {
+			return nil, ErrInvalidHostname
+		}
+
+		registrar, domain, err := serviceFactory.ResolveDomain(hostname)
+		if err != nil {
+			return nil, err
+		}
+
+		r.records = append(r.records, record{registrar: registrar, domain: domain, subdomain: Subdomain(hostname, domain)})
+	}
+
+	return r, nil
+}
+
+// Publish updates the records of the address families given, e.g. only the AAAA records for an IPv6 address.
+// source names the component the addresses were detected by.
+func (r *Records) Publish(ctx context.Context, source string, addresses ...netip.Addr) []updater.Result {
+	return r.PublishPrefix(ctx, source, netip.Prefix{}, addresses...)
+}
+
+// PublishPrefix works like Publish, but points the AAAA records of subdomains with a configured interface
+// identifier to the host's address within the delegated prefix instead.
+func (r *Records) PublishPrefix(ctx context.Context, source string, prefix netip.Prefix, addresses ...netip.Addr) []updater.Result {
+	var jobs []updater.Job
+
+	for _, rec := range r.records {
+		service, err := r.factory.Find(rec.registrar)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Ctx(ctx).Err(err).Str("registrar", string(rec.registrar)).
+				Msg("getting registrar from factory failed")
+			continue
+		}
+
+		for _, addr := range AddressesFor(ctx, r.ipv6Hosts, rec.subdomain, addresses, prefix) {
+			addr = addr.Unmap()
+
+			jobs = append(jobs, updater.Job{
+				Registrar: rec.registrar,
+				Service:   service,
+				Request: &services.DynDnsRequest{
+					IP:        addr.String(),
+					Type:      services.RecordTypeFor(addr),
+					Domain:    rec.domain,
+					Subdomain: rec.subdomain,
+				},
+			})
+		}
+	}
+
+	return r.updater.Update(updater.WithOrigin(ctx, updater.Origin{Source: source}), jobs)
+}
+
+// Subdomain returns the part of hostname below domain, empty for the apex.
+func Subdomain(hostname string, domain string) string {
+	subdomain := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(hostname), "."), domain)
+	return strings.TrimSuffix(subdomain, ".")
+}
+
+// AddressesFor returns the addresses to publish for a subdomain. If the subdomain has an interface identifier in
+// ipv6Hosts, its AAAA record points to the host's address within the delegated prefix instead. Without prefix, only
+// its IPv4 address is published, as the IPv6 address belongs to the router rather than the host.
+func AddressesFor(ctx context.Context, ipv6Hosts map[string]netip.Addr, subdomain string, addresses []netip.Addr, prefix netip.Prefix) []netip.Addr {
+	iid, ok := ipv6Hosts[subdomain]
+	if !ok {
+		return addresses
+	}
+
+	var result []netip.Addr
+	for _, addr := range addresses {
+		if addr.Unmap().Is4() {
+			result = append(result, addr)
+		}
+	}
+
+	if !prefix.IsValid() {
+		return result
+	}
+
+	host, err := ipv6.Combine(prefix, iid)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Ctx(ctx).Err(err).Str("subdomain", subdomain).Msg("cannot combine prefix and interface identifier")
+		return result
+	}
+
+	return append(result, host)
+}
@@ -0,0 +1,123 @@
+package records
+
+import (
+	"context"
+	"errors"
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/netip"
+	"testing"
+)
+
+func TestNew_InvalidHostnames(t *testing.T) {
+	sf := mockfactory.NewMockServiceFactory(t)
+
+	_, err := New(sf, updater.New(), nil)
+	assert.ErrorIs(t, err, ErrNoHostnames)
+
+	_, err = New(sf, updater.New(), []string{"localhost"})
+	assert.ErrorIs(t, err, ErrInvalidHostname)
+
+	_, err = New(sf, updater.New(), []string{"foo bar.example.com"})
+	assert.ErrorIs(t, err, ErrInvalidHostname)
+}
+
+func TestNew_UnknownDomain(t *testing.T) {
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.unknown.com").Return("", "", errors.New("no registrar"))
+
+	_, err := New(sf, updater.New(), []string{"home.unknown.com"})
+	assert.EqualError(t, err, "no registrar")
+}
+
+func TestPublish(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, &services.DynDnsRequest{
+		IP: "203.0.113.7", Type: services.RecordTypeA, Domain: "example.com", Subdomain: "home",
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated, PreviousValue: "203.0.113.6"}, nil).Once()
+	cs.On("UpdateRecord", mock.Anything, &services.DynDnsRequest{
+		IP: "203.0.113.7", Type: services.RecordTypeA, Domain: "example.com", Subdomain: "",
+	}).Return(&services.UpdateResult{Action: services.ActionUnchanged}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.example.com").Return("cloudflare", "example.com", nil)
+	sf.EXPECT().ResolveDomain("example.com").Return("cloudflare", "example.com", nil)
+	sf.EXPECT().Find(services.Registrar("cloudflare")).Return(cs, nil)
+
+	var origin updater.Origin
+	listener := listenerFunc(func(ctx context.Context, _ []updater.Result) {
+		origin = updater.OriginFrom(ctx)
+	})
+
+	r, err := New(sf, updater.New(updater.WithListener(listener)), []string{"home.example.com", "example.com"})
+	assert.NoError(t, err)
+
+	results := r.Publish(context.Background(), "test", netip.MustParseAddr("::ffff:203.0.113.7"))
+
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "home.example.com", results[0].FQDN())
+		assert.Equal(t, updater.StatusUpdated, results[0].Status)
+		assert.Equal(t, "example.com", results[1].FQDN())
+		assert.Equal(t, updater.StatusUnchanged, results[1].Status)
+	}
+	assert.Equal(t, "test", origin.Source)
+}
+
+func TestPublishPrefix(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, &services.DynDnsRequest{
+		IP: "203.0.113.7", Type: services.RecordTypeA, Domain: "example.com", Subdomain: "nas",
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+	cs.On("UpdateRecord", mock.Anything, &services.DynDnsRequest{
+		IP: "2001:db8:aa00::10", Type: services.RecordTypeAAAA, Domain: "example.com", Subdomain: "nas",
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("nas.example.com").Return("cloudflare", "example.com", nil)
+	sf.EXPECT().Find(services.Registrar("cloudflare")).Return(cs, nil)
+
+	r, err := New(sf, updater.New(), []string{"nas.example.com"},
+		WithIPv6Hosts(map[string]netip.Addr{"nas": netip.MustParseAddr("::10")}))
+	assert.NoError(t, err)
+
+	results := r.PublishPrefix(context.Background(), "test", netip.MustParsePrefix("2001:db8:aa00::/56"),
+		netip.MustParseAddr("203.0.113.7"), netip.MustParseAddr("2001:db8::1"))
+
+	assert.Len(t, results, 2)
+}
+
+type listenerFunc func(ctx context.Context, results []updater.Result)
+
+func (f listenerFunc) Updated(ctx context.Context, results []updater.Result) {
+	f(ctx, results)
+}
+
+func TestSubdomain(t *testing.T) {
+	assert.Equal(t, "home", Subdomain("Home.Example.com.", "example.com"))
+	assert.Equal(t, "a.b", Subdomain("a.b.example.com", "example.com"))
+	assert.Equal(t, "", Subdomain("example.com", "example.com"))
+}
+
+func TestAddressesFor(t *testing.T) {
+	hosts := map[string]netip.Addr{"nas": netip.MustParseAddr("::10")}
+	addresses := []netip.Addr{netip.MustParseAddr("203.0.113.7"), netip.MustParseAddr("2001:db8::1")}
+	prefix := netip.MustParsePrefix("2001:db8:aa00::/56")
+
+	assert.Equal(t, addresses, AddressesFor(context.Background(), hosts, "www", addresses, prefix),
+		"subdomains without interface identifier keep their addresses")
+
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("203.0.113.7"), netip.MustParseAddr("2001:db8:aa00::10")},
+		AddressesFor(context.Background(), hosts, "nas", addresses, prefix))
+
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("203.0.113.7")},
+		AddressesFor(context.Background(), hosts, "nas", addresses, netip.Prefix{}),
+		"the router's address must not be published for hosts without prefix")
+
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("203.0.113.7")},
+		AddressesFor(context.Background(), hosts, "nas", addresses, netip.MustParsePrefix("2001:db8::/96")),
+		"prefixes too long to combine are ignored")
+}
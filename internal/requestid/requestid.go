@@ -0,0 +1,60 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxLength bounds the size of IDs accepted from clients, which end up in every log line of a request.
+const maxLength = 128
+
+// Middleware assigns each request an ID, taken from the X-Request-ID header if the client sent a valid one. The ID is
+// echoed in the response header and attached to a logger in the request context, retrieved with zerolog.Ctx.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+
+			id := request.Header.Get(echo.HeaderXRequestID)
+			if !valid(id) {
+				id = generate()
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			ctx := request.Context()
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("request_id", id))
+
+			logger := log.With().Str("request_id", id).Logger()
+			c.SetRequest(request.WithContext(logger.WithContext(ctx)))
+
+			return next(c)
+		}
+	}
+}
+
+// valid accepts non-empty IDs of printable ASCII characters, keeping control characters out of logs and headers.
+func valid(id string) bool {
+	if len(id) == 0 || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
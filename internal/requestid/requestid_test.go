@@ -0,0 +1,66 @@
+package requestid
+
+import (
+	"bytes"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(t *testing.T, header string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = global })
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/api/update", func(c echo.Context) error {
+		zerolog.Ctx(c.Request().Context()).Info().Msg("handling update")
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/update", nil)
+	if len(header) > 0 {
+		req.Header.Set(echo.HeaderXRequestID, header)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec, buf.String()
+}
+
+func TestMiddlewareGeneratesID(t *testing.T) {
+	rec, logged := serve(t, "")
+
+	id := rec.Header().Get(echo.HeaderXRequestID)
+	assert.Len(t, id, 32)
+	assert.Contains(t, logged, `"request_id":"`+id+`"`)
+
+	other, _ := serve(t, "")
+	assert.NotEqual(t, id, other.Header().Get(echo.HeaderXRequestID))
+}
+
+func TestMiddlewareTakesClientID(t *testing.T) {
+	rec, logged := serve(t, "fritzbox-4711")
+
+	assert.Equal(t, "fritzbox-4711", rec.Header().Get(echo.HeaderXRequestID))
+	assert.Contains(t, logged, `"request_id":"fritzbox-4711"`)
+}
+
+func TestMiddlewareReplacesInvalidID(t *testing.T) {
+	for _, id := range []string{"foo bar", "foo\x1bbar", strings.Repeat("a", maxLength+1)} {
+		rec, logged := serve(t, id)
+
+		assert.Len(t, rec.Header().Get(echo.HeaderXRequestID), 32)
+		assert.NotContains(t, logged, id)
+	}
+}
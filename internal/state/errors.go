@@ -0,0 +1,7 @@
+package state
+
+import "errors"
+
+var (
+	ErrInvalidStateFile = errors.New("invalid state file")
+)
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultMaxAge is how long a published value is trusted before it is verified against the registrar again.
+const defaultMaxAge = 24 * time.Hour
+
+// Entry is the last value successfully published for a record.
+type Entry struct {
+	Registrar  services.Registrar `json:"registrar"`
+	Value      string             `json:"value"`
+	VerifiedAt time.Time          `json:"verified_at"`
+}
+
+// Store remembers the last published value per FQDN and record type in a JSON file. The file is replaced atomically
+// on every change, so a crash never leaves a partially written state behind.
+type Store struct {
+	path   string
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// LoadStore opens the store configured in state.path. Without a path, no state is kept and nil is returned.
+func LoadStore() (*Store, error) {
+	path := viper.GetString("state.path")
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return NewStore(path, viper.GetDuration("state.maxAge"))
+}
+
+// NewStore reads the state from path, starting empty if the file doesn't exist yet.
+func NewStore(path string, maxAge time.Duration) (*Store, error) {
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+
+	s := &Store{path: path, maxAge: maxAge, entries: make(map[string]Entry)}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info().Str("path", path).Msg("no state file found, starting with empty state")
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s.entries); err != nil {
+		log.Error().Err(err).Str("path", path).Msg("cannot parse state file")
+		return nil, ErrInvalidStateFile
+	}
+
+	log.Info().Str("path", path).Int("records", len(s.entries)).Msg("loaded state")
+
+	return s, nil
+}
+
+// Current reports whether value was published for the record via the registrar within the max age.
+func (s *Store) Current(registrar services.Registrar, fqdn string, recordType services.RecordType, value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key(fqdn, recordType)]
+
+	return ok && entry.Registrar == registrar && entry.Value == value && time.Since(entry.VerifiedAt) < s.maxAge
+}
+
+// Put records value as published for the record and persists the state.
+func (s *Store) Put(registrar services.Registrar, fqdn string, recordType services.RecordType, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key(fqdn, recordType)] = Entry{Registrar: registrar, Value: value, VerifiedAt: time.Now().UTC()}
+
+	return s.write()
+}
+
+// Delete forgets the record published via the registrar, so the next update is sent to it. Records published via
+// another registrar are kept.
+func (s *Store) Delete(registrar services.Registrar, fqdn string, recordType services.RecordType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(fqdn, recordType)
+	if entry, ok := s.entries[k]; !ok || entry.Registrar != registrar {
+		return nil
+	}
+
+	delete(s.entries, k)
+
+	return s.write()
+}
+
+// write replaces the state file with the current entries via a temporary file in the same directory.
+func (s *Store) write() error {
+	b, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func key(fqdn string, recordType services.RecordType) string {
+	return fqdn + "/" + string(recordType)
+}
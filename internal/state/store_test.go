@@ -0,0 +1,74 @@
+package state
+
+import (
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePersistsEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	store, err := NewStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, store.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+	assert.Nil(t, store.Put("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+
+	reopened, err := NewStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, reopened.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+	assert.False(t, reopened.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.2"))
+	assert.False(t, reopened.Current("cloudflare", "bar.foo.com", services.RecordTypeAAAA, "10.0.0.1"))
+	assert.False(t, reopened.Current("gandi", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+
+	files, _ := os.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 1, "temporary files should be cleaned up")
+}
+
+func TestStoreMaxAge(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "state.json"), 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, store.Put("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+	assert.True(t, store.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+
+	time.Sleep(30 * time.Millisecond)
+
+	assert.False(t, store.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+}
+
+func TestStoreDelete(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, store.Put("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+	assert.Nil(t, store.Delete("porkbun", "bar.foo.com", services.RecordTypeA))
+	assert.True(t, store.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+
+	assert.Nil(t, store.Delete("cloudflare", "bar.foo.com", services.RecordTypeA))
+	assert.False(t, store.Current("cloudflare", "bar.foo.com", services.RecordTypeA, "10.0.0.1"))
+}
+
+func TestNewStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore(path, time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidStateFile)
+	assert.Nil(t, store)
+}
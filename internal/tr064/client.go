@@ -0,0 +1,154 @@
+package tr064
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Client calls TR-064 actions of a FritzBox, authenticating with HTTP digest auth. The challenge of the box is
+// reused for subsequent calls until the box rejects the nonce.
+type Client struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+
+	mu        sync.Mutex
+	challenge *challenge
+}
+
+// NewClient creates a client for the box at url, e.g. http://fritz.box:49000.
+func NewClient(url string, username string, password string) *Client {
+	return &Client{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+type envelope struct {
+	Body struct {
+		Fault *struct {
+			Detail struct {
+				UPnPError struct {
+					Code        int    `xml:"errorCode"`
+					Description string `xml:"errorDescription"`
+				} `xml:"UPnPError"`
+			} `xml:"detail"`
+		} `xml:"Fault"`
+		Response struct {
+			XMLName xml.Name
+			Args    []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// Call invokes action of the service at controlURL without arguments and returns the output arguments by name.
+func (c *Client) Call(ctx context.Context, service string, controlURL string, action string) (map[string]string, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%s xmlns:u="%s"></u:%s></s:Body></s:Envelope>`, action, service, action)
+
+	resp, err := c.do(ctx, controlURL, service+"#"+action, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if err := xml.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	if env.Body.Fault != nil {
+		upnpError := env.Body.Fault.Detail.UPnPError
+		return nil, fmt.Errorf("%w: %s: %d %s", ErrFault, action, upnpError.Code, upnpError.Description)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	if env.Body.Response.XMLName.Local != action+"Response" {
+		return nil, fmt.Errorf("%w: unexpected element %s", ErrInvalidResponse, env.Body.Response.XMLName.Local)
+	}
+
+	args := make(map[string]string, len(env.Body.Response.Args))
+	for _, arg := range env.Body.Response.Args {
+		args[arg.XMLName.Local] = strings.TrimSpace(arg.Value)
+	}
+
+	return args, nil
+}
+
+// do posts the request, answering the digest challenge of the box if the cached one is missing or stale.
+func (c *Client) do(ctx context.Context, controlURL string, soapAction string, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	cached := c.challenge
+	c.mu.Unlock()
+
+	resp, err := c.post(ctx, controlURL, soapAction, body, cached)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	fresh, err := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.challenge = fresh
+	c.mu.Unlock()
+
+	resp, err = c.post(ctx, controlURL, soapAction, body, fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, ErrUnauthorized
+	}
+
+	return resp, nil
+}
+
+func (c *Client) post(ctx context.Context, controlURL string, soapAction string, body []byte, ch *challenge) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+controlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SoapAction", soapAction)
+
+	if ch != nil {
+		c.mu.Lock()
+		authorization := ch.authorize(c.username, c.password, http.MethodPost, req.URL.RequestURI())
+		c.mu.Unlock()
+
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.http.Do(req)
+}
@@ -0,0 +1,121 @@
+package tr064
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// challenge is the digest challenge (RFC 2617) the FritzBox answers unauthenticated requests with.
+type challenge struct {
+	realm  string
+	nonce  string
+	opaque string
+	qop    string
+	count  int
+}
+
+func parseChallenge(header string) (*challenge, error) {
+	scheme, params, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil, ErrInvalidChallenge
+	}
+
+	c := &challenge{}
+
+	for _, param := range splitParams(params) {
+		key, value, found := strings.Cut(param, "=")
+		if !found {
+			continue
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "qop":
+			// only auth is supported, auth-int would require hashing the body
+			for _, qop := range strings.Split(value, ",") {
+				if strings.TrimSpace(qop) == "auth" {
+					c.qop = "auth"
+				}
+			}
+		case "algorithm":
+			if !strings.EqualFold(value, "MD5") {
+				return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidChallenge, value)
+			}
+		}
+	}
+
+	if len(c.nonce) == 0 {
+		return nil, ErrInvalidChallenge
+	}
+
+	return c, nil
+}
+
+// splitParams splits the comma separated parameters of a challenge, ignoring commas in quoted values.
+func splitParams(params string) []string {
+	var result []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range params {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			result = append(result, current.String())
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	return append(result, current.String())
+}
+
+// authorize returns the Authorization header for a request, counting the uses of the nonce.
+func (c *challenge) authorize(username string, password string, method string, uri string) string {
+	c.count++
+
+	ha1 := md5Hex(username + ":" + c.realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5`,
+		username, c.realm, c.nonce, uri)
+
+	if c.qop == "auth" {
+		nc := fmt.Sprintf("%08x", c.count)
+		cnonce := newCnonce()
+		response := md5Hex(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cnonce, response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+c.nonce+":"+ha2))
+	}
+
+	if len(c.opaque) > 0 {
+		header += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+
+	return header
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,12 @@
+package tr064
+
+import "errors"
+
+var (
+	ErrMissingURL        = errors.New("tr064 enabled without url")
+	ErrInvalidConnection = errors.New("invalid tr064 connection type, must be ip or ppp")
+	ErrUnauthorized      = errors.New("tr064 authentication failed")
+	ErrInvalidChallenge  = errors.New("invalid digest challenge")
+	ErrInvalidResponse   = errors.New("invalid soap response")
+	ErrFault             = errors.New("tr064 action failed")
+)
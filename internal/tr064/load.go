@@ -0,0 +1,32 @@
+package tr064
+
+import (
+	"github.com/davidramiro/frigabun/internal/records"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services/factory"
+	"github.com/spf13/viper"
+	"net/netip"
+)
+
+// Load creates the poller configured in the tr064 section, returning nil if polling is disabled.
+func Load(serviceFactory factory.ServiceFactory, u *updater.Updater, ipv6Hosts map[string]netip.Addr) (*Poller, error) {
+	if !viper.GetBool("tr064.enabled") {
+		return nil, nil
+	}
+
+	url := viper.GetString("tr064.url")
+	if len(url) == 0 {
+		return nil, ErrMissingURL
+	}
+
+	r, err := records.New(serviceFactory, u, viper.GetStringSlice("tr064.hostnames"), records.WithIPv6Hosts(ipv6Hosts))
+	if err != nil {
+		return nil, err
+	}
+
+	client := NewClient(url, viper.GetString("tr064.username"), viper.GetString("tr064.password"))
+
+	return NewPoller(client, r, Connection(viper.GetString("tr064.connection")),
+		WithIPv6(viper.GetBool("tr064.ipv6")),
+		WithInterval(viper.GetDuration("tr064.interval")))
+}
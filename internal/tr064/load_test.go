@@ -0,0 +1,59 @@
+package tr064
+
+import (
+	"github.com/davidramiro/frigabun/internal/updater"
+	mockfactory "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services/factory"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLoadDisabled(t *testing.T) {
+	p, err := Load(mockfactory.NewMockServiceFactory(t), updater.New(), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestLoadMissingURL(t *testing.T) {
+	viper.Set("tr064.enabled", true)
+	t.Cleanup(func() { viper.Set("tr064", nil) })
+
+	_, err := Load(mockfactory.NewMockServiceFactory(t), updater.New(), nil)
+	assert.ErrorIs(t, err, ErrMissingURL)
+}
+
+func TestLoad(t *testing.T) {
+	viper.Set("tr064.enabled", true)
+	viper.Set("tr064.url", "http://fritz.box:49000")
+	viper.Set("tr064.hostnames", []string{"home.example.com"})
+	viper.Set("tr064.connection", "ppp")
+	viper.Set("tr064.ipv6", true)
+	viper.Set("tr064.interval", "5m")
+	t.Cleanup(func() { viper.Set("tr064", nil) })
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.example.com").Return("cloudflare", "example.com", nil)
+
+	p, err := Load(sf, updater.New(), nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "http://fritz.box:49000", p.client.url)
+		assert.True(t, p.ipv6)
+		assert.Equal(t, 5*time.Minute, p.interval)
+	}
+}
+
+func TestLoadInvalidConnection(t *testing.T) {
+	viper.Set("tr064.enabled", true)
+	viper.Set("tr064.url", "http://fritz.box:49000")
+	viper.Set("tr064.hostnames", []string{"home.example.com"})
+	viper.Set("tr064.connection", "dsl")
+	t.Cleanup(func() { viper.Set("tr064", nil) })
+
+	sf := mockfactory.NewMockServiceFactory(t)
+	sf.EXPECT().ResolveDomain("home.example.com").Return("cloudflare", "example.com", nil)
+
+	_, err := Load(sf, updater.New(), nil)
+	assert.ErrorIs(t, err, ErrInvalidConnection)
+}
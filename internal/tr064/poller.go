@@ -0,0 +1,253 @@
+package tr064
+
+import (
+	"context"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/rs/zerolog"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Source is recorded as origin of the updates triggered by the poller.
+	Source = "tr064"
+
+	defaultInterval = time.Minute
+)
+
+// Connection selects the WAN connection service of the box: ip for cable, fiber and boxes behind a modem, ppp for
+// DSL boxes dialing in themselves.
+type Connection string
+
+const (
+	ConnectionIP  Connection = "ip"
+	ConnectionPPP Connection = "ppp"
+)
+
+func (c Connection) service() (string, string, error) {
+	switch c {
+	case ConnectionIP, "":
+		return "urn:dslforum-org:service:WANIPConnection:1", "/upnp/control/wanipconnection1", nil
+	case ConnectionPPP:
+		return "urn:dslforum-org:service:WANPPPConnection:1", "/upnp/control/wanpppconn1", nil
+	default:
+		return "", "", ErrInvalidConnection
+	}
+}
+
+// Publisher updates the records to the addresses of the box, implemented by records.Records.
+type Publisher interface {
+	PublishPrefix(ctx context.Context, source string, prefix netip.Prefix, addresses ...netip.Addr) []updater.Result
+}
+
+// WAN is the external address configuration of the box. Addresses are invalid while the box isn't connected.
+type WAN struct {
+	IPv4   netip.Addr
+	IPv6   netip.Addr
+	Prefix netip.Prefix
+}
+
+func (w WAN) addresses() []netip.Addr {
+	var addrs []netip.Addr
+	for _, addr := range []netip.Addr{w.IPv4, w.IPv6} {
+		if addr.IsValid() {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// Poller periodically fetches the WAN addresses of a FritzBox and publishes them once they changed, so no DynDNS
+// slot of the box is needed.
+type Poller struct {
+	client     *Client
+	publisher  Publisher
+	service    string
+	controlURL string
+	ipv6       bool
+	interval   time.Duration
+
+	mu   sync.Mutex
+	last WAN
+}
+
+type Option func(*Poller)
+
+// WithIPv6 fetches the IPv6 address and the delegated prefix as well.
+func WithIPv6(enabled bool) Option {
+	return func(p *Poller) {
+		p.ipv6 = enabled
+	}
+}
+
+// WithInterval sets the time between two polls, one minute by default.
+func WithInterval(interval time.Duration) Option {
+	return func(p *Poller) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+func NewPoller(client *Client, publisher Publisher, connection Connection, opts ...Option) (*Poller, error) {
+	service, controlURL, err := connection.service()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Poller{
+		client:     client,
+		publisher:  publisher,
+		service:    service,
+		controlURL: controlURL,
+		interval:   defaultInterval,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+// Run polls right away and then every interval until ctx is done.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the WAN addresses and publishes them if they changed since the last successful publish.
+func (p *Poller) Poll(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("source", Source).Logger()
+
+	wan, err := p.WAN(ctx)
+	if err != nil {
+		logger.Warn().Err(err).Msg("fetching wan addresses from fritzbox failed")
+		return
+	}
+
+	addrs := wan.addresses()
+	if len(addrs) == 0 {
+		logger.Debug().Msg("fritzbox not connected")
+		return
+	}
+
+	p.mu.Lock()
+	changed := p.last != wan
+	p.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	logger.Info().Str("ipv4", addrString(wan.IPv4)).Str("ipv6", addrString(wan.IPv6)).
+		Str("prefix", prefixString(wan.Prefix)).Msg("fritzbox wan addresses changed")
+
+	results := p.publisher.PublishPrefix(ctx, Source, wan.Prefix, addrs...)
+
+	// failed records are retried with the next poll
+	if !slices.ContainsFunc(results, updater.Result.Failed) {
+		p.mu.Lock()
+		p.last = wan
+		p.mu.Unlock()
+	}
+}
+
+// WAN fetches the external addresses of the box. The IPv6 address and prefix are only fetched with IPv6 enabled.
+func (p *Poller) WAN(ctx context.Context) (WAN, error) {
+	var wan WAN
+
+	args, err := p.client.Call(ctx, p.service, p.controlURL, "GetExternalIPAddress")
+	if err != nil {
+		return wan, err
+	}
+
+	wan.IPv4 = parseAddr(args["NewExternalIPAddress"])
+
+	if !p.ipv6 {
+		return wan, nil
+	}
+
+	args, err = p.client.Call(ctx, p.service, p.controlURL, "X_AVM_DE_GetExternalIPv6Address")
+	if err != nil {
+		return wan, err
+	}
+
+	wan.IPv6 = parseAddr(args["NewExternalIPv6Address"])
+
+	args, err = p.client.Call(ctx, p.service, p.controlURL, "X_AVM_DE_GetIPv6Prefix")
+	if err != nil {
+		return wan, err
+	}
+
+	wan.Prefix, err = parsePrefix(args["NewIPv6Prefix"], args["NewPrefixLength"])
+	if err != nil {
+		return wan, err
+	}
+
+	return wan, nil
+}
+
+// parseAddr returns the address, or an invalid one if the box reports none, e.g. 0.0.0.0 while disconnected.
+func parseAddr(s string) netip.Addr {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.IsUnspecified() {
+		return netip.Addr{}
+	}
+
+	return addr.Unmap()
+}
+
+func parsePrefix(addr string, length string) (netip.Prefix, error) {
+	if len(addr) == 0 || len(length) == 0 {
+		return netip.Prefix{}, nil
+	}
+
+	bits, err := strconv.Atoi(length)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: prefix length %s", ErrInvalidResponse, length)
+	}
+
+	network := parseAddr(addr)
+	if !network.IsValid() || bits == 0 {
+		return netip.Prefix{}, nil
+	}
+
+	prefix, err := network.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	return prefix, nil
+}
+
+func addrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+
+	return addr.String()
+}
+
+func prefixString(prefix netip.Prefix) string {
+	if !prefix.IsValid() {
+		return ""
+	}
+
+	return prefix.String()
+}
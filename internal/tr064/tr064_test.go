@@ -0,0 +1,247 @@
+package tr064
+
+import (
+	"context"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testUser     = "frigabun"
+	testPassword = "secret"
+	testRealm    = "F!Box SOAP-Auth"
+	testNonce    = "0123456789ABCDEF"
+)
+
+// fakeBox answers TR-064 actions like a FritzBox, requiring digest auth.
+type fakeBox struct {
+	mu      sync.Mutex
+	args    map[string]map[string]string
+	actions []string
+}
+
+var digestParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+func (b *fakeBox) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+
+	params := make(map[string]string)
+	for _, m := range digestParam.FindAllStringSubmatch(header, -1) {
+		params[m[1]] = m[2] + m[3]
+	}
+
+	ha1 := md5Hex(testUser + ":" + testRealm + ":" + testPassword)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	expected := md5Hex(ha1 + ":" + testNonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+
+	return params["username"] == testUser && params["nonce"] == testNonce && params["response"] == expected
+}
+
+func (b *fakeBox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !b.authorized(r) {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Digest realm="%s", nonce="%s", algorithm=MD5, qop="auth"`, testRealm, testNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	service, action, _ := strings.Cut(r.Header.Get("SoapAction"), "#")
+
+	b.mu.Lock()
+	b.actions = append(b.actions, r.URL.Path+" "+action)
+	args, ok := b.args[action]
+	b.mu.Unlock()
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">`+
+			`<s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+			`<UPnPError xmlns="urn:dslforum-org:control-1-0"><errorCode>401</errorCode>`+
+			`<errorDescription>Invalid Action</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+		return
+	}
+
+	var out strings.Builder
+	for name, value := range args {
+		out.WriteString("<" + name + ">" + value + "</" + name + ">")
+	}
+
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">`+
+		`<s:Body><u:%sResponse xmlns:u="%s">%s</u:%sResponse></s:Body></s:Envelope>`,
+		action, service, out.String(), action)
+}
+
+func (b *fakeBox) set(action string, args map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.args[action] = args
+}
+
+func newFakeBox() *fakeBox {
+	return &fakeBox{args: map[string]map[string]string{
+		"GetExternalIPAddress": {"NewExternalIPAddress": "203.0.113.7"},
+		"X_AVM_DE_GetExternalIPv6Address": {
+			"NewExternalIPv6Address": "2001:db8::1",
+			"NewPrefixLength":        "64",
+		},
+		"X_AVM_DE_GetIPv6Prefix": {
+			"NewIPv6Prefix":   "2001:db8:aa00::",
+			"NewPrefixLength": "56",
+		},
+	}}
+}
+
+type fakePublisher struct {
+	calls  []WAN
+	failed bool
+}
+
+func (f *fakePublisher) PublishPrefix(_ context.Context, source string, prefix netip.Prefix, addresses ...netip.Addr) []updater.Result {
+	wan := WAN{Prefix: prefix}
+	for _, addr := range addresses {
+		if addr.Is4() {
+			wan.IPv4 = addr
+		} else {
+			wan.IPv6 = addr
+		}
+	}
+	f.calls = append(f.calls, wan)
+
+	if f.failed {
+		return []updater.Result{{Status: updater.StatusFailed}}
+	}
+
+	return []updater.Result{{Status: updater.StatusUpdated}}
+}
+
+func TestClientCall(t *testing.T) {
+	box := newFakeBox()
+	server := httptest.NewServer(box)
+	defer server.Close()
+
+	client := NewClient(server.URL, testUser, testPassword)
+
+	args, err := client.Call(context.Background(), "urn:dslforum-org:service:WANIPConnection:1",
+		"/upnp/control/wanipconnection1", "GetExternalIPAddress")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"NewExternalIPAddress": "203.0.113.7"}, args)
+
+	// the cached challenge is reused
+	_, err = client.Call(context.Background(), "urn:dslforum-org:service:WANIPConnection:1",
+		"/upnp/control/wanipconnection1", "GetExternalIPAddress")
+	assert.NoError(t, err)
+	assert.Len(t, box.actions, 2)
+}
+
+func TestClientCall_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(newFakeBox())
+	defer server.Close()
+
+	client := NewClient(server.URL, testUser, "wrong")
+
+	_, err := client.Call(context.Background(), "urn:dslforum-org:service:WANIPConnection:1",
+		"/upnp/control/wanipconnection1", "GetExternalIPAddress")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClientCall_Fault(t *testing.T) {
+	server := httptest.NewServer(newFakeBox())
+	defer server.Close()
+
+	client := NewClient(server.URL, testUser, testPassword)
+
+	_, err := client.Call(context.Background(), "urn:dslforum-org:service:WANIPConnection:1",
+		"/upnp/control/wanipconnection1", "ForceTermination")
+	assert.ErrorIs(t, err, ErrFault)
+	assert.ErrorContains(t, err, "401 Invalid Action")
+}
+
+func TestPoller(t *testing.T) {
+	box := newFakeBox()
+	server := httptest.NewServer(box)
+	defer server.Close()
+
+	publisher := &fakePublisher{}
+	poller, err := NewPoller(NewClient(server.URL, testUser, testPassword), publisher, ConnectionIP, WithIPv6(true))
+	assert.NoError(t, err)
+
+	poller.Poll(context.Background())
+	poller.Poll(context.Background())
+
+	// a reconnect assigns new addresses
+	box.set("GetExternalIPAddress", map[string]string{"NewExternalIPAddress": "203.0.113.8"})
+	poller.Poll(context.Background())
+
+	expected := WAN{
+		IPv4:   netip.MustParseAddr("203.0.113.7"),
+		IPv6:   netip.MustParseAddr("2001:db8::1"),
+		Prefix: netip.MustParsePrefix("2001:db8:aa00::/56"),
+	}
+	reconnected := expected
+	reconnected.IPv4 = netip.MustParseAddr("203.0.113.8")
+
+	assert.Equal(t, []WAN{expected, reconnected}, publisher.calls)
+	assert.Contains(t, box.actions, "/upnp/control/wanipconnection1 X_AVM_DE_GetIPv6Prefix")
+}
+
+func TestPoller_Disconnected(t *testing.T) {
+	box := newFakeBox()
+	box.set("GetExternalIPAddress", map[string]string{"NewExternalIPAddress": "0.0.0.0"})
+	server := httptest.NewServer(box)
+	defer server.Close()
+
+	publisher := &fakePublisher{}
+	poller, err := NewPoller(NewClient(server.URL, testUser, testPassword), publisher, ConnectionPPP)
+	assert.NoError(t, err)
+
+	poller.Poll(context.Background())
+
+	assert.Empty(t, publisher.calls)
+	assert.Equal(t, []string{"/upnp/control/wanpppconn1 GetExternalIPAddress"}, box.actions)
+}
+
+func TestPoller_RetriesFailedUpdates(t *testing.T) {
+	server := httptest.NewServer(newFakeBox())
+	defer server.Close()
+
+	publisher := &fakePublisher{failed: true}
+	poller, err := NewPoller(NewClient(server.URL, testUser, testPassword), publisher, ConnectionIP)
+	assert.NoError(t, err)
+
+	poller.Poll(context.Background())
+	poller.Poll(context.Background())
+
+	assert.Len(t, publisher.calls, 2)
+}
+
+func TestNewPoller_InvalidConnection(t *testing.T) {
+	_, err := NewPoller(NewClient("http://fritz.box:49000", testUser, testPassword), &fakePublisher{}, "dsl")
+	assert.ErrorIs(t, err, ErrInvalidConnection)
+}
+
+func TestParseChallenge(t *testing.T) {
+	c, err := parseChallenge(`Digest realm="F!Box SOAP-Auth", nonce="abc", algorithm=MD5, qop="auth,auth-int"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "F!Box SOAP-Auth", c.realm)
+	assert.Equal(t, "abc", c.nonce)
+	assert.Equal(t, "auth", c.qop)
+
+	_, err = parseChallenge(`Basic realm="box"`)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	_, err = parseChallenge(`Digest realm="box", nonce="abc", algorithm=SHA-256`)
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+}
@@ -0,0 +1,5 @@
+package tracing
+
+import "errors"
+
+var ErrInvalidEndpoint = errors.New("invalid tracing endpoint, must be an http or https url")
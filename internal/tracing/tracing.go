@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+)
+
+const defaultServiceName = "frigabun"
+
+// Setup installs an OTLP/HTTP trace exporter if tracing.enabled is set. The exporter sends to tracing.endpoint, or
+// the endpoint set via the standard OTEL_EXPORTER_OTLP_* environment variables. The returned function flushes
+// pending spans.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	if !viper.GetBool("tracing.enabled") {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if endpoint := viper.GetString("tracing.endpoint"); len(endpoint) > 0 {
+		// the exporter silently falls back to its default endpoint for invalid urls
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return nil, ErrInvalidEndpoint
+		}
+
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := viper.GetString("tracing.serviceName")
+	if len(serviceName) == 0 {
+		serviceName = defaultServiceName
+	}
+
+	ratio := 1.0
+	if viper.IsSet("tracing.sampleRatio") {
+		ratio = viper.GetFloat64("tracing.sampleRatio")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	log.Info().Str("service", serviceName).Float64("sample_ratio", ratio).Msg("tracing enabled")
+
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span per request, continuing traces propagated by the client.
+func Middleware() echo.MiddlewareFunc {
+	tracer := otel.Tracer("github.com/davidramiro/frigabun/internal/tracing")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+			route := c.Path()
+			if len(route) == 0 {
+				route = "unmatched"
+			}
+
+			ctx, span := tracer.Start(ctx, request.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(request.Method),
+					semconv.HTTPRoute(route),
+					semconv.ClientAddress(c.RealIP()),
+				))
+			defer span.End()
+
+			c.SetRequest(request.WithContext(ctx))
+
+			err := next(c)
+
+			status := c.Response().Status
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				status = httpErr.Code
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
+
+// LogHook adds the IDs of the span in the context of a log event, if any.
+type LogHook struct{}
+
+func (LogHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	spanContext := trace.SpanContextFromContext(e.GetCtx())
+	if !spanContext.IsValid() {
+		return
+	}
+
+	e.Str("trace_id", spanContext.TraceID().String()).Str("span_id", spanContext.SpanID().String())
+}
@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/api/update", func(c echo.Context) error {
+		_, span := otel.Tracer("test").Start(c.Request().Context(), "child")
+		span.End()
+		return c.String(http.StatusInternalServerError, "failed")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/update?domain=foo.com", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		child, server := spans[0], spans[1]
+
+		assert.Equal(t, "GET /api/update", server.Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String(),
+			"trace should continue the propagated one")
+		assert.Equal(t, codes.Error, server.Status().Code)
+		assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out).Hook(LogHook{})
+
+	logger.Info().Ctx(context.Background()).Msg("no span")
+	assert.NotContains(t, out.String(), "trace_id")
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "span")
+	defer span.End()
+
+	out.Reset()
+	logger.Info().Ctx(ctx).Msg("with span")
+
+	var line map[string]string
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, span.SpanContext().TraceID().String(), line["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), line["span_id"])
+}
+
+// setupTracing sets the tracing config and restores the global provider and propagator after the test.
+func setupTracing(t *testing.T, enabled bool, endpoint string) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+
+	viper.Set("tracing.enabled", enabled)
+	viper.Set("tracing.endpoint", endpoint)
+	t.Cleanup(func() {
+		viper.Set("tracing", nil)
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+}
+
+func TestSetupDisabled(t *testing.T) {
+	setupTracing(t, false, "")
+	provider := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background())
+	if assert.NoError(t, err) {
+		assert.NoError(t, shutdown(context.Background()))
+	}
+	assert.Equal(t, provider, otel.GetTracerProvider())
+}
+
+func TestSetupInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "ftp://localhost/v1/traces", "http://", "http://%zz"} {
+		setupTracing(t, true, endpoint)
+
+		shutdown, err := Setup(context.Background())
+		assert.ErrorIs(t, err, ErrInvalidEndpoint, endpoint)
+		assert.Nil(t, shutdown)
+	}
+}
+
+func TestSetupExportsOnShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	setupTracing(t, true, server.URL+"/v1/traces")
+	viper.Set("tracing.serviceName", "frigabun-test")
+	viper.Set("tracing.sampleRatio", 1.0)
+
+	shutdown, err := Setup(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "update")
+	assert.True(t, span.SpanContext().IsSampled())
+	span.End()
+
+	// spans are batched, shutting down flushes them
+	assert.NoError(t, shutdown(context.Background()))
+
+	mu.Lock()
+	assert.Equal(t, []string{"/v1/traces"}, paths)
+	mu.Unlock()
+}
@@ -0,0 +1,28 @@
+package updater
+
+import "context"
+
+// Origin describes who requested an update.
+type Origin struct {
+	// Client is the address of the client sending the request.
+	Client string
+	// Credential is the name of the credential the request was authenticated with, empty if not authenticated.
+	Credential string
+	// RequestID correlates the update with the logs and response of the request.
+	RequestID string
+	// Source names the component that detected the address of updates not requested by a client, e.g. detect.
+	Source string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context carrying the origin of the updates run with it.
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin attached to ctx, empty if there is none.
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
@@ -0,0 +1,341 @@
+package updater
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/state"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusUpdated   Status = "updated"
+	StatusUnchanged Status = "unchanged"
+	StatusFailed    Status = "failed"
+)
+
+// Job is a single record to publish via a registrar's service.
+type Job struct {
+	Registrar services.Registrar
+	Service   services.DnsUpdateService
+	Request   *services.DynDnsRequest
+}
+
+// Result is the outcome of a job.
+type Result struct {
+	Registrar services.Registrar  `json:"registrar"`
+	Domain    string              `json:"domain"`
+	Subdomain string              `json:"subdomain"`
+	Type      services.RecordType `json:"type"`
+	IP        string              `json:"ip"`
+	Status    Status              `json:"status"`
+	Error     string              `json:"error,omitempty"`
+	// PreviousIP is the value of the record before the update, empty if unknown or newly created.
+	PreviousIP string        `json:"previous_ip,omitempty"`
+	RecordID   string        `json:"record_id,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	// Cached is set if the registrar wasn't called because the value was published recently.
+	Cached bool `json:"cached,omitempty"`
+}
+
+var tracer = otel.Tracer("github.com/davidramiro/frigabun/internal/updater")
+
+// defaultWorkers is the number of concurrent updates per registrar if not configured otherwise.
+const defaultWorkers = 4
+
+// Listener is notified about the results of every update, after all jobs are done.
+type Listener interface {
+	Updated(ctx context.Context, results []Result)
+}
+
+type Updater struct {
+	mu         sync.Mutex
+	semaphores map[services.Registrar]chan struct{}
+	records    map[recordKey]*recordLock
+	state      *state.Store
+	listeners  []Listener
+}
+
+type Option func(*Updater)
+
+func New(opts ...Option) *Updater {
+	u := &Updater{semaphores: make(map[services.Registrar]chan struct{}), records: make(map[recordKey]*recordLock)}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	return u
+}
+
+// WithListener adds a listener notified about the results of every update.
+func WithListener(listener Listener) Option {
+	return func(u *Updater) {
+		u.listeners = append(u.listeners, listener)
+	}
+}
+
+// WithStateStore skips calling the registrar for records recently published with the same value.
+func WithStateStore(store *state.Store) Option {
+	return func(u *Updater) {
+		u.state = store
+	}
+}
+
+// Update runs all jobs concurrently, bounded by the configured number of workers per registrar. Jobs for the same
+// record run one after another, also across concurrent calls. Failures don't stop other jobs, results are returned
+// and logged in the order of the jobs. Jobs still waiting for a worker or their record when ctx is done fail without
+// contacting the registrar.
+func (u *Updater) Update(ctx context.Context, jobs []Job) []Result {
+	results := make([]Result, len(jobs))
+
+	var wg sync.WaitGroup
+
+	for i, job := range jobs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, span := tracer.Start(ctx, "update "+newResult(job).FQDN(), trace.WithAttributes(
+				attribute.String("registrar", string(job.Registrar)),
+				attribute.String("dns.record.type", string(job.Request.Type)),
+				attribute.String("dns.record.value", job.Request.IP),
+			))
+			defer func() {
+				results[i].annotate(span)
+				span.End()
+			}()
+
+			unlock, err := u.lockRecord(ctx, job)
+			if err != nil {
+				results[i] = failed(job, err)
+				return
+			}
+			defer unlock()
+
+			semaphore := u.semaphore(job.Registrar)
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				results[i] = failed(job, ctx.Err())
+				return
+			}
+
+			zerolog.Ctx(ctx).Debug().Ctx(ctx).Msgf("handling job %d of %d", i+1, len(jobs))
+			results[i] = u.run(ctx, job)
+		}()
+	}
+
+	wg.Wait()
+
+	for _, result := range results {
+		result.log(ctx)
+	}
+
+	for _, listener := range u.listeners {
+		listener.Updated(ctx, results)
+	}
+
+	return results
+}
+
+// recordKey identifies a record at a registrar, names are compared case-insensitively.
+type recordKey struct {
+	registrar  services.Registrar
+	domain     string
+	subdomain  string
+	recordType services.RecordType
+}
+
+// recordLock is held by the job updating a record, refs counts the jobs holding or waiting for it.
+type recordLock struct {
+	held chan struct{}
+	refs int
+}
+
+// lockRecord waits until no other job updates the record of job and returns the function releasing it. Concurrent
+// jobs for the same record would each find it missing and create it twice.
+func (u *Updater) lockRecord(ctx context.Context, job Job) (func(), error) {
+	key := recordKey{
+		registrar:  job.Registrar,
+		domain:     strings.ToLower(job.Request.Domain),
+		subdomain:  strings.ToLower(job.Request.Subdomain),
+		recordType: job.Request.Type,
+	}
+
+	u.mu.Lock()
+	lock, ok := u.records[key]
+	if !ok {
+		lock = &recordLock{held: make(chan struct{}, 1)}
+		u.records[key] = lock
+	}
+	lock.refs++
+	u.mu.Unlock()
+
+	release := func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(u.records, key)
+		}
+	}
+
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// semaphore returns the semaphore limiting concurrent updates of a registrar, sized by <registrar>.workers.
+func (u *Updater) semaphore(registrar services.Registrar) chan struct{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	semaphore, ok := u.semaphores[registrar]
+	if !ok {
+		workers := viper.GetInt(string(registrar) + ".workers")
+		if workers <= 0 {
+			workers = defaultWorkers
+		}
+
+		semaphore = make(chan struct{}, workers)
+		u.semaphores[registrar] = semaphore
+	}
+
+	return semaphore
+}
+
+func (u *Updater) run(ctx context.Context, job Job) Result {
+	// services may normalize the request, so the result is taken from it beforehand
+	result := newResult(job)
+
+	if u.state != nil && u.state.Current(job.Registrar, result.FQDN(), job.Request.Type, job.Request.IP) {
+		result.Status = StatusUnchanged
+		result.PreviousIP = job.Request.IP
+		result.Cached = true
+		return result
+	}
+
+	update, err := job.Service.UpdateRecord(ctx, job.Request)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+
+		// the record may have been changed partially, verify it next time
+		if u.state != nil {
+			if err := u.state.Delete(result.Registrar, result.FQDN(), result.Type); err != nil {
+				zerolog.Ctx(ctx).Error().Ctx(ctx).Err(err).Str("fqdn", result.FQDN()).Msg("cannot persist record state")
+			}
+		}
+
+		return result
+	}
+
+	if update != nil {
+		result.PreviousIP = update.PreviousValue
+		result.RecordID = update.RecordID
+		result.Latency = update.Latency
+
+		switch update.Action {
+		case services.ActionCreated:
+			result.Status = StatusCreated
+		case services.ActionUnchanged:
+			result.Status = StatusUnchanged
+		}
+	}
+
+	if u.state != nil {
+		if err := u.state.Put(job.Registrar, result.FQDN(), result.Type, result.IP); err != nil {
+			zerolog.Ctx(ctx).Error().Ctx(ctx).Err(err).Str("fqdn", result.FQDN()).Msg("cannot persist record state")
+		}
+	}
+
+	return result
+}
+
+func newResult(job Job) Result {
+	return Result{
+		Registrar: job.Registrar,
+		Domain:    job.Request.Domain,
+		Subdomain: job.Request.Subdomain,
+		Type:      job.Request.Type,
+		IP:        job.Request.IP,
+		Status:    StatusUpdated,
+	}
+}
+
+func failed(job Job, err error) Result {
+	result := newResult(job)
+	result.Status = StatusFailed
+	result.Error = err.Error()
+	return result
+}
+
+// annotate records the outcome of the job on its span.
+func (r Result) annotate(span trace.Span) {
+	span.SetAttributes(attribute.String("status", string(r.Status)), attribute.Bool("cached", r.Cached))
+
+	if r.Failed() {
+		span.SetStatus(codes.Error, r.Error)
+	}
+}
+
+func (r Result) log(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).
+		Str("registrar", string(r.Registrar)).
+		Str("fqdn", r.FQDN()).
+		Str("type", string(r.Type)).
+		Str("IP", r.IP).
+		Logger()
+
+	if r.Failed() {
+		logger.Error().Str("error", r.Error).Msg("updating record failed")
+		return
+	}
+
+	logger.Info().
+		Str("status", string(r.Status)).
+		Str("previous", r.PreviousIP).
+		Dur("latency", r.Latency).
+		Bool("cached", r.Cached).
+		Msg("record published")
+}
+
+// FQDN returns the fully qualified name of the record.
+func (r Result) FQDN() string {
+	if len(r.Subdomain) == 0 {
+		return r.Domain
+	}
+
+	return r.Subdomain + "." + r.Domain
+}
+
+// Changed reports whether the value of the record was changed by the update.
+func (r Result) Changed() bool {
+	return r.Status == StatusCreated || r.Status == StatusUpdated
+}
+
+// Failed reports whether the record could not be published.
+func (r Result) Failed() bool {
+	return r.Status == StatusFailed
+}
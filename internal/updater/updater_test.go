@@ -0,0 +1,313 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/state"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateContinuesAfterFailure(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "foo"
+	})).Return(nil, errors.New("failed to update")).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar"
+	})).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	jobs := []Job{
+		{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "foo", IP: "10.0.0.1", Type: services.RecordTypeA}},
+		{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "bar", IP: "10.0.0.1", Type: services.RecordTypeA}},
+	}
+
+	results := New().Update(context.Background(), jobs)
+
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, StatusFailed, results[0].Status)
+		assert.Equal(t, "failed to update", results[0].Error)
+		assert.True(t, results[0].Failed())
+		assert.Equal(t, "foo.foo.com", results[0].FQDN())
+
+		assert.Equal(t, StatusUpdated, results[1].Status)
+		assert.Empty(t, results[1].Error)
+		assert.Equal(t, "bar.foo.com", results[1].FQDN())
+	}
+}
+
+func TestUpdateMapsActions(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "foo"
+	})).Return(&services.UpdateResult{Action: services.ActionCreated, NewValue: "10.0.0.1", RecordID: "1"}, nil).Once()
+	cs.On("UpdateRecord", mock.Anything, mock.MatchedBy(func(r *services.DynDnsRequest) bool {
+		return r.Subdomain == "bar"
+	})).Return(&services.UpdateResult{Action: services.ActionUnchanged, PreviousValue: "10.0.0.1", NewValue: "10.0.0.1"}, nil).Once()
+
+	jobs := []Job{
+		{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "foo", IP: "10.0.0.1", Type: services.RecordTypeA}},
+		{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "bar", IP: "10.0.0.1", Type: services.RecordTypeA}},
+	}
+
+	results := New().Update(context.Background(), jobs)
+
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, StatusCreated, results[0].Status)
+		assert.Equal(t, "1", results[0].RecordID)
+		assert.True(t, results[0].Changed())
+
+		assert.Equal(t, StatusUnchanged, results[1].Status)
+		assert.Equal(t, "10.0.0.1", results[1].PreviousIP)
+		assert.False(t, results[1].Changed())
+	}
+}
+
+func TestResultFQDN(t *testing.T) {
+	assert.Equal(t, "foo.com", Result{Domain: "foo.com"}.FQDN())
+	assert.Equal(t, "bar.foo.com", Result{Domain: "foo.com", Subdomain: "bar"}.FQDN())
+}
+
+type concurrencyCountingService struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (s *concurrencyCountingService) UpdateRecord(_ context.Context, request *services.DynDnsRequest) (*services.UpdateResult, error) {
+	s.mu.Lock()
+	s.current++
+	s.max = max(s.max, s.current)
+	s.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	s.mu.Lock()
+	s.current--
+	s.mu.Unlock()
+
+	return &services.UpdateResult{Action: services.ActionUpdated, NewValue: request.IP}, nil
+}
+
+func (s *concurrencyCountingService) Registrar() services.Registrar {
+	return "cloudflare"
+}
+
+func TestUpdateLimitsWorkersPerRegistrar(t *testing.T) {
+	viper.Set("cloudflare.workers", 2)
+	defer viper.Set("cloudflare.workers", nil)
+
+	service := &concurrencyCountingService{}
+
+	var jobs []Job
+	for i := range 10 {
+		jobs = append(jobs, Job{
+			Registrar: "cloudflare",
+			Service:   service,
+			Request:   &services.DynDnsRequest{Domain: "foo.com", Subdomain: fmt.Sprintf("sub%d", i), IP: "10.0.0.1"},
+		})
+	}
+
+	results := New().Update(context.Background(), jobs)
+
+	assert.Equal(t, 2, service.max)
+	if assert.Len(t, results, 10) {
+		for i, result := range results {
+			assert.Equal(t, fmt.Sprintf("sub%d", i), result.Subdomain, "results should keep the order of the jobs")
+			assert.Equal(t, StatusUpdated, result.Status)
+		}
+	}
+}
+
+func TestUpdateRunsConcurrently(t *testing.T) {
+	service := &concurrencyCountingService{}
+
+	var jobs []Job
+	for i := range 4 {
+		jobs = append(jobs, Job{Registrar: "cloudflare", Service: service,
+			Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: fmt.Sprintf("sub%d", i)}})
+	}
+
+	New().Update(context.Background(), jobs)
+
+	assert.Equal(t, defaultWorkers, service.max)
+}
+
+func TestUpdateSerializesJobsForSameRecord(t *testing.T) {
+	service := &concurrencyCountingService{}
+	u := New()
+
+	job := func(subdomain string) Job {
+		return Job{Registrar: "cloudflare", Service: service,
+			Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: subdomain, Type: services.RecordTypeA, IP: "10.0.0.1"}}
+	}
+
+	// duplicates within a request and across concurrent requests, names differing in case only
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results := u.Update(context.Background(), []Job{job("a"), job("a"), job("A")})
+			assert.Len(t, results, 3)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, service.max)
+	assert.Empty(t, u.records, "locks of finished jobs should be released")
+}
+
+func TestUpdateFailsWaitingJobsWhenContextDone(t *testing.T) {
+	viper.Set("cloudflare.workers", 1)
+	defer viper.Set("cloudflare.workers", nil)
+
+	service := &concurrencyCountingService{}
+
+	var jobs []Job
+	for range 3 {
+		jobs = append(jobs, Job{Registrar: "cloudflare", Service: service, Request: &services.DynDnsRequest{Domain: "foo.com"}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	statuses := make(map[Status]int)
+	for _, result := range New().Update(ctx, jobs) {
+		statuses[result.Status]++
+		if result.Failed() {
+			assert.Equal(t, context.DeadlineExceeded.Error(), result.Error)
+		}
+	}
+
+	assert.Equal(t, 1, statuses[StatusUpdated])
+	assert.Equal(t, 2, statuses[StatusFailed])
+}
+
+func TestUpdateSkipsRecentlyPublishedRecords(t *testing.T) {
+	store, err := state.NewStore(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).
+		Return(&services.UpdateResult{Action: services.ActionUpdated, PreviousValue: "10.0.0.2"}, nil).Once()
+
+	u := New(WithStateStore(store))
+	jobs := func() []Job {
+		return []Job{{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "bar", IP: "10.0.0.1", Type: services.RecordTypeA}}}
+	}
+
+	results := u.Update(context.Background(), jobs())
+	assert.Equal(t, StatusUpdated, results[0].Status)
+	assert.False(t, results[0].Cached)
+
+	results = u.Update(context.Background(), jobs())
+	assert.Equal(t, StatusUnchanged, results[0].Status)
+	assert.Equal(t, "10.0.0.1", results[0].PreviousIP)
+	assert.True(t, results[0].Cached)
+}
+
+func TestUpdateForgetsFailedRecords(t *testing.T) {
+	store, err := state.NewStore(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("cloudflare", "foo.com", services.RecordTypeA, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errors.New("failed to update")).Once()
+
+	u := New(WithStateStore(store))
+	results := u.Update(context.Background(), []Job{{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", IP: "10.0.0.1", Type: services.RecordTypeA}}})
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.False(t, store.Current("cloudflare", "foo.com", services.RecordTypeA, "10.0.0.2"))
+}
+
+func TestUpdateKeepsRecordNameNormalizedByService(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(1).(*services.DynDnsRequest).Subdomain = "@"
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	results := New().Update(context.Background(), []Job{{Registrar: "gandi", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", IP: "10.0.0.1", Type: services.RecordTypeA}}})
+
+	assert.Equal(t, "foo.com", results[0].FQDN())
+}
+
+func TestUpdateDoesNotRememberFailedRecords(t *testing.T) {
+	store, err := state.NewStore(filepath.Join(t.TempDir(), "state.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errors.New("failed to update")).Twice()
+
+	u := New(WithStateStore(store))
+	for range 2 {
+		results := u.Update(context.Background(), []Job{{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", IP: "10.0.0.1", Type: services.RecordTypeA}}})
+		assert.Equal(t, StatusFailed, results[0].Status)
+	}
+}
+
+type recordingListener struct {
+	origin  Origin
+	results []Result
+}
+
+func (l *recordingListener) Updated(ctx context.Context, results []Result) {
+	l.origin = OriginFrom(ctx)
+	l.results = results
+}
+
+func TestUpdateNotifiesListeners(t *testing.T) {
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionCreated}, nil).Once()
+
+	listener := &recordingListener{}
+	ctx := WithOrigin(context.Background(), Origin{Client: "192.0.2.1"})
+
+	New(WithListener(listener)).Update(ctx, []Job{{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", IP: "10.0.0.1", Type: services.RecordTypeA}}})
+
+	assert.Equal(t, "192.0.2.1", listener.origin.Client)
+	if assert.Len(t, listener.results, 1) {
+		assert.Equal(t, StatusCreated, listener.results[0].Status)
+	}
+}
+
+func TestUpdateTracesJobs(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	cs := mockservices.NewMockDnsUpdateService(t)
+	cs.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errors.New("failed to update")).Once()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	New().Update(ctx, []Job{{Registrar: "cloudflare", Service: cs, Request: &services.DynDnsRequest{Domain: "foo.com", Subdomain: "bar", IP: "10.0.0.1", Type: services.RecordTypeA}}})
+	parent.End()
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "update bar.foo.com", spans[0].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Contains(t, spans[0].Attributes(), attribute.String("status", "failed"))
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+	}
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a delivery given up on, kept so it can be inspected and replayed by hand. Headers are left out, as
+// they may carry credentials of the receiver.
+type DeadLetter struct {
+	Time     time.Time `json:"time"`
+	Webhook  string    `json:"webhook"`
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Event    Event     `json:"event"`
+	Body     string    `json:"body,omitempty"`
+}
+
+// deadLetterLog appends dead letters to a file as JSON lines.
+type deadLetterLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (l *deadLetterLog) add(letter DeadLetter) error {
+	b, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,12 @@
+package webhook
+
+import "errors"
+
+var (
+	ErrMissingURL      = errors.New("webhook needs a url")
+	ErrInvalidURL      = errors.New("invalid webhook url, must be http or https")
+	ErrInvalidTemplate = errors.New("invalid webhook template")
+	ErrInvalidPattern  = errors.New("invalid pattern in webhook filter")
+	ErrInvalidStatus   = errors.New("invalid status in webhook filter")
+	ErrDeliveryFailed  = errors.New("webhook receiver rejected delivery")
+)
@@ -0,0 +1,418 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/davidramiro/frigabun/internal/backoff"
+	"github.com/davidramiro/frigabun/internal/match"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the body, keyed with the secret of the webhook.
+const SignatureHeader = "X-Frigabun-Signature"
+
+const (
+	defaultTimeout  = 10 * time.Second
+	defaultAttempts = 3
+	defaultMinDelay = time.Second
+	defaultMaxDelay = 30 * time.Second
+)
+
+var defaultStatuses = []updater.Status{updater.StatusCreated, updater.StatusUpdated}
+
+// Retry configures the delivery attempts of a webhook, with exponential backoff between minDelay and maxDelay.
+type Retry struct {
+	Attempts int           `mapstructure:"attempts"`
+	MinDelay time.Duration `mapstructure:"minDelay"`
+	MaxDelay time.Duration `mapstructure:"maxDelay"`
+}
+
+// Target is a configured webhook. Body and header values are Go templates executed with an Event. Empty filter
+// lists match anything, domain and registrar patterns are globs as understood by path.Match.
+type Target struct {
+	Name    string            `mapstructure:"name"`
+	URL     string            `mapstructure:"url"`
+	Method  string            `mapstructure:"method"`
+	Headers map[string]string `mapstructure:"headers"`
+	// Body defaults to the event encoded as JSON.
+	Body   string `mapstructure:"body"`
+	Secret string `mapstructure:"secret"`
+	// Domains match the domain or the FQDN of a record.
+	Domains    []string `mapstructure:"domains"`
+	Registrars []string `mapstructure:"registrars"`
+	// Statuses default to created and updated, so only records that actually changed are sent.
+	Statuses []updater.Status `mapstructure:"statuses"`
+	Timeout  time.Duration    `mapstructure:"timeout"`
+	Retry    Retry            `mapstructure:"retry"`
+}
+
+// Event is a single record update, sent to webhooks and passed to their templates.
+type Event struct {
+	Time       time.Time           `json:"time"`
+	Registrar  services.Registrar  `json:"registrar"`
+	Domain     string              `json:"domain"`
+	Subdomain  string              `json:"subdomain"`
+	FQDN       string              `json:"fqdn"`
+	Type       services.RecordType `json:"type"`
+	IP         string              `json:"ip"`
+	PreviousIP string              `json:"previous_ip,omitempty"`
+	Status     updater.Status      `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	Client     string              `json:"client,omitempty"`
+	Credential string              `json:"credential,omitempty"`
+	RequestID  string              `json:"request_id,omitempty"`
+	Source     string              `json:"source,omitempty"`
+}
+
+type webhook struct {
+	Target
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+// Dispatcher sends the results of updates to the configured webhooks, implementing updater.Listener. Deliveries run
+// in the background, so slow receivers never hold up update requests.
+type Dispatcher struct {
+	webhooks    []webhook
+	client      *http.Client
+	deadLetters *deadLetterLog
+	wg          sync.WaitGroup
+}
+
+var funcs = template.FuncMap{
+	// json encodes a value, e.g. to safely embed strings in a JSON body
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// LoadDispatcher reads the webhooks configured in webhooks.targets.
+func LoadDispatcher() (*Dispatcher, error) {
+	var targets []Target
+
+	err := viper.UnmarshalKey("webhooks.targets", &targets)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDispatcher(targets, viper.GetString("webhooks.deadLetterPath"))
+}
+
+// NewDispatcher validates the targets and parses their templates. Deliveries failing all attempts are appended to
+// deadLetterPath, if set, and logged either way.
+func NewDispatcher(targets []Target, deadLetterPath string) (*Dispatcher, error) {
+	d := &Dispatcher{client: &http.Client{}}
+
+	if len(deadLetterPath) > 0 {
+		d.deadLetters = &deadLetterLog{path: deadLetterPath}
+	}
+
+	for _, target := range targets {
+		w, err := newWebhook(target)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debug().Str("webhook", w.Name).Msg("registered webhook")
+		d.webhooks = append(d.webhooks, w)
+	}
+
+	return d, nil
+}
+
+func newWebhook(target Target) (webhook, error) {
+	if len(target.URL) == 0 {
+		return webhook{}, ErrMissingURL
+	}
+
+	u, err := url.Parse(target.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return webhook{}, ErrInvalidURL
+	}
+
+	if len(target.Name) == 0 {
+		target.Name = u.Host
+	}
+	if len(target.Method) == 0 {
+		target.Method = http.MethodPost
+	}
+	if len(target.Statuses) == 0 {
+		target.Statuses = defaultStatuses
+	}
+	if target.Timeout <= 0 {
+		target.Timeout = defaultTimeout
+	}
+	if target.Retry.Attempts <= 0 {
+		target.Retry.Attempts = defaultAttempts
+	}
+	if target.Retry.MinDelay <= 0 {
+		target.Retry.MinDelay = defaultMinDelay
+	}
+	if target.Retry.MaxDelay <= 0 {
+		target.Retry.MaxDelay = defaultMaxDelay
+	}
+
+	if !match.Valid(target.Domains, target.Registrars) {
+		return webhook{}, ErrInvalidPattern
+	}
+
+	for _, status := range target.Statuses {
+		switch status {
+		case updater.StatusCreated, updater.StatusUpdated, updater.StatusUnchanged, updater.StatusFailed:
+		default:
+			return webhook{}, fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+		}
+	}
+
+	w := webhook{Target: target, headers: make(map[string]*template.Template)}
+
+	if len(target.Body) > 0 {
+		if w.body, err = template.New("body").Funcs(funcs).Parse(target.Body); err != nil {
+			return webhook{}, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+	}
+
+	for name, value := range target.Headers {
+		if w.headers[name], err = template.New(name).Funcs(funcs).Parse(value); err != nil {
+			return webhook{}, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+	}
+
+	return w, nil
+}
+
+func (d *Dispatcher) Updated(ctx context.Context, results []updater.Result) {
+	if len(d.webhooks) == 0 {
+		return
+	}
+
+	origin := updater.OriginFrom(ctx)
+	now := time.Now().UTC()
+
+	// deliveries outlive the request, but keep its logger and trace
+	ctx = context.WithoutCancel(ctx)
+
+	for _, result := range results {
+		event := Event{
+			Time:       now,
+			Registrar:  result.Registrar,
+			Domain:     result.Domain,
+			Subdomain:  result.Subdomain,
+			FQDN:       result.FQDN(),
+			Type:       result.Type,
+			IP:         result.IP,
+			PreviousIP: result.PreviousIP,
+			Status:     result.Status,
+			Error:      result.Error,
+			Client:     origin.Client,
+			Credential: origin.Credential,
+			RequestID:  origin.RequestID,
+			Source:     origin.Source,
+		}
+
+		for _, w := range d.webhooks {
+			if !w.matches(event) {
+				continue
+			}
+
+			d.wg.Add(1)
+			go func() {
+				defer d.wg.Done()
+				d.deliver(ctx, w, event)
+			}()
+		}
+	}
+}
+
+// Wait blocks until all pending deliveries succeeded or were given up on.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (w webhook) matches(event Event) bool {
+	if !match.Any(w.Registrars, string(event.Registrar)) {
+		return false
+	}
+
+	if !match.Any(w.Domains, event.Domain) && !match.Any(w.Domains, event.FQDN) {
+		return false
+	}
+
+	for _, status := range w.Statuses {
+		if status == event.Status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, w webhook, event Event) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("webhook", w.Name).Str("fqdn", event.FQDN).
+		Str("status", string(event.Status)).Logger()
+
+	body, headers, err := w.render(event)
+	if err != nil {
+		d.deadLetter(logger, w, event, nil, 0, err)
+		return
+	}
+
+	attempt := 1
+	for ; ; attempt++ {
+		err = d.send(ctx, w, body, headers)
+		if err == nil {
+			logger.Info().Int("attempt", attempt).Msg("webhook delivered")
+			return
+		}
+
+		if attempt >= w.Retry.Attempts || !retryable(err) {
+			break
+		}
+
+		delay := w.Retry.delay(attempt)
+		logger.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("webhook delivery failed, retrying")
+		time.Sleep(delay)
+	}
+
+	d.deadLetter(logger, w, event, body, attempt, err)
+}
+
+func (d *Dispatcher) send(ctx context.Context, w webhook, body []byte, headers http.Header) error {
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header = headers
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// render executes the templates of the webhook and signs the body.
+func (w webhook) render(event Event) ([]byte, http.Header, error) {
+	var body bytes.Buffer
+
+	headers := make(http.Header)
+
+	if w.body == nil {
+		headers.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if err := json.NewEncoder(&body).Encode(event); err != nil {
+			return nil, nil, err
+		}
+	} else if err := w.body.Execute(&body, event); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+
+	if len(event.RequestID) > 0 {
+		headers.Set(echo.HeaderXRequestID, event.RequestID)
+	}
+
+	for name, tmpl := range w.headers {
+		var value strings.Builder
+		if err := tmpl.Execute(&value, event); err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+
+		headers.Set(name, value.String())
+	}
+
+	if len(w.Secret) > 0 {
+		headers.Set(SignatureHeader, "sha256="+Sign([]byte(w.Secret), body.Bytes()))
+	}
+
+	return body.Bytes(), headers, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body, as sent in SignatureHeader.
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) deadLetter(logger zerolog.Logger, w webhook, event Event, body []byte, attempts int, err error) {
+	logger.Error().Err(err).Int("attempts", attempts).Msg("webhook delivery given up")
+
+	if d.deadLetters == nil {
+		return
+	}
+
+	letter := DeadLetter{
+		Time:     time.Now().UTC(),
+		Webhook:  w.Name,
+		URL:      w.URL,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    event,
+		Body:     string(body),
+	}
+
+	if err := d.deadLetters.add(letter); err != nil {
+		logger.Error().Err(err).Str("path", d.deadLetters.path).Msg("cannot write dead letter")
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s with status %d", ErrDeliveryFailed, e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return ErrDeliveryFailed
+}
+
+// retryable reports whether a failed delivery may succeed later: network errors, timeouts, rate limiting and server
+// errors are retried, other rejections are final.
+func retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusRequestTimeout || statusErr.code == http.StatusTooManyRequests ||
+			statusErr.code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+
+	return errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// delay returns the time to wait after a failed attempt, doubling from MinDelay up to MaxDelay.
+func (r Retry) delay(attempt int) time.Duration {
+	return backoff.Limit(r.MinDelay, r.MaxDelay, attempt)
+}
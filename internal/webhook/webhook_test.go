@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type delivery struct {
+	method  string
+	headers http.Header
+	body    string
+}
+
+// receiver records deliveries, answering with the given status codes in turn and 200 afterward.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, func() []delivery) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var deliveries []delivery
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		deliveries = append(deliveries, delivery{method: r.Method, headers: r.Header, body: string(body)})
+
+		if len(deliveries) <= len(statuses) {
+			w.WriteHeader(statuses[len(deliveries)-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []delivery {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]delivery(nil), deliveries...)
+	}
+}
+
+func results() []updater.Result {
+	return []updater.Result{
+		{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "bar", Type: services.RecordTypeA, IP: "10.0.0.1", PreviousIP: "10.0.0.2", Status: updater.StatusUpdated},
+		{Registrar: "cloudflare", Domain: "foo.com", Subdomain: "baz", Type: services.RecordTypeA, IP: "10.0.0.1", Status: updater.StatusUnchanged},
+		{Registrar: "gandi", Domain: "foo.org", Type: services.RecordTypeAAAA, IP: "2001:db8::1", Status: updater.StatusCreated},
+		{Registrar: "gandi", Domain: "foo.org", Subdomain: "www", Type: services.RecordTypeA, IP: "10.0.0.1", Status: updater.StatusFailed, Error: "registrar rejected request"},
+	}
+}
+
+func dispatch(t *testing.T, d *Dispatcher) {
+	t.Helper()
+
+	ctx := updater.WithOrigin(context.Background(), updater.Origin{Client: "192.0.2.1", Credential: "fritzbox",
+		RequestID: "abc123"})
+	d.Updated(ctx, results())
+	d.Wait()
+}
+
+func TestDispatcherDefaultPayload(t *testing.T) {
+	server, deliveries := receiver(t)
+
+	d, err := NewDispatcher([]Target{{URL: server.URL, Secret: "s3cret", Domains: []string{"bar.foo.com"}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d)
+
+	got := deliveries()
+	if !assert.Len(t, got, 1) {
+		return
+	}
+
+	assert.Equal(t, http.MethodPost, got[0].method)
+	assert.Equal(t, "application/json", got[0].headers.Get("Content-Type"))
+	assert.Equal(t, "abc123", got[0].headers.Get("X-Request-ID"))
+	assert.Equal(t, "sha256="+Sign([]byte("s3cret"), []byte(got[0].body)), got[0].headers.Get(SignatureHeader))
+
+	var event Event
+	assert.Nil(t, json.Unmarshal([]byte(got[0].body), &event))
+	assert.Equal(t, "bar.foo.com", event.FQDN)
+	assert.Equal(t, "10.0.0.1", event.IP)
+	assert.Equal(t, "10.0.0.2", event.PreviousIP)
+	assert.Equal(t, updater.StatusUpdated, event.Status)
+	assert.Equal(t, "fritzbox", event.Credential)
+}
+
+func TestDispatcherTemplates(t *testing.T) {
+	server, deliveries := receiver(t)
+
+	d, err := NewDispatcher([]Target{{
+		URL:     server.URL,
+		Method:  http.MethodPut,
+		Headers: map[string]string{"Content-Type": "text/plain", "X-Record": "{{.FQDN}}/{{.Type}}"},
+		Body:    `{{.FQDN}} is now {{.IP}}{{if .PreviousIP}}, was {{.PreviousIP}}{{end}} {{json .Registrar}}`,
+		Domains: []string{"*.foo.com"},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d)
+
+	got := deliveries()
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, http.MethodPut, got[0].method)
+		assert.Equal(t, "text/plain", got[0].headers.Get("Content-Type"))
+		assert.Equal(t, "bar.foo.com/A", got[0].headers.Get("X-Record"))
+		assert.Equal(t, `bar.foo.com is now 10.0.0.1, was 10.0.0.2 "cloudflare"`, got[0].body)
+		assert.Empty(t, got[0].headers.Get(SignatureHeader))
+	}
+}
+
+func TestDispatcherFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		fqdns  []string
+	}{
+		{"changed records by default", Target{}, []string{"bar.foo.com", "foo.org"}},
+		{"domain", Target{Domains: []string{"foo.org"}}, []string{"foo.org"}},
+		{"registrar", Target{Registrars: []string{"cloud*"}}, []string{"bar.foo.com"}},
+		{"outcome", Target{Statuses: []updater.Status{updater.StatusFailed, updater.StatusUnchanged}},
+			[]string{"baz.foo.com", "www.foo.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, deliveries := receiver(t)
+
+			tt.target.URL = server.URL
+			tt.target.Body = "{{.FQDN}}"
+
+			d, err := NewDispatcher([]Target{tt.target}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dispatch(t, d)
+
+			var fqdns []string
+			for _, delivery := range deliveries() {
+				fqdns = append(fqdns, delivery.body)
+			}
+
+			assert.ElementsMatch(t, tt.fqdns, fqdns)
+		})
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	server, deliveries := receiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	d, err := NewDispatcher([]Target{{URL: server.URL, Domains: []string{"bar.foo.com"},
+		Retry: Retry{Attempts: 3, MinDelay: time.Millisecond}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d)
+
+	assert.Len(t, deliveries(), 3)
+}
+
+func TestRetryDelay(t *testing.T) {
+	retry := Retry{Attempts: 1000, MinDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	assert.Equal(t, time.Second, retry.delay(1))
+	assert.Equal(t, 4*time.Second, retry.delay(3))
+
+	// shifting by the attempt would have overflowed long before
+	for _, attempt := range []int{6, 40, 64, 65, 999} {
+		assert.Equal(t, 30*time.Second, retry.delay(attempt), "attempt %d", attempt)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+
+	d, err := NewDispatcher([]Target{{Name: "firewall", URL: server.URL, Domains: []string{"bar.foo.com"},
+		Retry: Retry{Attempts: 2, MinDelay: time.Millisecond}}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d)
+
+	assert.Equal(t, int32(2), calls.Load())
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.Len(t, lines, 1) {
+		var letter DeadLetter
+		assert.Nil(t, json.Unmarshal([]byte(lines[0]), &letter))
+		assert.Equal(t, "firewall", letter.Webhook)
+		assert.Equal(t, 2, letter.Attempts)
+		assert.Contains(t, letter.Error, "502")
+		assert.Equal(t, "bar.foo.com", letter.Event.FQDN)
+		assert.Contains(t, letter.Body, `"fqdn":"bar.foo.com"`)
+	}
+}
+
+func TestDispatcherNoRetryOnRejection(t *testing.T) {
+	server, deliveries := receiver(t, http.StatusBadRequest)
+
+	d, err := NewDispatcher([]Target{{URL: server.URL, Domains: []string{"bar.foo.com"},
+		Retry: Retry{Attempts: 3, MinDelay: time.Millisecond}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(t, d)
+
+	assert.Len(t, deliveries(), 1)
+}
+
+func TestNewDispatcherInvalidTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		err    error
+	}{
+		{"missing url", Target{}, ErrMissingURL},
+		{"invalid url", Target{URL: "ftp://foo.com"}, ErrInvalidURL},
+		{"invalid body", Target{URL: "https://foo.com", Body: "{{.FQDN"}, ErrInvalidTemplate},
+		{"invalid header", Target{URL: "https://foo.com", Headers: map[string]string{"X-Foo": "{{end}}"}}, ErrInvalidTemplate},
+		{"invalid pattern", Target{URL: "https://foo.com", Domains: []string{"[foo"}}, ErrInvalidPattern},
+		{"invalid status", Target{URL: "https://foo.com", Statuses: []updater.Status{"changed"}}, ErrInvalidStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDispatcher([]Target{tt.target}, "")
+			assert.ErrorIs(t, err, tt.err)
+			assert.Nil(t, d)
+		})
+	}
+}
+
+func TestLoadDispatcher(t *testing.T) {
+	viper.SetConfigType("toml")
+	err := viper.ReadConfig(strings.NewReader(`
+[webhooks]
+deadLetterPath = "deadletter.jsonl"
+
+[[webhooks.targets]]
+name = "chat"
+url = "https://chat.foo.com/hook"
+headers = { Authorization = "Bearer {{.RequestID}}" }
+statuses = ["failed"]
+timeout = "5s"
+retry = { attempts = 5, minDelay = "2s", maxDelay = "1m" }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+
+	d, err := LoadDispatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, d.webhooks, 1) {
+		w := d.webhooks[0]
+		assert.Equal(t, "chat", w.Name)
+		assert.Equal(t, []updater.Status{updater.StatusFailed}, w.Statuses)
+		assert.Equal(t, 5*time.Second, w.Timeout)
+		assert.Equal(t, Retry{Attempts: 5, MinDelay: 2 * time.Second, MaxDelay: time.Minute}, w.Retry)
+
+		_, headers, err := w.render(Event{RequestID: "abc123"})
+		assert.Nil(t, err)
+		assert.Equal(t, "Bearer abc123", headers.Get("Authorization"))
+	}
+	assert.Equal(t, "deadletter.jsonl", d.deadLetters.path)
+}
@@ -1,11 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/davidramiro/frigabun/internal/api"
+	"github.com/davidramiro/frigabun/internal/auth"
+	"github.com/davidramiro/frigabun/internal/detect"
+	"github.com/davidramiro/frigabun/internal/history"
+	"github.com/davidramiro/frigabun/internal/ifwatch"
+	"github.com/davidramiro/frigabun/internal/ipv6"
+	"github.com/davidramiro/frigabun/internal/metrics"
+	"github.com/davidramiro/frigabun/internal/mqtt"
+	"github.com/davidramiro/frigabun/internal/notify"
+	"github.com/davidramiro/frigabun/internal/requestid"
+	"github.com/davidramiro/frigabun/internal/state"
+	"github.com/davidramiro/frigabun/internal/tr064"
+	"github.com/davidramiro/frigabun/internal/tracing"
+	"github.com/davidramiro/frigabun/internal/updater"
+	"github.com/davidramiro/frigabun/internal/webhook"
+	"github.com/davidramiro/frigabun/services"
 	"github.com/davidramiro/frigabun/services/factory"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -41,21 +58,39 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
+	log.Logger = log.Logger.Hook(tracing.LogHook{})
+	// loggers taken from a context without a request logger fall back to the global one
+	zerolog.DefaultContextLogger = &log.Logger
+
 	log.Info().Msg("starting frigabun")
 
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot set up tracing")
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
 
+	ipExtractor, err := api.LoadIPExtractor()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load client ip settings")
+	}
+	e.IPExtractor = ipExtractor
+
 	enableStatusLog := viper.GetBool("api.enableStatusLog")
 
+	e.Use(tracing.Middleware())
+	e.Use(requestid.Middleware())
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogURI:    true,
 		LogStatus: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			uri := v.URI
-			if enableStatusLog || !strings.Contains(v.URI, "/status") {
-				log.Info().
+			uri := auth.RedactURI(v.URI)
+			if enableStatusLog || !(strings.Contains(v.URI, "/status") || strings.HasPrefix(v.URI, "/metrics")) {
+				zerolog.Ctx(c.Request().Context()).Info().
+					Ctx(c.Request().Context()).
 					Str("URI", uri).
 					Int("status", v.Status).
 					Msg("request")
@@ -64,20 +99,118 @@ func main() {
 			return nil
 		},
 	}))
+	// registered before Recover, so requests ending in a panic are counted with the 500 Recover answers
+	e.Use(metrics.Middleware(prometheus.DefaultRegisterer))
 	e.Use(middleware.Recover())
 
-	serviceFactory, err := factory.NewDnsUpdateServiceFactory()
+	serviceFactory, err := factory.NewDnsUpdateServiceFactory(
+		services.WithMetrics(services.NewMetrics(prometheus.DefaultRegisterer)))
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot init service serviceFactory")
 	}
 
-	updateApi := api.NewUpdateApi(serviceFactory)
+	ipv6Hosts, err := ipv6.LoadHosts()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load ipv6 hosts")
+	}
+
+	stateStore, err := state.LoadStore()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load state")
+	}
+
+	historyStore, err := history.LoadStore()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load history")
+	}
+
+	dispatcher, err := webhook.LoadDispatcher()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load webhooks")
+	}
+
+	notifier, err := notify.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load notification channels")
+	}
+
+	updaterOpts := []updater.Option{updater.WithStateStore(stateStore), updater.WithListener(historyStore),
+		updater.WithListener(metrics.NewRecorder(prometheus.DefaultRegisterer)),
+		updater.WithListener(dispatcher), updater.WithListener(notifier)}
+
+	publisher, err := mqtt.Load(serviceFactory)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot connect to mqtt broker")
+	}
+
+	if publisher != nil {
+		updaterOpts = append(updaterOpts, updater.WithListener(publisher))
+		go publisher.Run(context.Background(), viper.GetDuration("mqtt.healthInterval"))
+	}
+
+	recordUpdater := updater.New(updaterOpts...)
+
+	monitor, err := detect.Load(serviceFactory, recordUpdater)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load address detection")
+	}
+
+	apiOpts := []api.Option{api.WithUpdater(recordUpdater), api.WithHistory(historyStore), api.WithIPv6Hosts(ipv6Hosts)}
+
+	if monitor != nil {
+		apiOpts = append(apiOpts, api.WithAddressDetector(monitor))
+		go monitor.Run(context.Background())
+	}
+
+	poller, err := tr064.Load(serviceFactory, recordUpdater, ipv6Hosts)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load fritzbox tr064 polling")
+	}
+
+	if poller != nil {
+		go poller.Run(context.Background())
+	}
+
+	watcher, err := ifwatch.Load(serviceFactory, recordUpdater)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load interface address watcher")
+	}
+
+	if watcher != nil {
+		go func() {
+			if err := watcher.Run(context.Background()); err != nil {
+				log.Error().Err(err).Msg("watching interface addresses failed")
+			}
+		}()
+	}
+
+	updateApi := api.NewUpdateApi(serviceFactory, apiOpts...)
+	authenticator, err := auth.LoadAuthenticator()
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot load credentials")
+	}
+
+	if !authenticator.Enabled() {
+		log.Warn().Msg("no credentials configured, update requests are not authenticated")
+	}
+
 	g := e.Group("/api")
-	g.GET("/update", updateApi.HandleUpdateRequest)
+	g.GET("/update", updateApi.HandleUpdateRequest, authenticator.Middleware(api.HandleUnauthorized))
 	g.GET("/status", updateApi.HandleStatusCheck)
+	g.GET("/history", updateApi.HandleHistoryRequest, authenticator.Middleware(api.HandleUnauthorized))
+
+	e.GET("/metrics", metrics.Handler(prometheus.DefaultGatherer))
+
+	e.GET("/nic/update", updateApi.HandleDynDns2Request, authenticator.Middleware(api.HandleDynDns2Unauthorized))
 
 	endpoint := fmt.Sprintf(":%d", viper.GetInt("api.port"))
 	log.Info().Str("port", endpoint).Msg("starting server")
 
-	log.Fatal().Err(e.Start(endpoint)).Msg("server error")
+	err = e.Start(endpoint)
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error().Err(err).Msg("cannot flush traces")
+	}
+
+	log.Fatal().Err(err).Msg("server error")
 }
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = time.Minute
+)
+
+// BreakerStatus is a snapshot of a registrar's circuit breaker.
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	// RetryAt is the time the open breaker lets the next request probe the registrar.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// Breaker is implemented by services guarded by a circuit breaker.
+type Breaker interface {
+	Breaker() BreakerStatus
+}
+
+// CircuitBreaker stops calling a registrar after a number of consecutive failed updates. Once the cooldown has passed,
+// a single update is let through to probe the registrar, closing the breaker again if it succeeds. Only errors marked
+// with ErrRegistrarUnavailable count as failures, i.e. network errors, timeouts and server errors.
+type CircuitBreaker struct {
+	service  DnsUpdateService
+	failures int
+	cooldown time.Duration
+
+	mu                  sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+}
+
+// NewCircuitBreaker guards service with the thresholds configured in <registrar>.circuitBreaker.
+func NewCircuitBreaker(service DnsUpdateService) *CircuitBreaker {
+	key := string(service.Registrar()) + ".circuitBreaker."
+
+	b := &CircuitBreaker{
+		service:  service,
+		failures: viper.GetInt(key + "failures"),
+		cooldown: viper.GetDuration(key + "cooldown"),
+		state:    BreakerClosed,
+	}
+
+	if b.failures <= 0 {
+		b.failures = defaultBreakerFailures
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+
+	return b
+}
+
+func (b *CircuitBreaker) UpdateRecord(ctx context.Context, request *DynDnsRequest) (*UpdateResult, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	result, err := b.service.UpdateRecord(ctx, request)
+	b.release(ctx, err)
+
+	return result, err
+}
+
+func (b *CircuitBreaker) Registrar() Registrar {
+	return b.service.Registrar()
+}
+
+// RateLimit passes through the rate limit of the guarded service.
+func (b *CircuitBreaker) RateLimit() *RateLimitStatus {
+	if limited, ok := b.service.(RateLimited); ok {
+		return limited.RateLimit()
+	}
+
+	return nil
+}
+
+func (b *CircuitBreaker) Breaker() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, ConsecutiveFailures: b.consecutiveFailures}
+	if b.state == BreakerOpen {
+		retryAt := b.openedAt.Add(b.cooldown)
+		status.RetryAt = &retryAt
+	}
+
+	return status
+}
+
+// acquire fails if the breaker is open, or half-open with a probe already in flight.
+func (b *CircuitBreaker) acquire(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		return b.openError()
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return b.openError()
+		}
+
+		zerolog.Ctx(ctx).Info().Ctx(ctx).Str("registrar", string(b.Registrar())).Msg("circuit breaker half-open, probing registrar")
+		b.state = BreakerHalfOpen
+	}
+
+	return nil
+}
+
+// release records the outcome of an update. Errors not caused by the registrar, like rejected requests or cancelled
+// ones, are neither counted as failure nor as success.
+func (b *CircuitBreaker) release(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("registrar", string(b.Registrar())).Logger()
+
+	if err != nil && !errors.Is(err, ErrRegistrarUnavailable) {
+		// the probe told nothing, let the next update probe again
+		if b.state == BreakerHalfOpen {
+			b.state = BreakerOpen
+		}
+		return
+	}
+
+	if err == nil {
+		if b.state != BreakerClosed {
+			logger.Info().Msg("registrar recovered, circuit breaker closed")
+		}
+
+		b.state = BreakerClosed
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.consecutiveFailures++
+
+	if b.state == BreakerHalfOpen || b.consecutiveFailures >= b.failures {
+		if b.state != BreakerOpen {
+			logger.Warn().Int("failures", b.consecutiveFailures).Dur("cooldown", b.cooldown).
+				Msg("circuit breaker opened")
+		}
+
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *CircuitBreaker) openError() error {
+	return fmt.Errorf("%w, retrying after %s", ErrCircuitOpen,
+		b.openedAt.Add(b.cooldown).Format(time.RFC3339))
+}
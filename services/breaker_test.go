@@ -0,0 +1,182 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+var errUnavailable = fmt.Errorf("%w: %w", services.ErrExecutingRequest, services.ErrRegistrarUnavailable)
+
+func newTestBreaker(t *testing.T) (*services.CircuitBreaker, *mockservices.MockDnsUpdateService) {
+	viper.Set("cloudflare.circuitBreaker.failures", 2)
+	viper.Set("cloudflare.circuitBreaker.cooldown", "50ms")
+	t.Cleanup(func() { viper.Set("cloudflare.circuitBreaker", nil) })
+
+	s := mockservices.NewMockDnsUpdateService(t)
+	s.On("Registrar").Return(services.Registrar("cloudflare")).Maybe()
+
+	return services.NewCircuitBreaker(s), s
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errUnavailable).Twice()
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	_, err := breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+
+	_, err = breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Equal(t, services.BreakerOpen, breaker.Breaker().State)
+	assert.NotNil(t, breaker.Breaker().RetryAt)
+
+	result, err := breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrCircuitOpen)
+	assert.Nil(t, result)
+	assert.Equal(t, 2, breaker.Breaker().ConsecutiveFailures)
+}
+
+func TestCircuitBreaker_SuccessResetsFailures(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errUnavailable).Once()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errUnavailable).Once()
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 3 {
+		_, _ = breaker.UpdateRecord(context.Background(), request)
+	}
+
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+	assert.Equal(t, 1, breaker.Breaker().ConsecutiveFailures)
+}
+
+func TestCircuitBreaker_IgnoresCancelledRequests(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, context.Canceled).Times(3)
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 3 {
+		_, err := breaker.UpdateRecord(context.Background(), request)
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+}
+
+func TestCircuitBreaker_IgnoresErrorsNotCausedByRegistrar(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errUnavailable).Once()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, services.ErrRegistrarRejectedRequest).Once()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: %w", services.ErrExecutingRequest,
+		services.ErrRateLimited)).Once()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errors.New("invalid zone")).Once()
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 4 {
+		_, err := breaker.UpdateRecord(context.Background(), request)
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+	assert.Equal(t, 1, breaker.Breaker().ConsecutiveFailures)
+}
+
+func TestCircuitBreaker_HalfOpenProbeRejected(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, errUnavailable).Twice()
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, services.ErrRegistrarRejectedRequest).Once()
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 2 {
+		_, _ = breaker.UpdateRecord(context.Background(), request)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, err := breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrRegistrarRejectedRequest)
+
+	// the next update probes again without waiting for another cooldown
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	_, err = breaker.UpdateRecord(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: api down", services.ErrRegistrarUnavailable)).Times(3)
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 2 {
+		_, _ = breaker.UpdateRecord(context.Background(), request)
+	}
+	assert.Equal(t, services.BreakerOpen, breaker.Breaker().State)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// failed probe opens the breaker again right away
+	_, err := breaker.UpdateRecord(context.Background(), request)
+	assert.EqualError(t, err, "registrar unavailable: api down")
+	assert.Equal(t, services.BreakerOpen, breaker.Breaker().State)
+
+	_, err = breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrCircuitOpen)
+
+	time.Sleep(60 * time.Millisecond)
+
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(&services.UpdateResult{Action: services.ActionUnchanged}, nil).Once()
+
+	result, err := breaker.UpdateRecord(context.Background(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUnchanged, result.Action)
+	assert.Equal(t, services.BreakerClosed, breaker.Breaker().State)
+	assert.Equal(t, 0, breaker.Breaker().ConsecutiveFailures)
+}
+
+func TestCircuitBreaker_SingleProbeWhileHalfOpen(t *testing.T) {
+	breaker, s := newTestBreaker(t)
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: api down", services.ErrRegistrarUnavailable)).Twice()
+
+	request := &services.DynDnsRequest{Domain: "foo.com", IP: "1.2.3.4"}
+
+	for range 2 {
+		_, _ = breaker.UpdateRecord(context.Background(), request)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	probing := make(chan struct{})
+	done := make(chan struct{})
+	s.On("UpdateRecord", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		close(probing)
+		<-done
+	}).Return(&services.UpdateResult{Action: services.ActionUpdated}, nil).Once()
+
+	go func() { _, _ = breaker.UpdateRecord(context.Background(), request) }()
+	<-probing
+
+	assert.Equal(t, services.BreakerHalfOpen, breaker.Breaker().State)
+	_, err := breaker.UpdateRecord(context.Background(), request)
+	assert.ErrorIs(t, err, services.ErrCircuitOpen)
+
+	close(done)
+}
@@ -2,13 +2,16 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"io"
 	"net/http"
+	"time"
 )
 
 type CloudflareDnsUpdateService struct {
@@ -18,9 +21,10 @@ type CloudflareDnsUpdateService struct {
 	client HTTPClient
 }
 
-func NewCloudflareDnsUpdateService(client HTTPClient) (*CloudflareDnsUpdateService, error) {
+func NewCloudflareDnsUpdateService(client HTTPClient, opts ...Option) (*CloudflareDnsUpdateService, error) {
 	baseUrl := viper.GetString("cloudflare.baseUrl")
 	ttl := viper.GetInt("cloudflare.ttl")
+	timeout := timeoutOrDefault(viper.GetDuration("cloudflare.timeout"))
 	apikey := viper.GetString("cloudflare.apiKey")
 	zoneId := viper.GetString("cloudflare.zoneId")
 
@@ -30,14 +34,18 @@ func NewCloudflareDnsUpdateService(client HTTPClient) (*CloudflareDnsUpdateServi
 		return nil, ErrMissingInfoForServiceInit
 	}
 
+	limiter := newLimiter("cloudflare")
+
 	if client == nil {
-		client = &http.Client{}
+		client = newHTTPClient("cloudflare", timeout, limiter, opts...)
 	}
 
 	return &CloudflareDnsUpdateService{
 		registrarSettings: registrarSettings{
 			baseUrl: baseUrl,
 			ttl:     ttl,
+			timeout: timeout,
+			limiter: limiter,
 		},
 		apiKey: apikey,
 		zoneId: zoneId,
@@ -52,34 +60,50 @@ type CloudflareApiRequest struct {
 	IP   string `json:"content"`
 }
 
+type CloudflareRecord struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
 type CloudflareQueryResponse struct {
 	Errors []struct {
 		Message string `json:"message"`
 	} `json:"errors"`
-	Result []struct {
-		Name string `json:"name"`
-		Id   string `json:"id"`
-	} `json:"result"`
+	Result []CloudflareRecord `json:"result"`
+}
+
+type CloudflareRecordResponse struct {
+	Result CloudflareRecord `json:"result"`
 }
 
-func (c *CloudflareDnsUpdateService) UpdateRecord(request *DynDnsRequest) error {
+func (c *CloudflareDnsUpdateService) UpdateRecord(ctx context.Context, request *DynDnsRequest) (*UpdateResult, error) {
 
-	endpoint := fmt.Sprintf("%s/zones/%s/dns_records", c.baseUrl,
-		c.zoneId)
+	endpoint := fmt.Sprintf("%s/zones/%s/dns_records?type=%s", c.baseUrl,
+		c.zoneId, request.recordType())
 
-	logger := log.With().
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).
 		Str("func", "UpdateRecord").
 		Str("registrar", "cloudflare").
 		Str("endpoint", endpoint).
+		Str("type", string(request.recordType())).
 		Str("domain", request.Domain).
 		Str("subdomain", request.Subdomain).Logger()
 
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	result := &UpdateResult{NewValue: request.IP}
+	start := time.Now()
+	defer func() { result.Latency = time.Since(start) }()
+
 	logger.Debug().Msg("building update request")
 
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		return nil, ErrBuildingRequest
 	}
 
 	var r CloudflareQueryResponse
@@ -89,55 +113,78 @@ func (c *CloudflareDnsUpdateService) UpdateRecord(request *DynDnsRequest) error
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
+		return nil, executionError(ctx, err)
 	}
+	defer closeBody(resp)
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrParsingResponse.Error())
-		return err
+		return nil, err
 	}
 
 	err = json.Unmarshal(b, &r)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrParsingResponse.Error())
-		return err
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK || len(r.Errors) > 0 {
 		logger.Error().Interface("response", b).Msg("could not query record")
-		return errors.New("could not query record: " + string(b))
+		return nil, statusError(resp, errors.New("could not query record: "+string(b)))
 	}
 
-	var id string
+	var existing *CloudflareRecord
 
 	if len(r.Errors) == 0 && len(r.Result) > 0 {
 		logger.Debug().Int("entries", len(r.Result)).Msg("comparing entries with update request")
-		for _, e := range r.Result {
-			var match string
-			if request.Subdomain == "" {
-				match = request.Domain
-			} else {
-				match = fmt.Sprintf("%s.%s", request.Subdomain, request.Domain)
+		for i, e := range r.Result {
+			if e.Name != request.fqdn() || (len(e.Type) > 0 && e.Type != string(request.recordType())) {
+				continue
 			}
 
-			if e.Name == match {
-				id = e.Id
+			if existing == nil || e.Content == request.IP {
+				existing = &r.Result[i]
 			}
 		}
 	}
 
-	if len(id) == 0 {
+	if existing == nil {
 		logger.Info().Msg("entry not found, creating new")
-		return c.newRecord(request)
-	} else {
-		logger.Info().Msg("entry found, updating")
-		return c.editExistingRecord(request, id)
+		id, err := c.newRecord(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Action = ActionCreated
+		result.RecordID = id
+
+		return result, nil
 	}
+
+	result.PreviousValue = existing.Content
+	result.RecordID = existing.Id
+
+	if existing.Content == request.IP {
+		logger.Info().Msg("entry found and up to date, skipping")
+		result.Action = ActionUnchanged
+		return result, nil
+	}
+
+	logger.Info().Msg("entry found, updating")
+	err = c.editExistingRecord(ctx, request, existing.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Action = ActionUpdated
+
+	return result, nil
 }
 
-func (c *CloudflareDnsUpdateService) newRecord(request *DynDnsRequest) error {
+// newRecord creates a new record and returns its ID.
+func (c *CloudflareDnsUpdateService) newRecord(ctx context.Context, request *DynDnsRequest) (string, error) {
 
 	var name string
 	if request.Subdomain != "" {
@@ -150,13 +197,13 @@ func (c *CloudflareDnsUpdateService) newRecord(request *DynDnsRequest) error {
 		Name: name,
 		IP:   request.IP,
 		TTL:  c.ttl,
-		Type: "A",
+		Type: string(request.recordType()),
 	}
 
 	endpoint := fmt.Sprintf("%s/zones/%s/dns_records", c.baseUrl,
 		c.zoneId)
 
-	logger := log.With().
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).
 		Str("func", "newRecord").
 		Str("registrar", "cloudflare").
 		Str("fqdn", cloudflareRequest.Name).
@@ -169,13 +216,13 @@ func (c *CloudflareDnsUpdateService) newRecord(request *DynDnsRequest) error {
 	body, err := json.Marshal(cloudflareRequest)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		return "", ErrBuildingRequest
 	}
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		return "", ErrBuildingRequest
 	}
 
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
@@ -185,21 +232,34 @@ func (c *CloudflareDnsUpdateService) newRecord(request *DynDnsRequest) error {
 	resp, err := c.client.Do(req)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
-		return ErrExecutingRequest
+		return "", executionError(ctx, err)
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != 200 {
 		b, _ := io.ReadAll(resp.Body)
 		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
-		return ErrRegistrarRejectedRequest
+		return "", statusError(resp, ErrRegistrarRejectedRequest)
 	}
 
 	logger.Debug().Msg("request for new record successful")
 
-	return nil
+	if resp.Body == nil {
+		return "", nil
+	}
+
+	var r CloudflareRecordResponse
+
+	b, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &r); err != nil {
+		logger.Debug().Bytes("response", b).Msg("no record id in response")
+		return "", nil
+	}
+
+	return r.Result.Id, nil
 }
 
-func (c *CloudflareDnsUpdateService) editExistingRecord(request *DynDnsRequest, id string) error {
+func (c *CloudflareDnsUpdateService) editExistingRecord(ctx context.Context, request *DynDnsRequest, id string) error {
 	var name string
 	if request.Subdomain != "" {
 		name = fmt.Sprintf("%s.%s", request.Subdomain, request.Domain)
@@ -211,13 +271,13 @@ func (c *CloudflareDnsUpdateService) editExistingRecord(request *DynDnsRequest,
 		Name: name,
 		IP:   request.IP,
 		TTL:  c.ttl,
-		Type: "A",
+		Type: string(request.recordType()),
 	}
 
 	endpoint := fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseUrl,
 		c.zoneId, id)
 
-	logger := log.With().Str("func", "editExistingRecord").Str("registrar", "cloudflare").Str("subdomain", cloudflareRequest.Name).Str("endpoint", endpoint).Str("IP", cloudflareRequest.IP).Logger()
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "editExistingRecord").Str("registrar", "cloudflare").Str("subdomain", cloudflareRequest.Name).Str("endpoint", endpoint).Str("IP", cloudflareRequest.IP).Logger()
 	logger.Info().Msg("building request to edit record")
 
 	body, err := json.Marshal(cloudflareRequest)
@@ -226,7 +286,7 @@ func (c *CloudflareDnsUpdateService) editExistingRecord(request *DynDnsRequest,
 		return errors.New("could not parse request")
 	}
 
-	req, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		logger.Error().Err(err).Msg("building request failed failed")
 		return errors.New("could not create request for cloudflare")
@@ -237,14 +297,15 @@ func (c *CloudflareDnsUpdateService) editExistingRecord(request *DynDnsRequest,
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		logger.Error().Err(err).Msg("executing request failed")
-		return errors.New("could not execute request")
+		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
+		return executionError(ctx, err)
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != 200 {
 		b, _ := io.ReadAll(resp.Body)
 		logger.Error().Bytes("response", b).Msg("cloudflare rejected request")
-		return fmt.Errorf("cloudflare rejected request: %s", string(b))
+		return statusError(resp, fmt.Errorf("cloudflare rejected request: %s", string(b)))
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package services_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
@@ -60,9 +61,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_RequestError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.Errorf(t, err, "cf api request error")
+	assert.Nil(t, result)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_QueryError(t *testing.T) {
@@ -97,9 +99,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_QueryError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.EqualError(t, err, "could not query record: {\"errors\":[{\"message\":\"error\"}],\"result\":null}")
+	assert.Nil(t, result)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord(t *testing.T) {
@@ -110,10 +113,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord(t *testing.T) {
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{{Name: "bar.foo.com", Id: "1"}},
+		Result: []services.CloudflareRecord{{Name: "bar.foo.com", Id: "1"}},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -142,9 +142,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUpdated, result.Action)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord(t *testing.T) {
@@ -155,10 +156,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord(t *testing.T) {
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{},
+		Result: []services.CloudflareRecord{},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -187,9 +185,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.Nil(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_ApiError(t *testing.T) {
@@ -200,10 +199,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_ApiError(t *testing.T
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{},
+		Result: []services.CloudflareRecord{},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -232,9 +228,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_ApiError(t *testing.T
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.Nil(t, result)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_ApiError(t *testing.T) {
@@ -245,10 +242,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_ApiError(t *test
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{{Name: "bar.foo.com", Id: "1"}},
+		Result: []services.CloudflareRecord{{Name: "bar.foo.com", Id: "1"}},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -277,9 +271,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_ApiError(t *test
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.EqualError(t, err, "cloudflare rejected request: api error")
+	assert.Nil(t, result)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_RequestError(t *testing.T) {
@@ -290,10 +285,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_RequestError(t *
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{{Name: "bar.foo.com", Id: "1"}},
+		Result: []services.CloudflareRecord{{Name: "bar.foo.com", Id: "1"}},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -319,9 +311,10 @@ func TestCloudflareDnsUpdateService_UpdateRecord_ExistingRecord_RequestError(t *
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
-	assert.EqualError(t, err, "could not execute request")
+	assert.ErrorIs(t, err, services.ErrExecutingRequest)
+	assert.Nil(t, result)
 }
 
 func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_RequestError(t *testing.T) {
@@ -332,10 +325,7 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_RequestError(t *testi
 		Errors: []struct {
 			Message string `json:"message"`
 		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{},
+		Result: []services.CloudflareRecord{},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -361,7 +351,169 @@ func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_RequestError(t *testi
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.EqualError(t, err, services.ErrExecutingRequest.Error())
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Nil(t, result)
+}
+
+func TestCloudflareDnsUpdateService_UpdateRecord_NewRecord_AAAA(t *testing.T) {
+	setupCloudflareConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	resp := &services.CloudflareQueryResponse{
+		Errors: []struct {
+			Message string `json:"message"`
+		}{},
+		Result: []services.CloudflareRecord{},
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal()
+	}
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == http.MethodGet && r.URL.Query().Get("type") == "AAAA"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	}, nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		body, _ := io.ReadAll(r.Body)
+		return r.Method == http.MethodPost && strings.Contains(string(body), `"type":"AAAA"`)
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       nil,
+	}, nil).Once()
+
+	registrar, err := services.NewCloudflareDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "2001:db8::1",
+		Type:      services.RecordTypeAAAA,
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
+}
+
+func TestCloudflareDnsUpdateService_UpdateRecord_Unchanged(t *testing.T) {
+	setupCloudflareConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	resp := &services.CloudflareQueryResponse{
+		Result: []services.CloudflareRecord{
+			{Name: "foo.foo.com", Id: "1", Type: "A", Content: "1.2.3.4"},
+			{Name: "bar.foo.com", Id: "2", Type: "A", Content: "1.2.3.4"},
+		},
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal()
+	}
+
+	h.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	}, nil).Once()
+
+	registrar, err := services.NewCloudflareDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUnchanged, result.Action)
+	assert.Equal(t, "2", result.RecordID)
+	assert.Equal(t, "1.2.3.4", result.PreviousValue)
+}
+
+func TestCloudflareDnsUpdateService_UpdateRecord_NewRecordId(t *testing.T) {
+	setupCloudflareConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"errors":[],"result":[]}`)),
+	}, nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodPost })).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"result":{"id":"372e67954025e0ba6aaa6d586b9e0b59","name":"bar.foo.com"}}`)),
+	}, nil).Once()
+
+	registrar, err := services.NewCloudflareDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
+	assert.Equal(t, "372e67954025e0ba6aaa6d586b9e0b59", result.RecordID)
+	assert.Empty(t, result.PreviousValue)
+}
+
+// trackedBody records whether a response body was closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestCloudflareDnsUpdateService_UpdateRecord_ClosesBodies(t *testing.T) {
+	setupCloudflareConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	jsonBytes, err := json.Marshal(&services.CloudflareQueryResponse{Result: []services.CloudflareRecord{{Name: "bar.foo.com", Id: "1"}}})
+	if err != nil {
+		t.Fatal()
+	}
+
+	query := &trackedBody{Reader: bytes.NewReader(jsonBytes)}
+	edit := &trackedBody{Reader: strings.NewReader("{}")}
+
+	h.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: query}, nil).Once()
+	h.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: edit}, nil).Once()
+
+	registrar, err := services.NewCloudflareDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = registrar.UpdateRecord(context.Background(), &services.DynDnsRequest{Subdomain: "bar", Domain: "foo.com", IP: "1.2.3.4"})
+
+	assert.Nil(t, err)
+	assert.True(t, query.closed, "query response not closed")
+	assert.True(t, edit.closed, "edit response not closed")
 }
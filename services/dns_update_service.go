@@ -1,9 +1,34 @@
 package services
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
 type Registrar string
 
+type RecordType string
+
+const (
+	RecordTypeA    RecordType = "A"
+	RecordTypeAAAA RecordType = "AAAA"
+)
+
+type UpdateAction string
+
+const (
+	ActionCreated   UpdateAction = "created"
+	ActionUpdated   UpdateAction = "updated"
+	ActionUnchanged UpdateAction = "unchanged"
+)
+
 type DnsUpdateService interface {
-	UpdateRecord(*DynDnsRequest) error
+	UpdateRecord(context.Context, *DynDnsRequest) (*UpdateResult, error)
 	Registrar() Registrar
 }
 
@@ -11,9 +36,148 @@ type DynDnsRequest struct {
 	Subdomain string
 	Domain    string
 	IP        string
+	Type      RecordType
+}
+
+// UpdateResult describes what a DnsUpdateService did to publish a record.
+type UpdateResult struct {
+	Action        UpdateAction
+	PreviousValue string
+	NewValue      string
+	RecordID      string
+	// Latency is the time spent on requests to the registrar.
+	Latency time.Duration
 }
 
+// defaultTimeout bounds a single UpdateRecord call if no <registrar>.timeout is configured.
+const defaultTimeout = 30 * time.Second
+
 type registrarSettings struct {
 	baseUrl string
 	ttl     int
+	timeout time.Duration
+	limiter *rate.Limiter
+}
+
+// RecordTypeFor returns the record type matching the address family of addr.
+func RecordTypeFor(addr netip.Addr) RecordType {
+	if addr.Unmap().Is4() {
+		return RecordTypeA
+	}
+
+	return RecordTypeAAAA
+}
+
+// recordType returns the requested record type, defaulting to A for requests that don't set one.
+func (r *DynDnsRequest) recordType() RecordType {
+	if r.Type == "" {
+		return RecordTypeA
+	}
+
+	return r.Type
+}
+
+// fqdn returns the fully qualified name of the requested record.
+func (r *DynDnsRequest) fqdn() string {
+	if r.Subdomain == "" {
+		return r.Domain
+	}
+
+	return r.Subdomain + "." + r.Domain
+}
+
+// Option configures the client a service creates to call the registrar's API if none is injected.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	metrics *Metrics
+}
+
+// WithMetrics observes the requests to the registrar's API, see InstrumentedClient.
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *clientOptions) {
+		o.metrics = metrics
+	}
+}
+
+// newHTTPClient returns the client used to call a registrar's API if none is injected. Every attempt of a retried
+// request passes the limiter, if any, and is measured without the time spent waiting for it.
+func newHTTPClient(registrar Registrar, timeout time.Duration, limiter *rate.Limiter, opts ...Option) HTTPClient {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var client HTTPClient = &http.Client{Timeout: timeout}
+	if o.metrics != nil {
+		client = NewInstrumentedClient(registrar, o.metrics, client)
+	}
+
+	client = NewTracingClient(registrar, client)
+	if limiter != nil {
+		client = NewRateLimitedClient(registrar, limiter, client)
+	}
+
+	return NewRetryingClient(registrar, client)
+}
+
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return timeout
+}
+
+// executionError returns ErrExecutingRequest for a request that failed with err, wrapping the context's error if the
+// request was cancelled or timed out. Network errors and timeouts mark the registrar unavailable, requests cancelled
+// by the client or held back by the rate limiter don't.
+func executionError(ctx context.Context, err error) error {
+	if errors.Is(err, ErrRateLimited) {
+		return fmt.Errorf("%w: %w", ErrExecutingRequest, err)
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrExecutingRequest, ctx.Err())
+	}
+
+	if ctx.Err() != nil {
+		return unavailable(fmt.Errorf("%w: %w", ErrExecutingRequest, ctx.Err()))
+	}
+
+	return unavailable(ErrExecutingRequest)
+}
+
+// statusError returns err for a response with an unexpected status, marking the registrar unavailable if it answered
+// with a server error.
+func statusError(resp *http.Response, err error) error {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return unavailable(err)
+	}
+
+	return err
+}
+
+// unavailableError marks an error as caused by the registrar being unavailable, keeping its message.
+type unavailableError struct {
+	err error
+}
+
+func unavailable(err error) error {
+	return unavailableError{err: err}
+}
+
+func (e unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e unavailableError) Unwrap() []error {
+	return []error{e.err, ErrRegistrarUnavailable}
+}
+
+// closeBody closes the body of resp, if there is one.
+func closeBody(resp *http.Response) {
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
 }
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExecutionError_MarksRegistrarUnavailable(t *testing.T) {
+	err := executionError(context.Background(), errors.New("connection refused"))
+	assert.ErrorIs(t, err, ErrExecutingRequest)
+	assert.ErrorIs(t, err, ErrRegistrarUnavailable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err = executionError(ctx, ctx.Err())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrRegistrarUnavailable)
+}
+
+func TestExecutionError_IgnoresLocalErrors(t *testing.T) {
+	err := executionError(context.Background(), ErrRateLimited)
+	assert.ErrorIs(t, err, ErrExecutingRequest)
+	assert.NotErrorIs(t, err, ErrRegistrarUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = executionError(ctx, ctx.Err())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrRegistrarUnavailable)
+}
+
+func TestStatusError(t *testing.T) {
+	err := statusError(&http.Response{StatusCode: http.StatusBadGateway}, ErrRegistrarRejectedRequest)
+	assert.EqualError(t, err, ErrRegistrarRejectedRequest.Error())
+	assert.ErrorIs(t, err, ErrRegistrarRejectedRequest)
+	assert.ErrorIs(t, err, ErrRegistrarUnavailable)
+
+	err = statusError(&http.Response{StatusCode: http.StatusForbidden}, ErrRegistrarRejectedRequest)
+	assert.NotErrorIs(t, err, ErrRegistrarUnavailable)
+}
@@ -5,8 +5,12 @@ import "errors"
 var (
 	ErrMissingInfoForServiceInit = errors.New("cannot setup service, missing config param")
 	ErrRegistrarNotFound         = errors.New("registrar not found")
+	ErrDomainNotFound            = errors.New("no registrar configured for domain")
 	ErrBuildingRequest           = errors.New("error building request")
 	ErrParsingResponse           = errors.New("error parsing api response")
 	ErrRegistrarRejectedRequest  = errors.New("registrar rejected request")
 	ErrExecutingRequest          = errors.New("error executing request")
+	ErrCircuitOpen               = errors.New("registrar unavailable after repeated failures")
+	ErrRegistrarUnavailable      = errors.New("registrar unavailable")
+	ErrRateLimited               = errors.New("rate limit not available before deadline")
 )
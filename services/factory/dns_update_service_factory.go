@@ -4,53 +4,58 @@ import (
 	"github.com/davidramiro/frigabun/services"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"strings"
 )
 
 type ServiceFactory interface {
 	Register(services.DnsUpdateService)
 	Find(services.Registrar) (services.DnsUpdateService, error)
 	ListServices() []services.Registrar
+	ResolveDomain(hostname string) (services.Registrar, string, error)
 }
 
 type DnsUpdateServiceFactory struct {
 	services map[services.Registrar]services.DnsUpdateService
+	domains  map[string]services.Registrar
 }
 
-func NewDnsUpdateServiceFactory() (*DnsUpdateServiceFactory, error) {
+// NewDnsUpdateServiceFactory registers the enabled services, creating them with opts.
+func NewDnsUpdateServiceFactory(opts ...services.Option) (*DnsUpdateServiceFactory, error) {
 	log.Debug().Msg("initializing dns service factory")
 
 	factory := &DnsUpdateServiceFactory{
 		services: make(map[services.Registrar]services.DnsUpdateService),
+		domains:  make(map[string]services.Registrar),
 	}
 
 	if viper.GetBool("cloudflare.enabled") {
 		log.Debug().Msg("cloudflare enabled, registering")
-		cloudflareService, err := services.NewCloudflareDnsUpdateService(nil)
+		cloudflareService, err := services.NewCloudflareDnsUpdateService(nil, opts...)
 		if err != nil {
 			return nil, err
 		}
 
-		factory.Register(cloudflareService)
+		factory.Register(services.NewCircuitBreaker(cloudflareService))
 	}
 
 	if viper.GetBool("gandi.enabled") {
 		log.Debug().Msg("gandi enabled, registering")
-		gandiService, err := services.NewGandiDnsUpdateService(nil)
+		gandiService, err := services.NewGandiDnsUpdateService(nil, opts...)
 		if err != nil {
 			return nil, err
 		}
 
-		factory.Register(gandiService)
+		factory.Register(services.NewCircuitBreaker(gandiService))
 	}
 
 	if viper.GetBool("porkbun.enabled") {
 		log.Debug().Msg("porkbun enabled, registering")
-		porkbunService, err := services.NewPorkbunDnsUpdateService(nil)
+		porkbunService, err := services.NewPorkbunDnsUpdateService(nil, opts...)
 		if err != nil {
 			return nil, err
 		}
 
-		factory.Register(porkbunService)
+		factory.Register(services.NewCircuitBreaker(porkbunService))
 	}
 
 	if len(factory.services) == 0 {
@@ -68,6 +73,15 @@ func (df *DnsUpdateServiceFactory) Register(service services.DnsUpdateService) {
 	key := service.Registrar()
 
 	df.services[key] = service
+
+	for _, domain := range viper.GetStringSlice(string(key) + ".domains") {
+		domain = normalizeHostname(domain)
+		if registrar, ok := df.domains[domain]; ok && registrar != key {
+			log.Warn().Str("domain", domain).Interface("registrar", registrar).Msg("domain already registered, overriding")
+		}
+
+		df.domains[domain] = key
+	}
 }
 
 func (df *DnsUpdateServiceFactory) Find(registrar services.Registrar) (service services.DnsUpdateService, err error) {
@@ -92,3 +106,26 @@ func (df *DnsUpdateServiceFactory) ListServices() []services.Registrar {
 
 	return keys
 }
+
+// ResolveDomain returns the registrar and the configured domain a hostname belongs to, preferring the longest match.
+func (df *DnsUpdateServiceFactory) ResolveDomain(hostname string) (services.Registrar, string, error) {
+	hostname = normalizeHostname(hostname)
+
+	for name := hostname; len(name) > 0; {
+		if registrar, ok := df.domains[name]; ok {
+			return registrar, name, nil
+		}
+
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			break
+		}
+		name = parent
+	}
+
+	return "", "", services.ErrDomainNotFound
+}
+
+func normalizeHostname(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+}
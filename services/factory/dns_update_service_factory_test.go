@@ -15,10 +15,12 @@ func init() {
 	viper.Set("cloudflare.apiKey", "foo")
 	viper.Set("cloudflare.zoneId", "bar")
 	viper.Set("cloudflare.ttl", 42)
+	viper.Set("cloudflare.domains", []string{"foo.com"})
 	viper.Set("gandi.enabled", true)
 	viper.Set("gandi.baseurl", "https://api.foo.com/client/v4")
 	viper.Set("gandi.apiKey", "foo")
 	viper.Set("gandi.ttl", 42)
+	viper.Set("gandi.domains", []string{"bar.com", "Sub.Foo.com."})
 	viper.Set("porkbun.enabled", true)
 	viper.Set("porkbun.baseurl", "https://api.foo.com/client/v4")
 	viper.Set("porkbun.apiKey", "foo")
@@ -49,7 +51,7 @@ func TestDnsUpdateServiceFactory_FindSuccess(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, service)
 	assert.Equal(t, "cloudflare", string(service.Registrar()))
-
+	assert.IsType(t, &services.CircuitBreaker{}, service, "services should be guarded by a circuit breaker")
 }
 
 func TestDnsUpdateServiceFactory_FindInvalidName(t *testing.T) {
@@ -57,6 +59,31 @@ func TestDnsUpdateServiceFactory_FindInvalidName(t *testing.T) {
 	assert.ErrorIs(t, err, services.ErrRegistrarNotFound)
 }
 
+func TestDnsUpdateServiceFactory_ResolveDomain(t *testing.T) {
+	registrar, domain, err := factory.ResolveDomain("foo.com")
+	assert.Nil(t, err)
+	assert.Equal(t, services.Registrar("cloudflare"), registrar)
+	assert.Equal(t, "foo.com", domain)
+
+	registrar, domain, err = factory.ResolveDomain("a.b.FOO.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, services.Registrar("cloudflare"), registrar)
+	assert.Equal(t, "foo.com", domain)
+
+	registrar, domain, err = factory.ResolveDomain("a.sub.foo.com")
+	assert.Nil(t, err)
+	assert.Equal(t, services.Registrar("gandi"), registrar)
+	assert.Equal(t, "sub.foo.com", domain)
+}
+
+func TestDnsUpdateServiceFactory_ResolveDomainNotFound(t *testing.T) {
+	_, _, err := factory.ResolveDomain("foo.org")
+	assert.ErrorIs(t, err, services.ErrDomainNotFound)
+
+	_, _, err = factory.ResolveDomain("barfoo.com")
+	assert.ErrorIs(t, err, services.ErrDomainNotFound)
+}
+
 func TestNewDnsUpdateServiceFactory_MissingParamForPorkbun(t *testing.T) {
 	viper.Set("porkbun.baseUrl", "")
 	f, err := NewDnsUpdateServiceFactory()
@@ -2,12 +2,16 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type GandiDnsUpdateService struct {
@@ -16,9 +20,10 @@ type GandiDnsUpdateService struct {
 	client HTTPClient
 }
 
-func NewGandiDnsUpdateService(client HTTPClient) (*GandiDnsUpdateService, error) {
+func NewGandiDnsUpdateService(client HTTPClient, opts ...Option) (*GandiDnsUpdateService, error) {
 	baseUrl := viper.GetString("gandi.baseUrl")
 	ttl := viper.GetInt("gandi.ttl")
+	timeout := timeoutOrDefault(viper.GetDuration("gandi.timeout"))
 	apikey := viper.GetString("gandi.apiKey")
 
 	log.Info().Msg("initializing gandi service")
@@ -27,14 +32,18 @@ func NewGandiDnsUpdateService(client HTTPClient) (*GandiDnsUpdateService, error)
 		return nil, ErrMissingInfoForServiceInit
 	}
 
+	limiter := newLimiter("gandi")
+
 	if client == nil {
-		client = &http.Client{}
+		client = newHTTPClient("gandi", timeout, limiter, opts...)
 	}
 
 	return &GandiDnsUpdateService{
 		registrarSettings: registrarSettings{
 			baseUrl: baseUrl,
 			ttl:     ttl,
+			timeout: timeout,
+			limiter: limiter,
 		},
 		apiKey: apikey,
 		client: client,
@@ -48,7 +57,7 @@ type GandiApiRequest struct {
 	IPValues  []string `json:"rrset_values"`
 }
 
-func (g *GandiDnsUpdateService) UpdateRecord(request *DynDnsRequest) error {
+func (g *GandiDnsUpdateService) UpdateRecord(ctx context.Context, request *DynDnsRequest) (*UpdateResult, error) {
 
 	if request.Subdomain == "" {
 		request.Subdomain = "@"
@@ -58,25 +67,55 @@ func (g *GandiDnsUpdateService) UpdateRecord(request *DynDnsRequest) error {
 		Subdomain: request.Subdomain,
 		IPValues:  []string{request.IP},
 		TTL:       g.ttl,
-		Type:      "A",
+		Type:      string(request.recordType()),
+	}
+
+	endpoint := fmt.Sprintf("%s/domains/%s/records/%s/%s", g.baseUrl,
+		request.Domain, gandiRequest.Subdomain, gandiRequest.Type)
+
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	result := &UpdateResult{
+		NewValue: request.IP,
+		RecordID: fmt.Sprintf("%s/%s", gandiRequest.Subdomain, gandiRequest.Type),
 	}
+	start := time.Now()
+	defer func() { result.Latency = time.Since(start) }()
+
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "UpdateRecord").Str("registrar", "gandi").Str("endpoint", endpoint).Str("type", gandiRequest.Type).Str("domain", request.Domain).Str("subdomain", request.Subdomain).Logger()
+
+	existing, err := g.queryRecord(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		result.PreviousValue = strings.Join(existing.IPValues, ",")
 
-	endpoint := fmt.Sprintf("%s/domains/%s/records/%s/A", g.baseUrl,
-		request.Domain, gandiRequest.Subdomain)
+		if len(existing.IPValues) == 1 && existing.IPValues[0] == request.IP {
+			logger.Info().Msg("record exists and is up to date, skipping")
+			result.Action = ActionUnchanged
+			return result, nil
+		}
+
+		result.Action = ActionUpdated
+	} else {
+		result.Action = ActionCreated
+	}
 
-	logger := log.With().Str("func", "UpdateRecord").Str("registrar", "gandi").Str("endpoint", endpoint).Str("domain", request.Domain).Str("subdomain", request.Subdomain).Logger()
 	logger.Info().Msg("building update request")
 
 	body, err := json.Marshal(gandiRequest)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		return nil, ErrBuildingRequest
 	}
 
-	req, err := http.NewRequest("PUT", endpoint, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
-		return ErrBuildingRequest
+		return nil, ErrBuildingRequest
 	}
 
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
@@ -85,18 +124,64 @@ func (g *GandiDnsUpdateService) UpdateRecord(request *DynDnsRequest) error {
 	resp, err := g.client.Do(req)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
-		return ErrExecutingRequest
+		return nil, executionError(ctx, err)
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != 201 {
 		b, _ := io.ReadAll(resp.Body)
 		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
-		return ErrRegistrarRejectedRequest
+		return nil, statusError(resp, ErrRegistrarRejectedRequest)
+	}
+
+	logger.Info().Str("action", string(result.Action)).Msg("update request successful")
+
+	return result, nil
+}
+
+// queryRecord returns the current record set, nil if it doesn't exist.
+func (g *GandiDnsUpdateService) queryRecord(ctx context.Context, endpoint string) (*GandiApiRequest, error) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "queryRecord").Str("registrar", "gandi").Str("endpoint", endpoint).Logger()
+	logger.Info().Msg("query for existing record")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
+		return nil, ErrBuildingRequest
+	}
+
+	req.Header.Set("Authorization", "Apikey "+g.apiKey)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
+		return nil, executionError(ctx, err)
+	}
+	defer closeBody(resp)
+
+	if resp.StatusCode == http.StatusNotFound {
+		logger.Info().Msg("record not found")
+		return nil, nil
+	}
+
+	b, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
+		return nil, statusError(resp, ErrRegistrarRejectedRequest)
+	}
+
+	var record GandiApiRequest
+
+	err = json.Unmarshal(b, &record)
+	if err != nil {
+		logger.Error().Err(err).Msg(ErrParsingResponse.Error())
+		return nil, ErrParsingResponse
 	}
 
-	logger.Info().Msg("update request successful")
+	logger.Info().Strs("values", record.IPValues).Msg("record found")
 
-	return nil
+	return &record, nil
 }
 
 func (g *GandiDnsUpdateService) Registrar() Registrar {
@@ -2,16 +2,20 @@ package services_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
 	"github.com/davidramiro/frigabun/services"
+	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func setupGandiConfig() {
@@ -58,30 +62,52 @@ func TestGandiDnsUpdateService_UpdateRecord_RequestError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.Errorf(t, err, "gd api request error")
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Nil(t, result)
 }
 
 func TestGandiDnsUpdateService_UpdateRecord_ApiError(t *testing.T) {
 	setupGandiConfig()
 	h := mockservices.NewMockHTTPClient(t)
 
-	resp := &services.CloudflareQueryResponse{
-		Errors: []struct {
-			Message string `json:"message"`
-		}{{Message: "error"}},
-		Result: nil,
-	}
+	h.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Body:       io.NopCloser(strings.NewReader(`{"message":"error"}`)),
+	}, nil).Once()
 
-	jsonBytes, err := json.Marshal(resp)
+	registrar, err := services.NewGandiDnsUpdateService(h)
 	if err != nil {
-		t.Fatal()
+		t.Fatal(err)
 	}
 
-	h.On("Do", mock.AnythingOfType("*http.Request")).Return(&http.Response{
-		StatusCode: http.StatusInternalServerError,
-		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	req := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), req)
+
+	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Nil(t, result)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_UpdateApiError(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodPut })).Return(&http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       io.NopCloser(strings.NewReader(`{"message":"error"}`)),
 	}, nil).Once()
 
 	registrar, err := services.NewGandiDnsUpdateService(h)
@@ -95,33 +121,125 @@ func TestGandiDnsUpdateService_UpdateRecord_ApiError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.NotErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.Nil(t, result)
+}
+
+func gandiRecordResponse(t *testing.T, values ...string) *http.Response {
+	jsonBytes, err := json.Marshal(&services.GandiApiRequest{
+		Subdomain: "bar",
+		Type:      "A",
+		TTL:       42,
+		IPValues:  values,
+	})
+	if err != nil {
+		t.Fatal()
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	}
 }
 
 func TestGandiDnsUpdateService_UpdateRecord_Success(t *testing.T) {
 	setupGandiConfig()
 	h := mockservices.NewMockHTTPClient(t)
 
-	resp := &services.CloudflareQueryResponse{
-		Errors: []struct {
-			Message string `json:"message"`
-		}{},
-		Result: []struct {
-			Name string `json:"name"`
-			Id   string `json:"id"`
-		}{{Name: "bar.foo.com", Id: "1"}},
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).
+		Return(gandiRecordResponse(t, "1.2.3.5"), nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodPut })).Return(&http.Response{
+		StatusCode: http.StatusCreated,
+		Body:       io.NopCloser(strings.NewReader(`{"message":"DNS Record Created"}`)),
+	}, nil).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
 	}
 
-	jsonBytes, err := json.Marshal(resp)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUpdated, result.Action)
+	assert.Equal(t, "1.2.3.5", result.PreviousValue)
+	assert.Equal(t, "1.2.3.4", result.NewValue)
+	assert.Equal(t, "bar/A", result.RecordID)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_ContextLogger(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).
+		Return(gandiRecordResponse(t, "1.2.3.4"), nil).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
 	if err != nil {
-		t.Fatal()
+		t.Fatal(err)
 	}
 
-	h.On("Do", mock.Anything).Return(&http.Response{
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).With().Str("request_id", "abc123").Logger().WithContext(context.Background())
+
+	_, err = registrar.UpdateRecord(ctx, &services.DynDnsRequest{Subdomain: "bar", Domain: "foo.com", IP: "1.2.3.4"})
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `"request_id":"abc123"`)
+	assert.Contains(t, buf.String(), "record exists and is up to date, skipping")
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_Unchanged(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).
+		Return(gandiRecordResponse(t, "1.2.3.4"), nil).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUnchanged, result.Action)
+	assert.Equal(t, "1.2.3.4", result.PreviousValue)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_AAAA(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == http.MethodGet && r.URL.Path == "/client/v4/domains/foo.com/records/bar/AAAA"
+	})).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == http.MethodPut && r.URL.Path == "/client/v4/domains/foo.com/records/bar/AAAA"
+	})).Return(&http.Response{
 		StatusCode: http.StatusCreated,
-		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+		Body:       io.NopCloser(strings.NewReader("")),
 	}, nil).Once()
 
 	registrar, err := services.NewGandiDnsUpdateService(h)
@@ -129,13 +247,95 @@ func TestGandiDnsUpdateService_UpdateRecord_Success(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "2001:db8::1",
+		Type:      services.RecordTypeAAAA,
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_Deadline(t *testing.T) {
+	setupGandiConfig()
+	viper.Set("gandi.timeout", "5s")
+	defer viper.Set("gandi.timeout", nil)
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		deadline, ok := r.Context().Deadline()
+		return ok && time.Until(deadline) <= 5*time.Second
+	})).Return(gandiRecordResponse(t, "1.2.3.4"), nil).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUnchanged, result.Action)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_Cancelled(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.AnythingOfType("*http.Request")).Return(nil, context.Canceled).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
 	dynReq := &services.DynDnsRequest{
 		Subdomain: "bar",
 		Domain:    "foo.com",
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(ctx, dynReq)
+
+	assert.ErrorIs(t, err, services.ErrExecutingRequest)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, result)
+}
+
+func TestGandiDnsUpdateService_UpdateRecord_ClosesBodies(t *testing.T) {
+	setupGandiConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	resp := gandiRecordResponse(t, "1.2.3.5")
+	query := &trackedBody{Reader: resp.Body}
+	resp.Body = query
+	update := &trackedBody{Reader: strings.NewReader(`{"message":"DNS Record Created"}`)}
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodGet })).Return(resp, nil).Once()
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool { return r.Method == http.MethodPut })).
+		Return(&http.Response{StatusCode: http.StatusCreated, Body: update}, nil).Once()
+
+	registrar, err := services.NewGandiDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = registrar.UpdateRecord(context.Background(), &services.DynDnsRequest{Subdomain: "bar", Domain: "foo.com", IP: "1.2.3.4"})
 
 	assert.Nil(t, err)
+	assert.True(t, query.closed, "query response not closed")
+	assert.True(t, update.closed, "update response not closed")
 }
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics holds the metrics of requests to registrar APIs. Create it once per registerer and share it between the
+// services, registering the same metrics twice fails.
+type Metrics struct {
+	requestDuration *prometheus.HistogramVec
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	factory := promauto.With(registerer)
+
+	return &Metrics{
+		requestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "frigabun",
+			Subsystem: "registrar",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of requests to registrar APIs, code is \"error\" if no response was received.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"registrar", "method", "code"}),
+	}
+}
+
+// InstrumentedClient observes the duration and outcome of every request sent to a registrar.
+type InstrumentedClient struct {
+	client    HTTPClient
+	registrar Registrar
+	metrics   *Metrics
+}
+
+func NewInstrumentedClient(registrar Registrar, metrics *Metrics, client HTTPClient) *InstrumentedClient {
+	return &InstrumentedClient{client: client, registrar: registrar, metrics: metrics}
+}
+
+func (i *InstrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	resp, err := i.client.Do(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+
+	i.metrics.requestDuration.WithLabelValues(string(i.registrar), req.Method, code).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// observedRequests returns the number of observed requests by registrar, method and code.
+func observedRequests(t *testing.T, registry *prometheus.Registry) map[string]uint64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observed := make(map[string]uint64)
+	for _, family := range families {
+		if family.GetName() != "frigabun_registrar_request_duration_seconds" {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			observed[labels["registrar"]+" "+labels["method"]+" "+labels["code"]] = m.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return observed
+}
+
+func TestInstrumentedClient_ObservesRequests(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusOK, nil), nil).Twice()
+	h.On("Do", mock.Anything).Return(nil, errors.New("connection refused")).Once()
+
+	client := services.NewInstrumentedClient("gandi", services.NewMetrics(registry), h)
+
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/domains", nil)
+		_, _ = client.Do(req)
+	}
+
+	assert.Equal(t, map[string]uint64{"gandi GET 200": 2, "gandi GET error": 1}, observedRequests(t, registry))
+}
+
+func TestNewMetrics_RegistersOnce(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	services.NewMetrics(registry)
+
+	assert.Panics(t, func() { services.NewMetrics(registry) })
+}
+
+func TestWithMetrics_InstrumentsServiceClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	setupGandiConfig()
+	viper.Set("gandi.baseurl", server.URL)
+	t.Cleanup(setupGandiConfig)
+
+	registry := prometheus.NewRegistry()
+	registrar, err := services.NewGandiDnsUpdateService(nil, services.WithMetrics(services.NewMetrics(registry)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), &services.DynDnsRequest{Subdomain: "bar", Domain: "foo.com", IP: "1.2.3.4"})
+	assert.NoError(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
+
+	assert.Equal(t, map[string]uint64{"gandi GET 404": 1, "gandi PUT 201": 1}, observedRequests(t, registry))
+}
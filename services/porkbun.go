@@ -2,12 +2,15 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"io"
 	"net/http"
+	"time"
 )
 
 type PorkbunDnsUpdateService struct {
@@ -17,9 +20,10 @@ type PorkbunDnsUpdateService struct {
 	client       HTTPClient
 }
 
-func NewPorkbunDnsUpdateService(client HTTPClient) (*PorkbunDnsUpdateService, error) {
+func NewPorkbunDnsUpdateService(client HTTPClient, opts ...Option) (*PorkbunDnsUpdateService, error) {
 	baseUrl := viper.GetString("porkbun.baseUrl")
 	ttl := viper.GetInt("porkbun.ttl")
+	timeout := timeoutOrDefault(viper.GetDuration("porkbun.timeout"))
 	apikey := viper.GetString("porkbun.apiKey")
 	SecretApiKey := viper.GetString("porkbun.secretApiKey")
 
@@ -29,14 +33,18 @@ func NewPorkbunDnsUpdateService(client HTTPClient) (*PorkbunDnsUpdateService, er
 		return nil, ErrMissingInfoForServiceInit
 	}
 
+	limiter := newLimiter("porkbun")
+
 	if client == nil {
-		client = &http.Client{}
+		client = newHTTPClient("porkbun", timeout, limiter, opts...)
 	}
 
 	return &PorkbunDnsUpdateService{
 		registrarSettings: registrarSettings{
 			baseUrl: baseUrl,
 			ttl:     ttl,
+			timeout: timeout,
+			limiter: limiter,
 		},
 		apiKey:       apikey,
 		secretApiKey: SecretApiKey,
@@ -53,154 +61,187 @@ type PorkbunApiRequest struct {
 	SecretApiKey string `json:"secretapikey"`
 }
 
+type PorkbunRecord struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
 type PorkbunQueryResponse struct {
-	Status  string `json:"status"`
-	Records []struct {
-		Name    string `json:"name"`
-		Content string `json:"content"`
-	} `json:"records"`
+	Status  string          `json:"status"`
+	Records []PorkbunRecord `json:"records"`
 }
 
-func (p *PorkbunDnsUpdateService) UpdateRecord(request *DynDnsRequest) error {
+type PorkbunCreateResponse struct {
+	Status string      `json:"status"`
+	Id     json.Number `json:"id"`
+}
+
+func (p *PorkbunDnsUpdateService) UpdateRecord(ctx context.Context, request *DynDnsRequest) (*UpdateResult, error) {
 	porkbunRequest := &PorkbunApiRequest{
 		Name:         request.Subdomain,
 		IP:           request.IP,
 		TTL:          p.ttl,
-		Type:         "A",
+		Type:         string(request.recordType()),
 		ApiKey:       p.apiKey,
 		SecretApiKey: p.secretApiKey,
 	}
 
-	logger := log.With().Str("func", "UpdateRecord").Str("registrar", "porkbun").Str("domain", request.Domain).Str("subdomain", request.Subdomain).Logger()
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	result := &UpdateResult{NewValue: request.IP}
+	start := time.Now()
+	defer func() { result.Latency = time.Since(start) }()
+
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "UpdateRecord").Str("registrar", "porkbun").Str("type", porkbunRequest.Type).Str("domain", request.Domain).Str("subdomain", request.Subdomain).Logger()
 	logger.Info().Msg("building update request")
 
-	exists, fullmatch, err := p.queryRecordExists(request, porkbunRequest)
+	existing, err := p.queryRecord(ctx, request, porkbunRequest)
 	if err != nil {
 		logger.Err(err).Msg("error querying if record exists")
-		return err
+		return nil, err
 	}
 
-	if fullmatch {
-		logger.Info().Msg("record exists and is up to date, skipping")
-		return nil
-	}
+	if existing != nil {
+		result.PreviousValue = existing.Content
+		result.RecordID = existing.Id
+
+		if existing.Content == request.IP {
+			logger.Info().Msg("record exists and is up to date, skipping")
+			result.Action = ActionUnchanged
+			return result, nil
+		}
 
-	if exists {
 		logger.Info().Msg("record exists, updating")
-		err := p.updateRecord(request, porkbunRequest)
+		err := p.updateRecord(ctx, request, porkbunRequest)
 
 		if err != nil {
-			logger.Error().Err(err).Msg(ErrRegistrarRejectedRequest.Error())
-			return ErrRegistrarRejectedRequest
+			logger.Error().Err(err).Msg("error updating record")
+			return nil, err
 		}
 
+		result.Action = ActionUpdated
 	} else {
 		logger.Info().Msg("record does not exist, creating")
-		err := p.createRecord(request, porkbunRequest)
+		id, err := p.createRecord(ctx, request, porkbunRequest)
 
 		if err != nil {
-			logger.Error().Err(err).Msg(ErrRegistrarRejectedRequest.Error())
-			return ErrRegistrarRejectedRequest
+			logger.Error().Err(err).Msg("error creating record")
+			return nil, err
 		}
+
+		result.Action = ActionCreated
+		result.RecordID = id
 	}
 
-	logger.Info().Msg("update request successful")
+	logger.Info().Str("action", string(result.Action)).Msg("update request successful")
 
-	return nil
+	return result, nil
 }
 
-func (p *PorkbunDnsUpdateService) queryRecordExists(request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) (bool, bool, error) {
-	endpoint := fmt.Sprintf("%s/dns/retrieveByNameType/%s/A/%s", p.baseUrl, request.Domain, request.Subdomain)
+// queryRecord returns the existing record matching the request, preferring one that is already up to date.
+// Returns nil if no record exists.
+func (p *PorkbunDnsUpdateService) queryRecord(ctx context.Context, request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) (*PorkbunRecord, error) {
+	endpoint := fmt.Sprintf("%s/dns/retrieveByNameType/%s/%s/%s", p.baseUrl, request.Domain, porkbunRequest.Type, request.Subdomain)
 
-	logger := log.With().Str("func", "createRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "queryRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
 	logger.Info().Msg("query for existing record")
 
 	var r PorkbunQueryResponse
 
-	resp, err := p.executeRequest(endpoint, porkbunRequest)
+	resp, err := p.executeRequest(withIdempotent(ctx), endpoint, porkbunRequest)
 	if err != nil {
-		return false, false, err
+		return nil, err
 	}
+	defer closeBody(resp)
 
 	b, _ := io.ReadAll(resp.Body)
 	err = json.Unmarshal(b, &r)
 
 	if resp.StatusCode != http.StatusOK || r.Status != "SUCCESS" || err != nil {
 		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
-		return false, false, ErrRegistrarRejectedRequest
+		return nil, statusError(resp, ErrRegistrarRejectedRequest)
 	}
 
-	found := false
-	fullMatch := false
-
-	if r.Status == "SUCCESS" && len(r.Records) > 0 {
-		for _, e := range r.Records {
-			logger.Info().Msg("record found")
+	var found *PorkbunRecord
+	expected := request.fqdn()
 
-			var expected string
-			if request.Subdomain == "" {
-				expected = request.Domain
-			} else {
-				expected = fmt.Sprintf("%s.%s", request.Subdomain, request.Domain)
-			}
+	for i, e := range r.Records {
+		if e.Name != expected {
+			continue
+		}
 
-			if e.Name == expected {
-				found = true
-			}
+		logger.Info().Str("content", e.Content).Msg("record found")
 
-			if e.Name == expected && e.Content == request.IP {
-				fullMatch = true
-			}
+		if found == nil || e.Content == request.IP {
+			found = &r.Records[i]
 		}
 	}
 
-	log.Info().Bool("record_found", found).Bool("full_match", fullMatch).Msg("query result")
+	zerolog.Ctx(ctx).Info().Ctx(ctx).Bool("record_found", found != nil).Bool("full_match", found != nil && found.Content == request.IP).Msg("query result")
 
-	return found, fullMatch, nil
+	return found, nil
 }
 
-func (p *PorkbunDnsUpdateService) createRecord(request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) error {
+// createRecord creates a new record and returns its ID.
+func (p *PorkbunDnsUpdateService) createRecord(ctx context.Context, request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) (string, error) {
 	endpoint := fmt.Sprintf("%s/dns/create/%s", p.baseUrl, request.Domain)
 
-	logger := log.With().Str("func", "createRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "createRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
 	logger.Info().Msg("creating record")
 
-	resp, err := p.executeRequest(endpoint, porkbunRequest)
+	resp, err := p.executeRequest(ctx, endpoint, porkbunRequest)
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
 		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
-		return ErrRegistrarRejectedRequest
+		return "", statusError(resp, ErrRegistrarRejectedRequest)
 	}
 
-	return nil
+	if resp.Body == nil {
+		return "", nil
+	}
+
+	var r PorkbunCreateResponse
+
+	b, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &r); err != nil {
+		logger.Debug().Bytes("response", b).Msg("no record id in response")
+		return "", nil
+	}
+
+	return r.Id.String(), nil
 }
 
-func (p *PorkbunDnsUpdateService) updateRecord(request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) error {
-	endpoint := fmt.Sprintf("%s/dns/editByNameType/%s/A/%s", p.baseUrl, request.Domain, request.Subdomain)
+func (p *PorkbunDnsUpdateService) updateRecord(ctx context.Context, request *DynDnsRequest, porkbunRequest *PorkbunApiRequest) error {
+	endpoint := fmt.Sprintf("%s/dns/editByNameType/%s/%s/%s", p.baseUrl, request.Domain, porkbunRequest.Type, request.Subdomain)
 
-	logger := log.With().Str("func", "updateRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "updateRecord").Str("registrar", "porkbun").Str("subdomain", request.Subdomain).Str("endpoint", endpoint).Str("IP", request.IP).Logger()
 	logger.Info().Msg("updating record")
 
-	resp, err := p.executeRequest(endpoint, porkbunRequest)
+	resp, err := p.executeRequest(withIdempotent(ctx), endpoint, porkbunRequest)
 	if err != nil {
 		return err
 	}
+	defer closeBody(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
 		logger.Error().Bytes("response", b).Msg(ErrRegistrarRejectedRequest.Error())
-		return ErrRegistrarRejectedRequest
+		return statusError(resp, ErrRegistrarRejectedRequest)
 	}
 
 	return nil
 }
 
-func (p *PorkbunDnsUpdateService) executeRequest(endpoint string, porkbunRequest *PorkbunApiRequest) (*http.Response, error) {
-	logger := log.With().Str("func", "executeRequest").Str("registrar", "porkbun").Str("endpoint", endpoint).Str("subdomain", porkbunRequest.Name).Logger()
+// executeRequest posts porkbunRequest to endpoint, the caller has to close the body of the response.
+func (p *PorkbunDnsUpdateService) executeRequest(ctx context.Context, endpoint string, porkbunRequest *PorkbunApiRequest) (*http.Response, error) {
+	logger := zerolog.Ctx(ctx).With().Ctx(ctx).Str("func", "executeRequest").Str("registrar", "porkbun").Str("endpoint", endpoint).Str("subdomain", porkbunRequest.Name).Logger()
 	logger.Info().Msg("building update request")
 
 	body, err := json.Marshal(porkbunRequest)
@@ -209,7 +250,7 @@ func (p *PorkbunDnsUpdateService) executeRequest(endpoint string, porkbunRequest
 		return nil, ErrBuildingRequest
 	}
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrBuildingRequest.Error())
 		return nil, ErrBuildingRequest
@@ -219,7 +260,7 @@ func (p *PorkbunDnsUpdateService) executeRequest(endpoint string, porkbunRequest
 	resp, err := p.client.Do(req)
 	if err != nil {
 		logger.Error().Err(err).Msg(ErrExecutingRequest.Error())
-		return nil, ErrExecutingRequest
+		return nil, executionError(ctx, err)
 	}
 
 	logger.Info().Msg("request successful")
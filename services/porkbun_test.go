@@ -2,6 +2,7 @@ package services_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
@@ -60,9 +61,10 @@ func TestPorkbunDnsUpdateService_UpdateRecord_RequestError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.Errorf(t, err, "pb api request error")
+	assert.Nil(t, result)
 }
 
 func TestPorkbunDnsUpdateService_UpdateRecord_ApiError(t *testing.T) {
@@ -70,11 +72,8 @@ func TestPorkbunDnsUpdateService_UpdateRecord_ApiError(t *testing.T) {
 	h := mockservices.NewMockHTTPClient(t)
 
 	resp := &services.PorkbunQueryResponse{
-		Status: "ERROR",
-		Records: []struct {
-			Name    string `json:"name"`
-			Content string `json:"content"`
-		}{},
+		Status:  "ERROR",
+		Records: []services.PorkbunRecord{},
 	}
 
 	jsonBytes, err := json.Marshal(resp)
@@ -98,9 +97,10 @@ func TestPorkbunDnsUpdateService_UpdateRecord_ApiError(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(req)
+	result, err := registrar.UpdateRecord(context.Background(), req)
 
 	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.Nil(t, result)
 }
 
 func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Success(t *testing.T) {
@@ -108,11 +108,8 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Success(t *testing.T) {
 	h := mockservices.NewMockHTTPClient(t)
 
 	queryResp := &services.PorkbunQueryResponse{
-		Status: "SUCCESS",
-		Records: []struct {
-			Name    string `json:"name"`
-			Content string `json:"content"`
-		}{{Name: "bar.foo.com", Content: "1.2.3.5"}},
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com", Content: "1.2.3.5"}},
 	}
 
 	jsonBytes, err := json.Marshal(queryResp)
@@ -141,9 +138,10 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Success(t *testing.T) {
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUpdated, result.Action)
 }
 
 func TestPorkbunDnsUpdateService_UpdateRecord_Exists_With_Matching_IP_Skipping(t *testing.T) {
@@ -151,11 +149,8 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_With_Matching_IP_Skipping(t
 	h := mockservices.NewMockHTTPClient(t)
 
 	queryResp := &services.PorkbunQueryResponse{
-		Status: "SUCCESS",
-		Records: []struct {
-			Name    string `json:"name"`
-			Content string `json:"content"`
-		}{{Name: "bar.foo.com", Content: "1.2.3.4"}},
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com", Content: "1.2.3.4"}},
 	}
 
 	jsonBytes, err := json.Marshal(queryResp)
@@ -179,9 +174,10 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_With_Matching_IP_Skipping(t
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUnchanged, result.Action)
 }
 
 func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Failure_On_Update(t *testing.T) {
@@ -189,11 +185,8 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Failure_On_Update(t *testin
 	h := mockservices.NewMockHTTPClient(t)
 
 	queryResp := &services.PorkbunQueryResponse{
-		Status: "SUCCESS",
-		Records: []struct {
-			Name    string `json:"name"`
-			Content string `json:"content"`
-		}{{Name: "bar.foo.com"}},
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com"}},
 	}
 
 	jsonBytes, err := json.Marshal(queryResp)
@@ -222,9 +215,50 @@ func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Failure_On_Update(t *testin
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.Nil(t, result)
+}
+
+func TestPorkbunDnsUpdateService_UpdateRecord_Exists_Execution_Error_On_Update(t *testing.T) {
+	setupPorkbunConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	queryResp := &services.PorkbunQueryResponse{
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com"}},
+	}
+
+	jsonBytes, err := json.Marshal(queryResp)
+	if err != nil {
+		t.Fatal()
+	}
+
+	h.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	}, nil).Once()
+
+	h.On("Do", mock.Anything).Return(nil, errors.New("connection reset")).Once()
+
+	registrar, err := services.NewPorkbunDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.ErrorIs(t, err, services.ErrExecutingRequest)
+	assert.ErrorIs(t, err, services.ErrRegistrarUnavailable)
+	assert.NotErrorIs(t, err, services.ErrRegistrarRejectedRequest)
+	assert.Nil(t, result)
 }
 
 func TestPorkbunDnsUpdateService_UpdateRecord_NotExists_Failure_On_Create(t *testing.T) {
@@ -232,11 +266,8 @@ func TestPorkbunDnsUpdateService_UpdateRecord_NotExists_Failure_On_Create(t *tes
 	h := mockservices.NewMockHTTPClient(t)
 
 	queryResp := &services.PorkbunQueryResponse{
-		Status: "SUCCESS",
-		Records: []struct {
-			Name    string `json:"name"`
-			Content string `json:"content"`
-		}{},
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{},
 	}
 
 	jsonBytes, err := json.Marshal(queryResp)
@@ -265,7 +296,117 @@ func TestPorkbunDnsUpdateService_UpdateRecord_NotExists_Failure_On_Create(t *tes
 		IP:        "1.2.3.4",
 	}
 
-	err = registrar.UpdateRecord(dynReq)
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
 
 	assert.EqualError(t, err, services.ErrRegistrarRejectedRequest.Error())
+	assert.Nil(t, result)
+}
+
+func TestPorkbunDnsUpdateService_UpdateRecord_AAAA(t *testing.T) {
+	setupPorkbunConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	queryResp := &services.PorkbunQueryResponse{
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com", Content: "2001:db8::2"}},
+	}
+
+	jsonBytes, err := json.Marshal(queryResp)
+	if err != nil {
+		t.Fatal()
+	}
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/client/v4/dns/retrieveByNameType/foo.com/AAAA/bar"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(jsonBytes)),
+	}, nil).Once()
+
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return r.URL.Path == "/client/v4/dns/editByNameType/foo.com/AAAA/bar"
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       nil,
+	}, nil).Once()
+
+	registrar, err := services.NewPorkbunDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "2001:db8::1",
+		Type:      services.RecordTypeAAAA,
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionUpdated, result.Action)
+}
+
+func TestPorkbunDnsUpdateService_UpdateRecord_NotExists_Created(t *testing.T) {
+	setupPorkbunConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	h.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"status":"SUCCESS","records":[]}`)),
+	}, nil).Once()
+
+	h.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"status":"SUCCESS","id":106926659}`)),
+	}, nil).Once()
+
+	registrar, err := services.NewPorkbunDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.Nil(t, err)
+	assert.Equal(t, services.ActionCreated, result.Action)
+	assert.Equal(t, "106926659", result.RecordID)
+	assert.Equal(t, "1.2.3.4", result.NewValue)
+}
+
+func TestPorkbunDnsUpdateService_UpdateRecord_ClosesBodies(t *testing.T) {
+	setupPorkbunConfig()
+	h := mockservices.NewMockHTTPClient(t)
+
+	jsonBytes, err := json.Marshal(&services.PorkbunQueryResponse{
+		Status:  "SUCCESS",
+		Records: []services.PorkbunRecord{{Name: "bar.foo.com", Content: "1.2.3.5"}},
+	})
+	if err != nil {
+		t.Fatal()
+	}
+
+	query := &trackedBody{Reader: bytes.NewReader(jsonBytes)}
+	update := &trackedBody{Reader: strings.NewReader(`{"status":"SUCCESS"}`)}
+
+	h.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: query}, nil).Once()
+	h.On("Do", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK, Body: update}, nil).Once()
+
+	registrar, err := services.NewPorkbunDnsUpdateService(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = registrar.UpdateRecord(context.Background(), &services.DynDnsRequest{Subdomain: "bar", Domain: "foo.com", IP: "1.2.3.4"})
+
+	assert.Nil(t, err)
+	assert.True(t, query.closed, "query response not closed")
+	assert.True(t, update.closed, "update response not closed")
 }
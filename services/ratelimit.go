@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+	"net/http"
+)
+
+// RateLimitStatus is a snapshot of a registrar's outbound rate limiter.
+type RateLimitStatus struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+	// Tokens is the number of requests that can be sent right away, negative if requests are queued.
+	Tokens float64 `json:"tokens"`
+}
+
+// RateLimited is implemented by services limiting the requests sent to their registrar.
+type RateLimited interface {
+	// RateLimit returns the current state of the limiter, nil if requests aren't limited.
+	RateLimit() *RateLimitStatus
+}
+
+// RateLimitedClient delays requests to stay within a token bucket limit. Requests that would have to wait past the
+// deadline of their context fail immediately.
+type RateLimitedClient struct {
+	client    HTTPClient
+	registrar Registrar
+	limiter   *rate.Limiter
+}
+
+func NewRateLimitedClient(registrar Registrar, limiter *rate.Limiter, client HTTPClient) *RateLimitedClient {
+	return &RateLimitedClient{client: client, registrar: registrar, limiter: limiter}
+}
+
+func (r *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	if err := r.limiter.Wait(req.Context()); err != nil {
+		zerolog.Ctx(req.Context()).Warn().Ctx(req.Context()).Err(err).Str("registrar", string(r.registrar)).Str("endpoint", req.URL.Path).
+			Msg(ErrRateLimited.Error())
+		return nil, fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+
+	return r.client.Do(req)
+}
+
+// newLimiter returns the limiter configured in <registrar>.rateLimit, nil if requests aren't limited.
+func newLimiter(registrar Registrar) *rate.Limiter {
+	key := string(registrar) + ".rateLimit."
+
+	limit := viper.GetFloat64(key + "requestsPerSecond")
+	if limit <= 0 {
+		return nil
+	}
+
+	burst := viper.GetInt(key + "burst")
+	if burst <= 0 {
+		burst = 1
+	}
+
+	log.Info().Str("registrar", string(registrar)).Float64("requests_per_second", limit).Int("burst", burst).
+		Msg("limiting requests to registrar")
+
+	return rate.NewLimiter(rate.Limit(limit), burst)
+}
+
+func (s *registrarSettings) RateLimit() *RateLimitStatus {
+	if s.limiter == nil {
+		return nil
+	}
+
+	return &RateLimitStatus{
+		RequestsPerSecond: float64(s.limiter.Limit()),
+		Burst:             s.limiter.Burst(),
+		Tokens:            s.limiter.Tokens(),
+	}
+}
@@ -0,0 +1,66 @@
+package services_test
+
+import (
+	"context"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/time/rate"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedClient_DelaysRequests(t *testing.T) {
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusOK, nil), nil).Times(3)
+
+	client := services.NewRateLimitedClient("gandi", rate.NewLimiter(rate.Every(50*time.Millisecond), 1), h)
+
+	start := time.Now()
+	for range 3 {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/domains", nil)
+		_, err := client.Do(req)
+		assert.Nil(t, err)
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRateLimitedClient_FailsIfDeadlineTooShort(t *testing.T) {
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusOK, nil), nil).Once()
+
+	client := services.NewRateLimitedClient("gandi", rate.NewLimiter(rate.Every(time.Minute), 1), h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.foo.com/domains", nil)
+	_, err := client.Do(req)
+	assert.Nil(t, err)
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://api.foo.com/domains", nil)
+	resp, err := client.Do(req)
+	assert.ErrorIs(t, err, services.ErrRateLimited)
+	assert.Nil(t, resp)
+}
+
+func TestRateLimit_Status(t *testing.T) {
+	setupGandiConfig()
+	registrar, _ := services.NewGandiDnsUpdateService(nil)
+	assert.Nil(t, registrar.RateLimit())
+
+	setupGandiConfig()
+	viper.Set("gandi.rateLimit.requestsPerSecond", 0.5)
+	viper.Set("gandi.rateLimit.burst", 3)
+	defer viper.Set("gandi.rateLimit", nil)
+
+	registrar, _ = services.NewGandiDnsUpdateService(nil)
+	if assert.NotNil(t, registrar.RateLimit()) {
+		assert.Equal(t, 0.5, registrar.RateLimit().RequestsPerSecond)
+		assert.Equal(t, 3, registrar.RateLimit().Burst)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"github.com/davidramiro/frigabun/internal/backoff"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryMinDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay = 10 * time.Second
+)
+
+// RetryingClient repeats requests failing with network errors or transient status codes, waiting with jittered
+// exponential backoff or as long as the registrar asks for via Retry-After. Requests that aren't idempotent are only
+// repeated if the registrar rate limited them, as they might have been applied otherwise.
+type RetryingClient struct {
+	client    HTTPClient
+	registrar Registrar
+	// attempts is the total number of calls, including the first one
+	attempts int
+	minDelay time.Duration
+	maxDelay time.Duration
+}
+
+// NewRetryingClient wraps client with the retry budget configured in <registrar>.retry.
+func NewRetryingClient(registrar Registrar, client HTTPClient) *RetryingClient {
+	key := string(registrar) + ".retry."
+
+	r := &RetryingClient{
+		client:    client,
+		registrar: registrar,
+		attempts:  viper.GetInt(key + "attempts"),
+		minDelay:  viper.GetDuration(key + "minDelay"),
+		maxDelay:  viper.GetDuration(key + "maxDelay"),
+	}
+
+	if !viper.IsSet(key+"attempts") || r.attempts < 0 {
+		r.attempts = defaultRetryAttempts
+	}
+	if r.minDelay <= 0 {
+		r.minDelay = defaultRetryMinDelay
+	}
+	if r.maxDelay <= 0 {
+		r.maxDelay = defaultRetryMaxDelay
+	}
+
+	return r
+}
+
+type idempotentKey struct{}
+
+// withIdempotent marks requests built with the returned context as safe to repeat, regardless of their method.
+func withIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func (r *RetryingClient) Do(req *http.Request) (*http.Response, error) {
+	logger := zerolog.Ctx(req.Context()).With().Ctx(req.Context()).Str("func", "Do").Str("registrar", string(r.registrar)).
+		Str("method", req.Method).Str("endpoint", req.URL.Path).Logger()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.client.Do(req)
+
+		if attempt >= r.attempts || !r.retryable(req, resp, err) {
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header); ok {
+				if after > r.maxDelay {
+					logger.Warn().Dur("retry_after", after).Msg("registrar asked to wait longer than allowed, giving up")
+					return resp, err
+				}
+				delay = after
+			}
+		}
+
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		event := logger.Warn().Int("attempt", attempt).Dur("delay", delay)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("status", resp.StatusCode)
+		}
+		event.Msg("request failed, retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// retryable reports whether a request may be repeated after the given outcome.
+func (r *RetryingClient) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !idempotent(req) {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// backoff returns a random delay between half and all of the attempt's exponentially growing limit, capped at maxDelay.
+func (r *RetryingClient) backoff(attempt int) time.Duration {
+	limit := backoff.Limit(r.minDelay, r.maxDelay, attempt)
+	return limit/2 + rand.N(limit/2+1)
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// retryAfter parses the delay requested via Retry-After, either in seconds or as a date, or via RateLimit-Reset.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return max(time.Until(date), 0), true
+		}
+	}
+
+	if value := header.Get("RateLimit-Reset"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
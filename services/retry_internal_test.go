@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryingClient_BackoffGrowsUpToMaxDelay(t *testing.T) {
+	r := &RetryingClient{minDelay: 100 * time.Millisecond, maxDelay: time.Second}
+
+	for attempt, limit := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		64: time.Second,
+	} {
+		delay := r.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, limit/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, limit, "attempt %d", attempt)
+	}
+}
+
+func TestRetryingClient_BackoffDoesNotOverflow(t *testing.T) {
+	r := &RetryingClient{minDelay: time.Hour, maxDelay: math.MaxInt64}
+
+	for _, attempt := range []int{1, 30, 40, 64, 1000, math.MaxInt} {
+		assert.Positive(t, r.backoff(attempt), "attempt %d", attempt)
+	}
+
+	r = &RetryingClient{minDelay: time.Minute, maxDelay: time.Second}
+	assert.LessOrEqual(t, r.backoff(1), time.Second)
+}
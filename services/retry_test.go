@@ -0,0 +1,184 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupRetryConfig(t *testing.T) {
+	viper.Set("cloudflare.retry.attempts", 3)
+	viper.Set("cloudflare.retry.minDelay", "1ms")
+	viper.Set("cloudflare.retry.maxDelay", "5ms")
+	t.Cleanup(func() {
+		viper.Set("cloudflare.retry.attempts", nil)
+		viper.Set("cloudflare.retry.minDelay", nil)
+		viper.Set("cloudflare.retry.maxDelay", nil)
+	})
+}
+
+func statusResponse(status int, header http.Header) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+}
+
+func TestRetryingClient_RetriesTransientErrors(t *testing.T) {
+	setupRetryConfig(t)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(nil, errors.New("connection reset")).Once()
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusBadGateway, nil), nil).Once()
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusOK, nil), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/zones", nil)
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRetryingClient_GivesUpAfterAttempts(t *testing.T) {
+	setupRetryConfig(t)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusServiceUnavailable, nil), nil).Times(3)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/zones", nil)
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestRetryingClient_DisabledWithSingleAttempt(t *testing.T) {
+	setupRetryConfig(t)
+	viper.Set("cloudflare.retry.attempts", 1)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusServiceUnavailable, nil), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/zones", nil)
+	resp, _ := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestRetryingClient_DoesNotRepeatPostOnServerError(t *testing.T) {
+	setupRetryConfig(t)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusInternalServerError, nil), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.foo.com/zones", bytes.NewBufferString("{}"))
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestRetryingClient_RepeatsRateLimitedPostWithBody(t *testing.T) {
+	setupRetryConfig(t)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}), nil).Once()
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		b, _ := io.ReadAll(r.Body)
+		return string(b) == `{"content":"1.2.3.4"}`
+	})).Return(statusResponse(http.StatusOK, nil), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.foo.com/zones", bytes.NewBufferString(`{"content":"1.2.3.4"}`))
+	// consume the body like a transport would
+	_, _ = io.ReadAll(req.Body)
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRetryingClient_GivesUpIfRetryAfterExceedsMaxDelay(t *testing.T) {
+	setupRetryConfig(t)
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/zones", nil)
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestRetryingClient_HonorsRetryAfter(t *testing.T) {
+	setupRetryConfig(t)
+	viper.Set("cloudflare.retry.maxDelay", "2s")
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}}), nil).Once()
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusOK, nil), nil).Once()
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.foo.com/zones", nil)
+	start := time.Now()
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRetryingClient_StopsAtDeadline(t *testing.T) {
+	setupRetryConfig(t)
+	viper.Set("cloudflare.retry.maxDelay", "2s")
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}}), nil).Once()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.foo.com/zones", nil)
+	resp, err := services.NewRetryingClient("cloudflare", h).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestPorkbunDnsUpdateService_UpdateRecord_RetriesQuery(t *testing.T) {
+	setupPorkbunConfig()
+	viper.Set("porkbun.retry.minDelay", "1ms")
+	defer viper.Set("porkbun.retry.minDelay", nil)
+
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return strings.Contains(r.URL.Path, "retrieveByNameType")
+	})).Return(statusResponse(http.StatusServiceUnavailable, nil), nil).Once()
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return strings.Contains(r.URL.Path, "retrieveByNameType")
+	})).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"status":"SUCCESS","records":[]}`)),
+	}, nil).Once()
+	h.On("Do", mock.MatchedBy(func(r *http.Request) bool {
+		return strings.Contains(r.URL.Path, "/dns/create/")
+	})).Return(statusResponse(http.StatusServiceUnavailable, nil), nil).Once()
+
+	registrar, err := services.NewPorkbunDnsUpdateService(services.NewRetryingClient("porkbun", h))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynReq := &services.DynDnsRequest{
+		Subdomain: "bar",
+		Domain:    "foo.com",
+		IP:        "1.2.3.4",
+	}
+
+	result, err := registrar.UpdateRecord(context.Background(), dynReq)
+
+	assert.ErrorIs(t, err, services.ErrRegistrarRejectedRequest)
+	assert.Nil(t, result)
+}
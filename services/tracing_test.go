@@ -0,0 +1,42 @@
+package services_test
+
+import (
+	"errors"
+	mockservices "github.com/davidramiro/frigabun/mocks/github.com/davidramiro/frigabun/services"
+	"github.com/davidramiro/frigabun/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"testing"
+)
+
+func TestTracingClient(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	h := mockservices.NewMockHTTPClient(t)
+	h.On("Do", mock.Anything).Return(statusResponse(http.StatusTooManyRequests, nil), nil).Once()
+	h.On("Do", mock.Anything).Return(nil, errors.New("connection reset")).Once()
+
+	client := services.NewTracingClient("cloudflare", h)
+
+	for range 2 {
+		req, _ := http.NewRequest(http.MethodPut, "https://api.foo.com/client/v4/zones/bar", nil)
+		_, _ = client.Do(req)
+	}
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "PUT cloudflare", spans[0].Name())
+		assert.Contains(t, spans[0].Attributes(), attribute.Int("http.response.status_code", http.StatusTooManyRequests))
+		assert.Contains(t, spans[0].Attributes(), attribute.String("url.path", "/client/v4/zones/bar"))
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+
+		assert.Equal(t, "connection reset", spans[1].Status().Description)
+	}
+}